@@ -3,15 +3,25 @@ module github.com/hashicorp/terraform-provider-helm
 go 1.14
 
 require (
+	github.com/Azure/go-autorest/autorest/adal v0.5.0
+	github.com/Masterminds/semver/v3 v3.1.0
+	github.com/aws/aws-sdk-go v1.27.0
+	github.com/containerd/containerd v1.3.4
+	github.com/deislabs/oras v0.8.1
 	github.com/evanphx/json-patch v4.5.0+incompatible // indirect
 	github.com/hashicorp/go-cty v1.4.1-0.20200414143053-d3edf31b6320
+	github.com/hashicorp/go-hclog v0.9.2
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.3.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/mitchellh/go-testing-interface v1.14.1 // indirect
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
 	github.com/pkg/errors v0.9.1
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	helm.sh/helm/v3 v3.3.4
 	k8s.io/api v0.18.8
 	k8s.io/apimachinery v0.18.8
+	k8s.io/cli-runtime v0.18.8
 	k8s.io/client-go v0.18.8
 	k8s.io/klog v1.0.0
 	rsc.io/letsencrypt v0.0.3 // indirect
@@ -0,0 +1,217 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// removedAPI is an API version of a kind removed from Kubernetes.
+type removedAPI struct {
+	apiVersion  string
+	kind        string
+	removedIn   string
+	replacement string
+}
+
+// removedAPIs are the API versions removed from Kubernetes, as listed in the
+// deprecated API migration guide.
+var removedAPIs = []removedAPI{
+	{"extensions/v1beta1", "Deployment", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "DaemonSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.16", "policy/v1beta1"},
+	{"apps/v1beta1", "Deployment", "1.16", "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "Deployment", "1.16", "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "Ingress", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass", "1.22", "networking.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.22", "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "1.22", "apiregistration.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "1.22", "storage.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", "1.22", "coordination.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "1.22", "certificates.k8s.io/v1"},
+	{"batch/v1beta1", "CronJob", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "1.25", "autoscaling/v2"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.25", ""},
+	{"node.k8s.io/v1beta1", "RuntimeClass", "1.25", "node.k8s.io/v1"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// findRemovedAPI returns the removal of the API version of the kind, if it
+// was removed.
+func findRemovedAPI(apiVersion, kind string) (removedAPI, bool) {
+	for _, api := range removedAPIs {
+		if api.apiVersion == apiVersion && api.kind == kind {
+			return api, true
+		}
+	}
+	return removedAPI{}, false
+}
+
+func (api removedAPI) String() string {
+	s := fmt.Sprintf("%s %s was removed in Kubernetes %s", api.apiVersion, api.kind, api.removedIn)
+	if api.replacement != "" {
+		s += fmt.Sprintf(", use %s instead", api.replacement)
+	}
+	return s
+}
+
+// manifestHead is the type and name of a manifest.
+type manifestHead struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// removedAPIUsages returns the usages of the API versions removed from the
+// cluster by the manifests, i.e. the API versions of the known removals
+// which aren't served by the cluster.
+func removedAPIUsages(manifests []string, apiVersions chartutil.VersionSet) []string {
+	var usages []string
+	for _, manifest := range manifests {
+		var head manifestHead
+		if err := yaml.Unmarshal([]byte(manifest), &head); err != nil || head.Kind == "" {
+			continue
+		}
+
+		api, removed := findRemovedAPI(head.APIVersion, head.Kind)
+		if !removed {
+			continue
+		}
+		if apiVersions.Has(head.APIVersion + "/" + head.Kind) {
+			debug("%s %s uses a deprecated API version: %s", head.Kind, head.Metadata.Name, api)
+			continue
+		}
+		usages = append(usages, fmt.Sprintf("%s %s (%s): %s", head.Kind, head.Metadata.Name, manifestName(manifest), api))
+	}
+	sort.Strings(usages)
+	return usages
+}
+
+// splitManifest returns the manifests of the resources of a release
+// manifest, in order.
+func splitManifest(manifest string) []string {
+	split := releaseutil.SplitManifests(manifest)
+
+	var keys []string
+	for k := range split {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var manifests []string
+	for _, k := range keys {
+		if strings.TrimSpace(split[k]) != "" {
+			manifests = append(manifests, split[k])
+		}
+	}
+	return manifests
+}
+
+// mapRemovedAPIs rewrites the release manifest as done by helm-mapkubeapis:
+// the removed API versions which aren't served by the cluster are replaced,
+// and the resources of the API versions removed without replacement are
+// dropped. It returns the new manifest and the changes made.
+func mapRemovedAPIs(manifest string, apiVersions chartutil.VersionSet) (string, []string) {
+	var manifests, changes []string
+	for _, m := range splitManifest(manifest) {
+		var head manifestHead
+		if err := yaml.Unmarshal([]byte(m), &head); err != nil {
+			manifests = append(manifests, m)
+			continue
+		}
+
+		api, removed := findRemovedAPI(head.APIVersion, head.Kind)
+		if !removed || apiVersions.Has(head.APIVersion+"/"+head.Kind) {
+			manifests = append(manifests, m)
+			continue
+		}
+
+		if api.replacement == "" {
+			changes = append(changes, fmt.Sprintf("dropped %s %s (%s)", head.Kind, head.Metadata.Name, api.apiVersion))
+			continue
+		}
+
+		apiVersionLine := regexp.MustCompile(`(?m)^apiVersion:\s*["']?` + regexp.QuoteMeta(api.apiVersion) + `["']?\s*$`)
+		manifests = append(manifests, apiVersionLine.ReplaceAllString(m, "apiVersion: "+api.replacement))
+		changes = append(changes, fmt.Sprintf("mapped %s %s from %s to %s", head.Kind, head.Metadata.Name, api.apiVersion, api.replacement))
+	}
+	if len(changes) == 0 {
+		return manifest, nil
+	}
+	return "---\n" + strings.Join(manifests, "\n---\n") + "\n", changes
+}
+
+// repairRemovedAPIs maps the removed API versions of the manifests of the
+// revisions of the release Helm upgrades from, the last and the deployed
+// ones, so that the release can be upgraded.
+func repairRemovedAPIs(cfg *action.Configuration, name string) error {
+	dc, err := cfg.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil {
+		return errors.Wrap(err, "could not get the API versions of the cluster")
+	}
+
+	var revisions []*release.Release
+	last, err := cfg.Releases.Last(name)
+	if err != nil {
+		return errors.Wrapf(err, "could not get release %s", name)
+	}
+	revisions = append(revisions, last)
+	if deployed, err := cfg.Releases.Deployed(name); err == nil && deployed.Version != last.Version {
+		revisions = append(revisions, deployed)
+	}
+
+	for _, rel := range revisions {
+		manifest, changes := mapRemovedAPIs(rel.Manifest, apiVersions)
+		if len(changes) == 0 {
+			continue
+		}
+
+		debug("Repairing revision %d of release %s: %s", rel.Version, name, strings.Join(changes, ", "))
+		rel.Manifest = manifest
+		if err := cfg.Releases.Update(rel); err != nil {
+			return errors.Wrapf(err, "failed to repair revision %d of release %s", rel.Version, name)
+		}
+	}
+	return nil
+}
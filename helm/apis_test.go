@@ -0,0 +1,78 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestRemovedAPIUsages(t *testing.T) {
+	manifests := splitManifest(`---
+# Source: app/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+# Source: app/templates/cronjob.yaml
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`)
+
+	// batch/v1beta1 is still served, and apps/v1 was never removed.
+	apiVersions := chartutil.VersionSet{"apps/v1", "apps/v1/Deployment", "batch/v1beta1", "batch/v1beta1/CronJob"}
+
+	usages := removedAPIUsages(manifests, apiVersions)
+	expected := "Ingress web (app/templates/ingress.yaml): networking.k8s.io/v1beta1 Ingress was removed in Kubernetes 1.22, use networking.k8s.io/v1 instead"
+	if len(usages) != 1 || usages[0] != expected {
+		t.Errorf("expected %q, got %q", expected, usages)
+	}
+}
+
+func TestMapRemovedAPIs(t *testing.T) {
+	manifest := `---
+# Source: app/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+# Source: app/templates/psp.yaml
+apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+	mapped, changes := mapRemovedAPIs(manifest, chartutil.VersionSet{"v1", "v1/Service"})
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %q", changes)
+	}
+
+	manifests := splitManifest(mapped)
+	if len(manifests) != 2 {
+		t.Fatalf("expected the pod security policy to be dropped, got %q", mapped)
+	}
+	expected := "# Source: app/templates/ingress.yaml\napiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: web"
+	if manifests[0] != expected {
+		t.Errorf("expected the ingress to be mapped to networking.k8s.io/v1, got %q", manifests[0])
+	}
+
+	if _, changes := mapRemovedAPIs(manifest, chartutil.VersionSet{"networking.k8s.io/v1beta1/Ingress", "policy/v1beta1/PodSecurityPolicy"}); len(changes) != 0 {
+		t.Errorf("expected the API versions served by the cluster to be kept, got %q", changes)
+	}
+}
@@ -0,0 +1,70 @@
+package helm
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/client-go/discovery"
+)
+
+// clusterCapabilities returns the capabilities of the cluster, as Helm
+// gets them when installing a release.
+func clusterCapabilities(dc discovery.CachedDiscoveryInterface) (*chartutil.Capabilities, error) {
+	kv, err := dc.ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the version of the cluster")
+	}
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the API versions of the cluster")
+	}
+
+	return &chartutil.Capabilities{
+		KubeVersion: chartutil.KubeVersion{
+			Version: kv.GitVersion,
+			Major:   kv.Major,
+			Minor:   kv.Minor,
+		},
+		APIVersions: apiVersions,
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}, nil
+}
+
+// clientCapabilities returns the capabilities the charts are rendered with
+// when the cluster can't be reached: those of helm template, for the
+// kube_version of the provider and with its api_versions. The API versions
+// of the known removals are served until the version they are removed in.
+func clientCapabilities(m *Meta) (*chartutil.Capabilities, error) {
+	caps := &chartutil.Capabilities{
+		KubeVersion: chartutil.DefaultCapabilities.KubeVersion,
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}
+
+	if m.KubeVersion != "" {
+		v, err := semver.NewVersion(m.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube_version %q: %s", m.KubeVersion, err)
+		}
+		caps.KubeVersion = chartutil.KubeVersion{
+			Version: "v" + v.String(),
+			Major:   fmt.Sprint(v.Major()),
+			Minor:   fmt.Sprint(v.Minor()),
+		}
+	}
+	version, err := semver.NewVersion(caps.KubeVersion.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	caps.APIVersions = append(caps.APIVersions, chartutil.DefaultVersionSet...)
+	for _, api := range removedAPIs {
+		if in, err := semver.NewVersion(api.removedIn); err == nil && version.LessThan(in) {
+			caps.APIVersions = append(caps.APIVersions, api.apiVersion+"/"+api.kind)
+		}
+	}
+	caps.APIVersions = append(caps.APIVersions, m.APIVersions...)
+	return caps, nil
+}
@@ -0,0 +1,39 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestClientCapabilities(t *testing.T) {
+	caps, err := clientCapabilities(&Meta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.KubeVersion.Version != "v1.18.0" {
+		t.Errorf("expected the Helm default version, got %s", caps.KubeVersion.Version)
+	}
+	if !caps.APIVersions.Has("extensions/v1beta1/Ingress") {
+		t.Error("expected the API versions removed after 1.18 to be served")
+	}
+
+	caps, err = clientCapabilities(&Meta{KubeVersion: "1.25.3", APIVersions: []string{"monitoring.coreos.com/v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.KubeVersion.Version != "v1.25.3" || caps.KubeVersion.Major != "1" || caps.KubeVersion.Minor != "25" {
+		t.Errorf("unexpected version %#v", caps.KubeVersion)
+	}
+	if !caps.APIVersions.Has("monitoring.coreos.com/v1") {
+		t.Error("expected the API versions of the provider")
+	}
+	if !caps.APIVersions.Has("autoscaling/v2beta2/HorizontalPodAutoscaler") {
+		t.Error("expected the API versions removed after 1.25 to be served")
+	}
+	if caps.APIVersions.Has("extensions/v1beta1/Ingress") || caps.APIVersions.Has("batch/v1beta1/CronJob") {
+		t.Error("expected the API versions removed in 1.25 to be left out")
+	}
+
+	if _, err := clientCapabilities(&Meta{KubeVersion: "latest"}); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
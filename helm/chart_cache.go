@@ -0,0 +1,139 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChartCache caches the downloaded chart archives by repository, name,
+// version and digest, so that the releases of the same chart, and the
+// following runs, don't download them again.
+type ChartCache struct {
+	Path string
+	// TTL is the time the archives are used for after their download, or
+	// forever if zero.
+	TTL time.Duration
+	// MaxSize is the maximum size of the cache in bytes, the oldest
+	// archives being removed first, or unlimited if zero.
+	MaxSize int64
+
+	mutex sync.Mutex
+}
+
+// chartCacheKey returns the key of the chart archive in the cache.
+func chartCacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ChartCache) path(key string) string {
+	return filepath.Join(c.Path, key+".tgz")
+}
+
+// get returns the path of the cached archive of the key, if it is cached
+// and not expired.
+func (c *ChartCache) get(key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := c.path(key)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if c.TTL > 0 && time.Since(fi.ModTime()) > c.TTL {
+		debug("The cached chart %s expired", path)
+		os.Remove(path)
+		return "", false
+	}
+	debug("Using the cached chart %s", path)
+	return path, true
+}
+
+// put copies the downloaded archive into the cache, removing the oldest
+// archives if the cache grows over its maximum size, and returns the path
+// of the cached archive.
+func (c *ChartCache) put(key, src string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.MkdirAll(c.Path, 0755); err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	// The archive is written to a temporary file, so that an interrupted
+	// copy isn't mistaken for a cached archive.
+	out, err := ioutil.TempFile(c.Path, ".download-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+
+	path := c.path(key)
+	if err := os.Rename(out.Name(), path); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return path, c.prune()
+}
+
+// prune removes the expired archives, then the oldest ones until the cache
+// fits its maximum size.
+func (c *ChartCache) prune() error {
+	files, err := filepath.Glob(filepath.Join(c.Path, "*.tgz"))
+	if err != nil {
+		return err
+	}
+
+	var archives []os.FileInfo
+	var size int64
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if c.TTL > 0 && time.Since(fi.ModTime()) > c.TTL {
+			os.Remove(f)
+			continue
+		}
+		archives = append(archives, fi)
+		size += fi.Size()
+	}
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ModTime().Before(archives[j].ModTime())
+	})
+	// The most recent archive, just added, is always kept.
+	for i := 0; size > c.MaxSize && i < len(archives)-1; i++ {
+		debug("Removing the cached chart %s, the cache is full", archives[i].Name())
+		if err := os.Remove(filepath.Join(c.Path, archives[i].Name())); err != nil {
+			return err
+		}
+		size -= archives[i].Size()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChartCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chart-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "redis-6.0.1.tgz")
+	if err := ioutil.WriteFile(src, make([]byte, 600), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &ChartCache{Path: filepath.Join(dir, "charts"), TTL: time.Hour, MaxSize: 1000}
+	key := chartCacheKey("https://charts.example.com/redis-6.0.1.tgz", "sha256:abc")
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected a cache miss")
+	}
+	if _, err := c.put(key, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(key); !ok {
+		t.Fatal("expected a cache hit")
+	}
+
+	// The cache is full, the oldest chart is removed.
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(c.path(key), old, old); err != nil {
+		t.Fatal(err)
+	}
+	other := chartCacheKey("https://charts.example.com/redis-6.0.2.tgz", "sha256:def")
+	if _, err := c.put(other, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(key); ok {
+		t.Error("expected the oldest chart to be removed")
+	}
+	if _, ok := c.get(other); !ok {
+		t.Error("expected the last chart to be cached")
+	}
+
+	// The expired charts are downloaded again.
+	expired := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(c.path(other), expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(other); ok {
+		t.Error("expected the expired chart to be removed")
+	}
+}
@@ -0,0 +1,260 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldManager is the manager of the fields applied by the provider.
+const fieldManager = "terraform-provider-helm"
+
+// The policies of the CRDs of the crds/ directories of the chart.
+const (
+	crdPolicySkip             = "skip"
+	crdPolicyCreate           = "create"
+	crdPolicyCreateAndUpgrade = "create-and-upgrade"
+	crdPolicyFailIfMissing    = "fail-if-missing"
+)
+
+var crdPolicies = []string{
+	crdPolicySkip,
+	crdPolicyCreate,
+	crdPolicyCreateAndUpgrade,
+	crdPolicyFailIfMissing,
+}
+
+// crdPolicy returns the CRD policy of the release, falling back to the
+// skip_crds and upgrade_crds attributes when crd_policy is not set.
+func crdPolicy(d resourceGetter) string {
+	if p := d.Get("crd_policy").(string); p != "" {
+		return p
+	}
+	if d.Get("skip_crds").(bool) {
+		return crdPolicySkip
+	}
+	if d.Get("upgrade_crds").(bool) {
+		return crdPolicyCreateAndUpgrade
+	}
+	return crdPolicyCreate
+}
+
+// checkCRDs returns an error if any of the CRDs is not installed on the
+// cluster.
+func checkCRDs(cfg *action.Configuration, crds []chart.CRD) error {
+	var missing []string
+	for _, obj := range crds {
+		res, err := cfg.KubeClient.Build(bytes.NewBuffer(obj.File.Data), false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check CRD %s", obj.Name)
+		}
+
+		for _, info := range res {
+			err := info.Get()
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, info.Name)
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to check CRD %s", obj.Name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the CRDs required by the chart are not installed on the cluster: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// upgradeCRDs applies the CRDs of the crds/ directories of the chart and of
+// its subcharts with server-side apply. Helm only creates them on install.
+func upgradeCRDs(cfg *action.Configuration, crds []chart.CRD) error {
+	var applied kube.ResourceList
+	for _, obj := range crds {
+		res, err := cfg.KubeClient.Build(bytes.NewBuffer(obj.File.Data), false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to upgrade CRD %s", obj.Name)
+		}
+
+		for _, info := range res {
+			debug("Applying CRD %s", info.Name)
+			if err := applyResource(info); err != nil {
+				return errors.Wrapf(err, "failed to upgrade CRD %s", obj.Name)
+			}
+		}
+		applied = append(applied, res...)
+	}
+
+	return waitForCRDs(cfg, applied)
+}
+
+// waitForCRDs waits for the applied CRDs to be established, refreshing the
+// discovery cache.
+func waitForCRDs(cfg *action.Configuration, applied kube.ResourceList) error {
+	if len(applied) == 0 {
+		return nil
+	}
+
+	// Invalidate the local cache, since it may not have the new CRDs or
+	// versions present.
+	discoveryClient, err := cfg.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+	discoveryClient.Invalidate()
+
+	if err := cfg.KubeClient.Wait(applied, 60*time.Second); err != nil {
+		return err
+	}
+
+	// Make sure to force a rebuild of the cache.
+	discoveryClient.ServerGroups()
+	return nil
+}
+
+// templateCRDs returns the CRDs of the rendered manifests of the templates,
+// leaving out those of the crds/ directories.
+func templateCRDs(manifests []string) []string {
+	var crds []string
+	for _, manifest := range manifests {
+		if !strings.Contains(manifestName(manifest), "/templates/") {
+			continue
+		}
+		var obj struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+			continue
+		}
+		if obj.Kind == "CustomResourceDefinition" && strings.HasPrefix(obj.APIVersion, "apiextensions.k8s.io/") {
+			crds = append(crds, manifest)
+		}
+	}
+	return crds
+}
+
+// installTemplateCRDs applies the CRDs rendered from the templates of the
+// chart, with the capabilities of the cluster, and waits for them to be
+// established before the release is installed or upgraded: Helm fails to
+// map the custom resources of the templates otherwise. The CRDs are applied
+// with the ownership metadata of the release, so that Helm adopts them.
+func installTemplateCRDs(cfg *action.Configuration, d resourceGetter, path string, values map[string]interface{}, isUpgrade bool) error {
+	rel, err := renderClusterRelease(cfg, d, path, values, isUpgrade)
+	if err != nil {
+		return err
+	}
+
+	var applied kube.ResourceList
+	for _, manifest := range templateCRDs(splitManifest(rel.Manifest)) {
+		res, err := cfg.KubeClient.Build(strings.NewReader(manifest), false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to install %s", manifestName(manifest))
+		}
+
+		for _, info := range res {
+			accessor, err := meta.Accessor(info.Object)
+			if err != nil {
+				return err
+			}
+			labels := accessor.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[appManagedByLabel] = appManagedByHelm
+			accessor.SetLabels(labels)
+
+			annotations := accessor.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[helmReleaseNameAnnotation] = rel.Name
+			annotations[helmReleaseNamespaceAnnotation] = rel.Namespace
+			accessor.SetAnnotations(annotations)
+
+			debug("Applying CRD %s before the release", info.Name)
+			if err := applyResource(info); err != nil {
+				return errors.Wrapf(err, "failed to install CRD %s", info.Name)
+			}
+		}
+		applied = append(applied, res...)
+	}
+	return waitForCRDs(cfg, applied)
+}
+
+// applyResource creates or updates the resource with server-side apply,
+// taking ownership of the conflicting fields.
+func applyResource(info *resource.Info) error {
+	data, err := json.Marshal(info.Object)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	obj, err := resource.NewHelper(info.Client, info.Mapping).Patch(info.Namespace, info.Name, types.ApplyPatchType, data, &metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return err
+	}
+
+	return info.Refresh(obj, true)
+}
+
+// keepCRDsOnUninstall removes the CRDs from the manifest of the last
+// release, so they are left on the cluster when it is uninstalled along
+// with their custom resources. The CRDs of the crds/ directories are never
+// deleted by Helm.
+func keepCRDsOnUninstall(cfg *action.Configuration, name string) error {
+	rel, err := cfg.Releases.Last(name)
+	if err != nil {
+		return err
+	}
+
+	manifests := releaseutil.SplitManifests(rel.Manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var kept []string
+	removed := false
+	for _, k := range keys {
+		var head releaseutil.SimpleHead
+		if err := yaml.Unmarshal([]byte(manifests[k]), &head); err != nil {
+			return errors.Wrapf(err, "failed to parse the manifest of release %s", name)
+		}
+
+		if head.Kind == "CustomResourceDefinition" {
+			removed = true
+			continue
+		}
+		kept = append(kept, manifests[k])
+	}
+
+	if !removed {
+		return nil
+	}
+
+	debug("Keeping the CRDs of release %s", name)
+	rel.Manifest = strings.Join(kept, "\n---\n")
+	return cfg.Releases.Update(rel)
+}
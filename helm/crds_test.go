@@ -0,0 +1,69 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestKeepCRDsOnUninstall(t *testing.T) {
+	manifest := `---
+# Source: test/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: tests.example.com
+---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	rel := &release.Release{
+		Name:     "test",
+		Version:  1,
+		Manifest: manifest,
+		Info:     &release.Info{Status: release.StatusDeployed},
+	}
+	if err := cfg.Releases.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keepCRDsOnUninstall(cfg, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := cfg.Releases.Last("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(last.Manifest, "CustomResourceDefinition") {
+		t.Errorf("expected the CRD to be removed from the manifest, got:\n%s", last.Manifest)
+	}
+	if !strings.Contains(last.Manifest, "kind: ConfigMap") {
+		t.Errorf("expected the ConfigMap to be kept in the manifest, got:\n%s", last.Manifest)
+	}
+}
+
+func TestTemplateCRDs(t *testing.T) {
+	crd := "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: backups.example.com\n"
+	manifests := []string{
+		"# Source: app/templates/crd.yaml\n" + crd,
+		"# Source: app/charts/operator/templates/crd.yaml\n" + crd,
+		"# Source: app/crds/backups.yaml\n" + crd,
+		"# Source: app/templates/backup.yaml\napiVersion: example.com/v1\nkind: Backup\nmetadata:\n  name: daily\n",
+		"# Source: app/templates/crd-like.yaml\napiVersion: example.com/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: other\n",
+	}
+
+	crds := templateCRDs(manifests)
+	if len(crds) != 2 || crds[0] != manifests[0] || crds[1] != manifests[1] {
+		t.Errorf("expected the CRDs of the templates, got %q", crds)
+	}
+}
@@ -0,0 +1,109 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+func dataChartCRDs() *schema.Resource {
+	s := chartSchema()
+	// The CRDs are cluster-scoped.
+	delete(s, "namespace")
+	s["crds"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "The CRDs of the crds/ directories of the chart and of its enabled subcharts, in the order Helm installs them.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The name of the CRD.",
+				},
+				"file": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The path of the file of the CRD in the chart.",
+				},
+				"manifest": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The manifest of the CRD.",
+				},
+			},
+		},
+	}
+
+	return &schema.Resource{
+		ReadContext: dataChartCRDsRead,
+		Schema:      s,
+	}
+}
+
+func dataChartCRDsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	cpo, name, err := chartPathOptions(d, m)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	values, err := getValues(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	c, _, err := getChart(d, m, name, cpo)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Like on install, the CRDs of the disabled subcharts are left out.
+	if err := chartutil.ProcessDependencies(c, values); err != nil {
+		return diag.FromErr(err)
+	}
+	crds, err := chartCRDs(c)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("crds", crds); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("version", c.Metadata.Version); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", cpo.RepoURL, name))
+	return nil
+}
+
+// chartCRDs returns the CRDs of the crds/ directories of the chart and of its
+// subcharts, one per YAML document of their files.
+func chartCRDs(c *chart.Chart) ([]interface{}, error) {
+	crds := []interface{}{}
+	for _, crd := range c.CRDObjects() {
+		for _, manifest := range splitManifest(string(crd.File.Data)) {
+			var obj struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}
+			if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse the CRD %s", crd.Filename)
+			}
+			crds = append(crds, map[string]interface{}{
+				"name":     obj.Metadata.Name,
+				"file":     crd.Filename,
+				"manifest": manifest,
+			})
+		}
+	}
+	return crds, nil
+}
@@ -0,0 +1,48 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestChartCRDs(t *testing.T) {
+	crd := func(name string) string {
+		return "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: " + name + "\n"
+	}
+	sub := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "operator", Version: "1.0.0"},
+		Files:    []*chart.File{{Name: "crds/backups.yaml", Data: []byte(crd("backups.example.com"))}},
+	}
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Version: "1.0.0"},
+		Files: []*chart.File{
+			{Name: "crds/databases.yaml", Data: []byte(crd("databases.example.com") + "---\n" + crd("users.example.com"))},
+			{Name: "README.md", Data: []byte("# app")},
+		},
+	}
+	c.AddDependency(sub)
+
+	crds, err := chartCRDs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ name, file string }{
+		{"databases.example.com", "app/crds/databases.yaml"},
+		{"users.example.com", "app/crds/databases.yaml"},
+		{"backups.example.com", "app/charts/operator/crds/backups.yaml"},
+	}
+	if len(crds) != len(expected) {
+		t.Fatalf("expected %d CRDs, got %#v", len(expected), crds)
+	}
+	for i, e := range expected {
+		crd := crds[i].(map[string]interface{})
+		if crd["name"] != e.name || crd["file"] != e.file {
+			t.Errorf("expected CRD %s of %s, got %s of %s", e.name, e.file, crd["name"], crd["file"])
+		}
+		if crd["manifest"] == "" {
+			t.Errorf("expected the manifest of CRD %s", e.name)
+		}
+	}
+}
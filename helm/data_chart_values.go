@@ -0,0 +1,95 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+// chartValuesAttributes are the attributes of chartSchema setting the values
+// of the chart, which helm_chart_values doesn't have.
+var chartValuesAttributes = []string{"namespace", "values", "values_merge", "set", "set_sensitive", "unset"}
+
+func dataChartValues() *schema.Resource {
+	s := chartSchema()
+	for _, k := range chartValuesAttributes {
+		delete(s, k)
+	}
+	s["values"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "The values.yaml file of the chart.",
+	}
+	s["values_json"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "The default values of the chart, JSON encoded.",
+	}
+
+	return &schema.Resource{
+		ReadContext: dataChartValuesRead,
+		Schema:      s,
+	}
+}
+
+func dataChartValuesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	cpo, name, err := chartPathOptions(d, m)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	c, _, err := getChart(d, m, name, cpo)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	values, valuesJSON, err := chartDefaultValues(c)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("values", values); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("values_json", valuesJSON); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("version", c.Metadata.Version); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", cpo.RepoURL, name))
+	return nil
+}
+
+// chartDefaultValues returns the values.yaml file of the chart as is, and
+// its values JSON encoded. The values of the charts without values.yaml file
+// are empty.
+func chartDefaultValues(c *chart.Chart) (string, string, error) {
+	values := c.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, f := range c.Raw {
+		if f.Name == chartutil.ValuesfileName {
+			return string(f.Data), string(valuesJSON), nil
+		}
+	}
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return "", "", err
+	}
+	return string(raw), string(valuesJSON), nil
+}
@@ -0,0 +1,38 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestChartDefaultValues(t *testing.T) {
+	raw := "# The number of replicas.\nreplicas: 1\nimage:\n  tag: \"1.0\"\n"
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Version: "1.0.0"},
+		Raw:      []*chart.File{{Name: "values.yaml", Data: []byte(raw)}},
+		Values: map[string]interface{}{
+			"replicas": float64(1),
+			"image":    map[string]interface{}{"tag": "1.0"},
+		},
+	}
+
+	values, valuesJSON, err := chartDefaultValues(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values != raw {
+		t.Errorf("expected the values.yaml file as is, got %q", values)
+	}
+	if expected := `{"image":{"tag":"1.0"},"replicas":1}`; valuesJSON != expected {
+		t.Errorf("expected %s, got %s", expected, valuesJSON)
+	}
+
+	values, valuesJSON, err = chartDefaultValues(&chart.Chart{Metadata: &chart.Metadata{Name: "empty"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values != "{}\n" || valuesJSON != "{}" {
+		t.Errorf("expected empty values, got %q and %q", values, valuesJSON)
+	}
+}
@@ -0,0 +1,95 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+// envAttributes are the attributes of helm_env, by the environment variable
+// of helm env they are set from.
+var envAttributes = map[string]string{
+	"HELM_CACHE_HOME":        "cache_home",
+	"HELM_CONFIG_HOME":       "config_home",
+	"HELM_DATA_HOME":         "data_home",
+	"HELM_PLUGINS":           "plugins_path",
+	"HELM_REGISTRY_CONFIG":   "registry_config_path",
+	"HELM_REPOSITORY_CACHE":  "repository_cache",
+	"HELM_REPOSITORY_CONFIG": "repository_config_path",
+	"HELM_NAMESPACE":         "namespace",
+}
+
+func dataEnv() *schema.Resource {
+	s := map[string]*schema.Schema{
+		"debug": {
+			Type:        schema.TypeBool,
+			Computed:    true,
+			Description: "Whether Helm is running in debug mode.",
+		},
+		"helm_driver": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The backend storage driver of the releases.",
+		},
+		"env": {
+			Type:        schema.TypeMap,
+			Computed:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "The environment variables of the Helm environment, as printed by helm env.",
+		},
+	}
+	for env, attr := range envAttributes {
+		s[attr] = &schema.Schema{
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: fmt.Sprintf("The value of %s.", env),
+		}
+	}
+
+	return &schema.Resource{
+		ReadContext: dataEnvRead,
+		Schema:      s,
+	}
+}
+
+func dataEnvRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	env := helmEnv(m)
+	for k, attr := range envAttributes {
+		if err := d.Set(attr, env[k]); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if err := d.Set("env", env); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("debug", m.Settings.Debug); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("helm_driver", env["HELM_DRIVER"]); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(helmpath.ConfigPath(""))
+	return nil
+}
+
+// helmEnv returns the environment of Helm as configured by the provider,
+// like helm env. The Kubernetes token and the path of the Helm binary,
+// which is the provider, are left out. Helm defaults to the secret driver.
+func helmEnv(m *Meta) map[string]string {
+	env := m.Settings.EnvVars()
+	delete(env, "HELM_BIN")
+	delete(env, "HELM_KUBETOKEN")
+
+	env["HELM_DRIVER"] = m.HelmDriver
+	if env["HELM_DRIVER"] == "" {
+		env["HELM_DRIVER"] = "secret"
+	}
+	return env
+}
@@ -0,0 +1,29 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+func TestHelmEnv(t *testing.T) {
+	m := &Meta{Settings: cli.New()}
+	m.Settings.PluginsDirectory = "/plugins"
+	m.Settings.KubeToken = "secret-token"
+
+	env := helmEnv(m)
+	if env["HELM_PLUGINS"] != "/plugins" {
+		t.Errorf("unexpected HELM_PLUGINS %q", env["HELM_PLUGINS"])
+	}
+	if env["HELM_DRIVER"] != "secret" {
+		t.Errorf("expected the secret driver by default, got %q", env["HELM_DRIVER"])
+	}
+	if _, ok := env["HELM_KUBETOKEN"]; ok {
+		t.Error("expected the token to be left out")
+	}
+
+	m.HelmDriver = "configmap"
+	if env := helmEnv(m); env["HELM_DRIVER"] != "configmap" {
+		t.Errorf("unexpected HELM_DRIVER %q", env["HELM_DRIVER"])
+	}
+}
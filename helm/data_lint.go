@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+// chartAttributes are the attributes of helm_release locating the chart and
+// setting its values, shared with the data sources.
+var chartAttributes = []string{
+	"chart",
+	"chart_sha256",
+	"repository",
+	"repository_username",
+	"repository_password",
+	"repository_token",
+	"repository_headers",
+	"pass_credentials",
+	"repository_ca_file",
+	"repository_cert_file",
+	"repository_key_file",
+	"repository_ca_certificate",
+	"repository_client_certificate",
+	"repository_client_key",
+	"insecure_skip_tls_verify",
+	"plain_http",
+	"skip_repo_update",
+	"chart_digest",
+	"version",
+	"devel",
+	"include_prereleases",
+	"keyring",
+	"verify",
+	"namespace",
+	"values",
+	"values_merge",
+	"set",
+	"set_sensitive",
+	"unset",
+}
+
+// chartSchema returns the schema of the attributes of helm_release locating
+// the chart and setting its values, for the data sources.
+func chartSchema() map[string]*schema.Schema {
+	release := resourceRelease().Schema
+
+	s := map[string]*schema.Schema{}
+	for _, k := range chartAttributes {
+		attr := *release[k]
+		attr.ForceNew = false
+		s[k] = &attr
+	}
+	return s
+}
+
+// lintSeverities are the names of the severities of the lint messages.
+var lintSeverities = []string{"UNKNOWN", "INFO", "WARNING", "ERROR"}
+
+func dataLint() *schema.Resource {
+	s := chartSchema()
+	s["strict"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Fail on lint warnings.",
+	}
+	s["messages"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "The messages of the linter.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"severity": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The severity of the message: INFO, WARNING or ERROR.",
+				},
+				"path": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The path of the file of the chart the message is about.",
+				},
+				"message": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The message.",
+				},
+			},
+		},
+	}
+
+	return &schema.Resource{
+		ReadContext: dataLintRead,
+		Schema:      s,
+	}
+}
+
+func dataLintRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	cpo, name, err := chartPathOptions(d, m)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	values, err := getValues(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	path, err := locateChart(d, m, name, cpo)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	l := action.NewLint()
+	l.Strict = d.Get("strict").(bool)
+	l.Namespace = d.Get("namespace").(string)
+	result := l.Run([]string{path}, values)
+
+	diags, messages := lintDiagnostics(result, l.Strict)
+	if err := d.Set("messages", messages); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", cpo.RepoURL, name))
+	return diags
+}
+
+// lintDiagnostics returns the diagnostics of the lint result: the errors,
+// and the warnings unless strict, in which case they are errors. The
+// messages are also returned, to be set as attribute.
+func lintDiagnostics(r *action.LintResult, strict bool) (diag.Diagnostics, []interface{}) {
+	var diags diag.Diagnostics
+	var messages []interface{}
+
+	reported := map[error]bool{}
+	for _, msg := range r.Messages {
+		messages = append(messages, map[string]interface{}{
+			"severity": lintSeverities[msg.Severity],
+			"path":     msg.Path,
+			"message":  msg.Err.Error(),
+		})
+
+		severity := diag.Warning
+		switch {
+		case msg.Severity == support.ErrorSev, msg.Severity == support.WarningSev && strict:
+			severity = diag.Error
+		case msg.Severity != support.WarningSev:
+			continue
+		}
+
+		reported[msg.Err] = true
+		diags = append(diags, diag.Diagnostic{
+			Severity: severity,
+			Summary:  fmt.Sprintf("Chart lint %s: %s", lintSeverities[msg.Severity], msg.Path),
+			Detail:   msg.Err.Error(),
+		})
+	}
+
+	// The charts which can't be linted at all have no messages.
+	for _, err := range r.Errors {
+		if !reported[err] {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "Chart lint failed",
+				Detail:   err.Error(),
+			})
+		}
+	}
+	return diags, messages
+}
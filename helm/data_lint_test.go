@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+func TestLintDiagnostics(t *testing.T) {
+	icon := errors.New("icon is recommended")
+	values := errors.New("values don't meet the specifications of the schema")
+	result := &action.LintResult{
+		Messages: []support.Message{
+			support.NewMessage(support.InfoSev, "Chart.yaml", icon),
+			support.NewMessage(support.WarningSev, "templates/", errors.New("directory not found")),
+			support.NewMessage(support.ErrorSev, "values.yaml", values),
+		},
+		Errors: []error{values, errors.New("unable to open tarball")},
+	}
+
+	tests := []struct {
+		strict   bool
+		expected []diag.Severity
+	}{
+		{false, []diag.Severity{diag.Warning, diag.Error, diag.Error}},
+		{true, []diag.Severity{diag.Error, diag.Error, diag.Error}},
+	}
+
+	for _, tt := range tests {
+		diags, messages := lintDiagnostics(result, tt.strict)
+		if len(messages) != 3 {
+			t.Errorf("strict=%t: expected 3 messages, got %d", tt.strict, len(messages))
+		}
+		if len(diags) != len(tt.expected) {
+			t.Errorf("strict=%t: expected %d diagnostics, got %#v", tt.strict, len(tt.expected), diags)
+			continue
+		}
+		for i, d := range diags {
+			if d.Severity != tt.expected[i] {
+				t.Errorf("strict=%t: unexpected severity of %q", tt.strict, d.Summary)
+			}
+		}
+	}
+}
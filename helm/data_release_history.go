@@ -0,0 +1,154 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+func dataReleaseHistory() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataReleaseHistoryRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Release name.",
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Namespace of the release.",
+				DefaultFunc: schema.EnvDefaultFunc("HELM_NAMESPACE", "default"),
+			},
+			"storage_namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Namespace the revisions of the release are stored in, if not its namespace. Defaults to the storage_namespace of the provider.",
+			},
+			"max": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      256,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Maximum number of the most recent revisions returned.",
+			},
+			"revisions": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The revisions of the release, oldest first.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"revision": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The revision number.",
+						},
+						"chart": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The name of the chart.",
+						},
+						"version": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The version of the chart.",
+						},
+						"app_version": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The version of the application of the chart.",
+						},
+						"status": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The status of the revision.",
+						},
+						"description": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The description of the revision.",
+						},
+						"first_deployed": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The time the release was first deployed, in RFC 3339.",
+						},
+						"last_deployed": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The time the revision was deployed, in RFC 3339.",
+						},
+						"deleted": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The time the revision was uninstalled, in RFC 3339.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataReleaseHistoryRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+	n := d.Get("namespace").(string)
+	name := d.Get("name").(string)
+
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseRead)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	client := action.NewHistory(actionConfig)
+	client.Max = d.Get("max").(int)
+
+	history, err := client.Run(name)
+	if err != nil {
+		return diag.Errorf("could not get the history of release %s: %s", name, err)
+	}
+
+	if err := d.Set("revisions", flattenReleaseHistory(history, client.Max)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", n, name))
+	return nil
+}
+
+// flattenReleaseHistory returns the max most recent revisions of the
+// release, oldest first.
+func flattenReleaseHistory(history []*release.Release, max int) []interface{} {
+	releaseutil.SortByRevision(history)
+	if len(history) > max {
+		history = history[len(history)-max:]
+	}
+
+	var revisions []interface{}
+	for _, r := range history {
+		revision := map[string]interface{}{
+			"revision": r.Version,
+		}
+		if r.Chart != nil && r.Chart.Metadata != nil {
+			revision["chart"] = r.Chart.Metadata.Name
+			revision["version"] = r.Chart.Metadata.Version
+			revision["app_version"] = r.Chart.Metadata.AppVersion
+		}
+		if r.Info != nil {
+			revision["status"] = r.Info.Status.String()
+			revision["description"] = r.Info.Description
+			revision["first_deployed"] = formatReleaseTime(r.Info.FirstDeployed)
+			revision["last_deployed"] = formatReleaseTime(r.Info.LastDeployed)
+			revision["deleted"] = formatReleaseTime(r.Info.Deleted)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions
+}
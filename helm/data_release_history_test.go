@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestFlattenReleaseHistory(t *testing.T) {
+	c := &chart.Chart{Metadata: &chart.Metadata{Name: "redis", Version: "6.0.1", AppVersion: "6.0"}}
+	history := []*release.Release{
+		{Version: 3, Chart: c, Info: &release.Info{Status: release.StatusDeployed, Description: "Upgrade complete"}},
+		{Version: 1, Chart: c, Info: &release.Info{Status: release.StatusSuperseded, Description: "Install complete"}},
+		{Version: 2, Chart: c, Info: &release.Info{Status: release.StatusSuperseded, Description: "Upgrade complete"}},
+	}
+
+	revisions := flattenReleaseHistory(history, 2)
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	for i, expected := range []int{2, 3} {
+		revision := revisions[i].(map[string]interface{})
+		if revision["revision"] != expected {
+			t.Errorf("expected revision %d at %d, got %v", expected, i, revision["revision"])
+		}
+		if revision["version"] != "6.0.1" {
+			t.Errorf("unexpected chart version %v", revision["version"])
+		}
+	}
+	if status := revisions[1].(map[string]interface{})["status"]; status != "deployed" {
+		t.Errorf("expected the last revision to be deployed, got %v", status)
+	}
+}
@@ -0,0 +1,70 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// descriptionCommitEnvVars are the environment variables holding the commit
+// of the configuration in the common CI systems.
+var descriptionCommitEnvVars = []string{
+	"GIT_COMMIT",
+	"GITHUB_SHA",
+	"CI_COMMIT_SHA",
+	"BUILD_SOURCEVERSION",
+	"CIRCLE_SHA1",
+}
+
+// descriptionData is the data of the description templates.
+type descriptionData struct {
+	Action    string
+	Name      string
+	Namespace string
+	Chart     string
+	Version   string
+	Workspace string
+	Commit    string
+}
+
+// releaseDescription returns the description of the revision created by the
+// action, rendering the description attribute as a Go template.
+func releaseDescription(d resourceGetter, action string) (string, error) {
+	text := d.Get("description").(string)
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("description").Option("missingkey=error").Funcs(template.FuncMap{
+		"env": os.Getenv,
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the description template: %v", err)
+	}
+
+	data := descriptionData{
+		Action:    action,
+		Name:      d.Get("name").(string),
+		Namespace: d.Get("namespace").(string),
+		Chart:     d.Get("chart").(string),
+		Version:   d.Get("version").(string),
+		Workspace: os.Getenv("TF_WORKSPACE"),
+	}
+	if data.Workspace == "" {
+		data.Workspace = "default"
+	}
+	for _, env := range descriptionCommitEnvVars {
+		if v := os.Getenv(env); v != "" {
+			data.Commit = v
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render the description template: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,51 @@
+package helm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestReleaseDescription(t *testing.T) {
+	os.Setenv("TF_WORKSPACE", "staging")
+	os.Setenv("GIT_COMMIT", "abc123")
+	defer os.Unsetenv("TF_WORKSPACE")
+	defer os.Unsetenv("GIT_COMMIT")
+
+	tests := []struct {
+		description string
+		want        string
+		wantErr     bool
+	}{
+		{"Deployed by CI", "Deployed by CI", false},
+		{"{{ .Action }} of {{ .Chart }} {{ .Version }} from {{ .Workspace }}@{{ .Commit }}", "upgrade of nginx 1.2.3 from staging@abc123", false},
+		{`{{ env "GIT_COMMIT" }}`, "abc123", false},
+		{"{{ .Unknown }}", "", true},
+		{"{{ .Action ", "", true},
+	}
+
+	for _, tt := range tests {
+		d := schema.TestResourceDataRaw(t, resourceRelease().Schema, map[string]interface{}{
+			"name":        "test",
+			"chart":       "nginx",
+			"version":     "1.2.3",
+			"description": tt.description,
+		})
+
+		got, err := releaseDescription(d, "upgrade")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.description, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.description, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/kube"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxFailureEvents is the maximum number of events reported on failures.
+const maxFailureEvents = 20
+
+// eventsError is a failure of the release along with the recent warning
+// events of its resources, which usually tell why they are not ready.
+type eventsError struct {
+	err    error
+	events []string
+}
+
+func (e *eventsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *eventsError) Unwrap() error {
+	return e.err
+}
+
+// withReleaseEvents attaches the recent warning events of the resources to
+// the error. Failing to get the events doesn't hide the error.
+func withReleaseEvents(clientset func() (kubernetes.Interface, error), resources kube.ResourceList, err error) error {
+	if err == nil || clientset == nil {
+		return err
+	}
+
+	cs, cerr := clientset()
+	if cerr != nil {
+		debug("Unable to get the events of the release: %s", cerr)
+		return err
+	}
+
+	events, eerr := releaseEvents(cs, resources)
+	if eerr != nil {
+		debug("Unable to get the events of the release: %s", eerr)
+		return err
+	}
+	if len(events) == 0 {
+		return err
+	}
+	return &eventsError{err: err, events: events}
+}
+
+// releaseEvents returns the recent warning events of the resources, and of
+// the pods of the workloads among them, most recent last.
+func releaseEvents(clientset kubernetes.Interface, resources kube.ResourceList) ([]string, error) {
+	ctx := context.Background()
+
+	objects := map[string]bool{}
+	namespaces := map[string]bool{}
+	for _, info := range resources {
+		objects[info.Mapping.GroupVersionKind.Kind+"/"+info.Name] = true
+		if info.Namespace == "" {
+			continue
+		}
+		namespaces[info.Namespace] = true
+
+		selector, ok := workloadSelector(info.Mapping.GroupVersionKind.Kind, info.Object)
+		if !ok {
+			continue
+		}
+		pods, err := clientset.CoreV1().Pods(info.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the pods of %s", info.Name)
+		}
+		for _, pod := range pods.Items {
+			objects["Pod/"+pod.Name] = true
+		}
+	}
+
+	var events []v1.Event
+	for ns := range namespaces {
+		list, err := clientset.CoreV1().Events(ns).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("type", v1.EventTypeWarning).String(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the events of namespace %s", ns)
+		}
+		for _, e := range list.Items {
+			if objects[e.InvolvedObject.Kind+"/"+e.InvolvedObject.Name] {
+				events = append(events, e)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	if len(events) > maxFailureEvents {
+		events = events[len(events)-maxFailureEvents:]
+	}
+
+	var messages []string
+	for _, e := range events {
+		messages = append(messages, formatEvent(e))
+	}
+	return messages, nil
+}
+
+// workloadSelector returns the label selector of the pods of the workload,
+// if the object is one.
+func workloadSelector(kind string, obj runtime.Object) (string, bool) {
+	if obj == nil {
+		return "", false
+	}
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+	default:
+		return "", false
+	}
+
+	content, err := unstructuredContent(obj)
+	if err != nil {
+		return "", false
+	}
+	raw, found, _ := unstructured.NestedMap(content, "spec", "selector")
+	if !found {
+		return "", false
+	}
+
+	var ls metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &ls); err != nil {
+		return "", false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil || selector.Empty() {
+		return "", false
+	}
+	return selector.String(), true
+}
+
+// eventTime returns the last time the event occurred.
+func eventTime(e v1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
+
+func formatEvent(e v1.Event) string {
+	s := fmt.Sprintf("%s/%s: %s", e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Reason)
+	if e.Count > 1 {
+		s += fmt.Sprintf(" (x%d)", e.Count)
+	}
+	return s + ": " + strings.TrimSpace(e.Message)
+}
+
+// releaseDiagnostics returns the diagnostics of the failure of the release,
+// with the events of its resources and the logs of its hooks as details.
+func releaseDiagnostics(err error) diag.Diagnostics {
+	var details []string
+
+	var eerr *eventsError
+	if errors.As(err, &eerr) {
+		details = append(details, "Recent warning events of the resources of the release:\n\n"+strings.Join(eerr.events, "\n"))
+	}
+	var herr *hookLogsError
+	if errors.As(err, &herr) {
+		details = append(details, herr.logs...)
+	}
+
+	if len(details) == 0 {
+		return diag.FromErr(err)
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  err.Error(),
+		Detail:   strings.Join(details, "\n\n"),
+	}}
+}
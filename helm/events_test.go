@@ -0,0 +1,73 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestWorkloadSelector(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"app": "web"},
+			},
+		},
+	}}
+
+	if s, ok := workloadSelector("Deployment", deployment); !ok || s != "app=web" {
+		t.Errorf("expected the selector app=web, got %q (%t)", s, ok)
+	}
+	if _, ok := workloadSelector("Service", deployment); ok {
+		t.Error("expected no selector for a service")
+	}
+	if _, ok := workloadSelector("Deployment", &unstructured.Unstructured{Object: map[string]interface{}{}}); ok {
+		t.Error("expected no selector for a deployment without selector")
+	}
+}
+
+func TestReleaseDiagnostics(t *testing.T) {
+	event := v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"},
+		Reason:         "Failed",
+		Message:        "Failed to pull image \"web:missing\"",
+		Count:          3,
+	}
+	err := fmt.Errorf("upgrade failed: %w", &eventsError{err: wait.ErrWaitTimeout, events: []string{formatEvent(event)}})
+
+	if !errors.Is(err, wait.ErrWaitTimeout) {
+		t.Error("expected the events error to wrap the timeout")
+	}
+
+	diags := releaseDiagnostics(err)
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diags))
+	}
+	if diags[0].Summary != "upgrade failed: "+wait.ErrWaitTimeout.Error() {
+		t.Errorf("unexpected summary %q", diags[0].Summary)
+	}
+	if !strings.Contains(diags[0].Detail, `Pod/web-0: Failed (x3): Failed to pull image "web:missing"`) {
+		t.Errorf("expected the event in the detail, got %q", diags[0].Detail)
+	}
+}
+
+func TestReleaseDiagnosticsHookLogs(t *testing.T) {
+	logs := "Logs of pod migrate-x2k (container migrate):\nerror: relation \"users\" does not exist"
+	err := &eventsError{
+		err:    &hookLogsError{err: errors.New("job migrate failed"), logs: []string{logs}},
+		events: []string{"Job/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit"},
+	}
+
+	diags := releaseDiagnostics(err)
+	if len(diags) != 1 || diags[0].Summary != "job migrate failed" {
+		t.Fatalf("unexpected diagnostics %#v", diags)
+	}
+	if !strings.Contains(diags[0].Detail, "BackoffLimitExceeded") || !strings.Contains(diags[0].Detail, logs) {
+		t.Errorf("expected the events and the logs in the detail, got %q", diags[0].Detail)
+	}
+}
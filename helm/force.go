@@ -0,0 +1,155 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// The policies forcing the update of the resources through their
+// replacement.
+const (
+	forcePolicyNever      = "never"
+	forcePolicyAlways     = "always"
+	forcePolicyOnConflict = "on_conflict"
+)
+
+// forcePolicy returns the force_policy of the release, force_update forcing
+// the updates always.
+func forcePolicy(d resourceGetter) string {
+	if d.Get("force_update").(bool) {
+		return forcePolicyAlways
+	}
+	return d.Get("force_policy").(string)
+}
+
+var (
+	// patchFailure matches the errors of the resources Helm failed to
+	// patch.
+	patchFailure = regexp.MustCompile(`cannot patch "([^"]+)" with kind (\w+): `)
+	// immutableField matches the immutable fields of the validation errors.
+	immutableField = regexp.MustCompile(`([\w.\[\]-]+): Invalid value: .*?: field is immutable`)
+)
+
+// immutableFields returns the immutable fields of the resources the upgrade
+// failed to change, as "Kind name: field".
+func immutableFields(err error) []string {
+	msg := err.Error()
+	var fields []string
+	matches := patchFailure.FindAllStringSubmatchIndex(msg, -1)
+	for i, match := range matches {
+		end := len(msg)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		resource := fmt.Sprintf("%s %s", msg[match[4]:match[5]], msg[match[2]:match[3]])
+		for _, f := range immutableField.FindAllStringSubmatch(msg[match[1]:end], -1) {
+			fields = append(fields, fmt.Sprintf("%s: %s", resource, f[1]))
+		}
+	}
+	return fields
+}
+
+// immutableFieldsError explains the failure of the upgrade changing
+// immutable fields, which replacing the resources solves.
+func immutableFieldsError(err error) error {
+	fields := immutableFields(err)
+	if len(fields) == 0 {
+		return err
+	}
+	return errors.Wrapf(err, "the upgrade changes immutable fields, set force_policy to %q or %q to replace the resources: \n\t%s\n",
+		forcePolicyOnConflict, forcePolicyAlways, strings.Join(fields, "\n\t"))
+}
+
+// restartedAtAnnotation is the annotation of the pod templates set by
+// kubectl rollout restart.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// workload is a Deployment, StatefulSet or DaemonSet of a release.
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// releaseWorkloads returns the manifests of the workloads of the release.
+func releaseWorkloads(r *release.Release) map[workload]string {
+	workloads := map[workload]string{}
+	for _, manifest := range splitManifest(r.Manifest) {
+		var obj struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil || obj.APIVersion != "apps/v1" {
+			continue
+		}
+		switch obj.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+		default:
+			continue
+		}
+
+		namespace := obj.Metadata.Namespace
+		if namespace == "" {
+			namespace = r.Namespace
+		}
+		workloads[workload{obj.Kind, namespace, obj.Metadata.Name}] = manifest
+	}
+	return workloads
+}
+
+// unchangedWorkloads returns the workloads of the release left unchanged by
+// the upgrade, which don't roll out on their own.
+func unchangedWorkloads(previous, current *release.Release) []workload {
+	before := releaseWorkloads(previous)
+	var unchanged []workload
+	for w, manifest := range releaseWorkloads(current) {
+		if before[w] == manifest {
+			unchanged = append(unchanged, w)
+		}
+	}
+	return unchanged
+}
+
+// restartWorkloads restarts the pods of the workloads, as kubectl rollout
+// restart does, by annotating their pod templates.
+func restartWorkloads(cfg *action.Configuration, workloads []workload) error {
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+	for _, w := range workloads {
+		debug("Restarting %s %s/%s", w.kind, w.namespace, w.name)
+
+		apps := clientset.AppsV1()
+		switch w.kind {
+		case "Deployment":
+			_, err = apps.Deployments(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		case "StatefulSet":
+			_, err = apps.StatefulSets(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		case "DaemonSet":
+			_, err = apps.DaemonSets(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to restart %s %s/%s", w.kind, w.namespace, w.name)
+		}
+	}
+	return nil
+}
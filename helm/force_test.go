@@ -0,0 +1,46 @@
+package helm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestImmutableFields(t *testing.T) {
+	err := errors.New(`cannot patch "test" with kind Deployment: Deployment.apps "test" is invalid: spec.selector: Invalid value: v1.LabelSelector{MatchLabels:map[string]string{"app":"test"}, MatchExpressions:[]v1.LabelSelectorRequirement(nil)}: field is immutable && cannot patch "test-svc" with kind Service: Service "test-svc" is invalid: spec.clusterIP: Invalid value: "": field is immutable`)
+
+	expected := []string{
+		"Deployment test: spec.selector",
+		"Service test-svc: spec.clusterIP",
+	}
+	if got := immutableFields(err); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if got := immutableFields(errors.New(`cannot patch "test" with kind Deployment: the server is currently unable to handle the request`)); len(got) != 0 {
+		t.Errorf("expected no immutable fields, got %q", got)
+	}
+}
+
+func TestUnchangedWorkloads(t *testing.T) {
+	deployment := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"
+	previous := &release.Release{
+		Namespace: "default",
+		Manifest: "---\n# Source: test/templates/web.yaml\n" + deployment + "spec:\n  replicas: 1\n" +
+			"---\n# Source: test/templates/worker.yaml\napiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: worker\n  namespace: jobs\n" +
+			"---\n# Source: test/templates/config.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  a: b\n",
+	}
+	current := &release.Release{
+		Namespace: "default",
+		Manifest: "---\n# Source: test/templates/web.yaml\n" + deployment + "spec:\n  replicas: 2\n" +
+			"---\n# Source: test/templates/worker.yaml\napiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: worker\n  namespace: jobs\n" +
+			"---\n# Source: test/templates/config.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  a: c\n",
+	}
+
+	expected := []workload{{"StatefulSet", "jobs", "worker"}}
+	if got := unchangedWorkloads(previous, current); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,568 @@
+package helm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// RepositoryProxy is the proxy configuration used to reach chart
+// repositories, independently of the Kubernetes API server.
+type RepositoryProxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+}
+
+// ProxyFunc returns the function selecting the proxy for a request, falling
+// back to the environment when no proxy is configured for the scheme.
+func (p *RepositoryProxy) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	var httpProxy, httpsProxy *url.URL
+	for _, v := range []struct {
+		raw string
+		u   **url.URL
+	}{{p.HTTPProxy, &httpProxy}, {p.HTTPSProxy, &httpsProxy}} {
+		if v.raw == "" {
+			continue
+		}
+		u, err := url.Parse(v.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", v.raw, err)
+		}
+		*v.u = u
+	}
+
+	noProxy := strings.Split(p.NoProxy, ",")
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy := httpProxy
+		if req.URL.Scheme == "https" {
+			proxy = httpsProxy
+		}
+		if proxy == nil {
+			return http.ProxyFromEnvironment(req)
+		}
+		if matchNoProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+// matchNoProxy reports whether the host matches any of the NO_PROXY
+// patterns: "*", a host name, or a domain suffix like ".example.com".
+func matchNoProxy(hostport string, patterns []string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if p == "*" {
+			return true
+		}
+		if _, ipnet, err := net.ParseCIDR(p); err == nil {
+			if ip := net.ParseIP(host); ip != nil && ipnet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(p); err == nil {
+			p = h
+		}
+		if host == strings.TrimPrefix(p, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(p, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepositoryTLS is the TLS configuration of the chart repositories or OCI
+// registries whose URL starts with URL. The certificates may be given as
+// files or inline as PEM.
+type RepositoryTLS struct {
+	URL               string
+	CertFile          string
+	KeyFile           string
+	CAFile            string
+	ClientCertificate string
+	ClientKey         string
+	CACertificate     string
+}
+
+func (r *RepositoryTLS) tlsOptions() tlsOptions {
+	return tlsOptions{
+		certFile: r.CertFile,
+		keyFile:  r.KeyFile,
+		caFile:   r.CAFile,
+		certPEM:  r.ClientCertificate,
+		keyPEM:   r.ClientKey,
+		caPEM:    r.CACertificate,
+	}
+}
+
+// findRepositoryTLS returns the TLS configuration of the longest URL prefix
+// matching href, if any.
+func findRepositoryTLS(entries []RepositoryTLS, href string) *RepositoryTLS {
+	var found *RepositoryTLS
+	for i := range entries {
+		prefix := strings.TrimSuffix(entries[i].URL, "/")
+		if href != prefix && !strings.HasPrefix(href, prefix+"/") {
+			continue
+		}
+		if found == nil || len(entries[i].URL) > len(found.URL) {
+			found = &entries[i]
+		}
+	}
+	return found
+}
+
+// tlsOptions are the client TLS settings of a repository.
+type tlsOptions struct {
+	certFile           string
+	keyFile            string
+	caFile             string
+	certPEM            string
+	keyPEM             string
+	caPEM              string
+	insecureSkipVerify bool
+}
+
+// hasCertificates reports whether a client certificate or a CA is set.
+func (o tlsOptions) hasCertificates() bool {
+	return o.certFile != "" || o.keyFile != "" || o.caFile != "" ||
+		o.certPEM != "" || o.keyPEM != "" || o.caPEM != ""
+}
+
+// releaseTLSOptions returns the TLS settings of the repository of a release.
+func releaseTLSOptions(d resourceGetter, cpo *action.ChartPathOptions) tlsOptions {
+	return tlsOptions{
+		certFile:           cpo.CertFile,
+		keyFile:            cpo.KeyFile,
+		caFile:             cpo.CaFile,
+		certPEM:            d.Get("repository_client_certificate").(string),
+		keyPEM:             d.Get("repository_client_key").(string),
+		caPEM:              d.Get("repository_ca_certificate").(string),
+		insecureSkipVerify: cpo.InsecureSkipTLSverify,
+	}
+}
+
+// resolveTLSOptions returns the TLS settings used to reach href. The
+// settings of the release take precedence over the `repository_tls` blocks
+// of the provider.
+func resolveTLSOptions(entries []RepositoryTLS, opts tlsOptions, href string) tlsOptions {
+	if opts.hasCertificates() {
+		return opts
+	}
+	if entry := findRepositoryTLS(entries, href); entry != nil {
+		resolved := entry.tlsOptions()
+		resolved.insecureSkipVerify = opts.insecureSkipVerify
+		return resolved
+	}
+	return opts
+}
+
+// httpAuth are the credentials sent to the chart repositories, besides the
+// basic authentication.
+type httpAuth struct {
+	// token is the bearer token authenticating against the repository.
+	token string
+	// headers are the headers sent along with the requests, e.g. to
+	// download the release assets of GitHub or GitLab.
+	headers map[string]string
+}
+
+func (a httpAuth) isZero() bool {
+	return a.token == "" && len(a.headers) == 0
+}
+
+// httpGetterOptions are the settings used by httpGetter. Unlike the options
+// of the Helm getters, they can be read back, so they are built from the
+// chart path options of the release.
+type httpGetterOptions struct {
+	username         string
+	password         string
+	auth             httpAuth
+	netrc            *Netrc
+	tls              tlsOptions
+	proxy            func(*http.Request) (*url.URL, error)
+	repositoryConfig string
+	repositoryTLS    []RepositoryTLS
+}
+
+// httpGetter is an HTTP(S) getter for chart repositories supporting the
+// provider specific settings not available in the Helm HTTP getter.
+//
+// The options passed by Helm to Get are opaque, so the credentials of the
+// repositories added with `helm repo add` are looked up again from the
+// repository config file.
+type httpGetter struct {
+	opts httpGetterOptions
+}
+
+// Get implements getter.Getter
+func (g *httpGetter) Get(href string, _ ...getter.Option) (*bytes.Buffer, error) {
+	opts := g.opts
+	opts.tls = resolveTLSOptions(opts.repositoryTLS, opts.tls, href)
+	if entry := findRepositoryEntry(opts.repositoryConfig, href); entry != nil {
+		if opts.username == "" && opts.password == "" {
+			opts.username, opts.password = entry.Username, entry.Password
+		}
+		if !opts.tls.hasCertificates() {
+			opts.tls.certFile, opts.tls.keyFile, opts.tls.caFile = entry.CertFile, entry.KeyFile, entry.CAFile
+		}
+	}
+
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.username == "" && opts.password == "" && opts.auth.token == "" {
+		if login, password, ok := opts.netrc.credentials(req.URL.Host); ok {
+			opts.username, opts.password = login, password
+		}
+	}
+	req.Header.Set("User-Agent", "terraform-provider-helm")
+
+	if opts.auth.token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.auth.token)
+	} else if opts.username != "" && opts.password != "" {
+		req.SetBasicAuth(opts.username, opts.password)
+	}
+	for k, v := range opts.auth.headers {
+		req.Header.Set(k, v)
+	}
+
+	tlsConfig, err := newTLSConfig(opts.tls)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create TLS config for client")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DisableCompression: true,
+			Proxy:              opts.proxy,
+			TLSClientConfig:    tlsConfig,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch %s : %s", href, resp.Status)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
+
+// isChartURL reports whether the chart is the URL of its archive.
+func isChartURL(name string) bool {
+	u, err := url.ParseRequestURI(name)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// verifyChartSHA256 checks the SHA256 digest of the archive of the chart, if
+// one is expected.
+func verifyChartSHA256(path, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(strings.TrimPrefix(expected, "sha256:"), digest) {
+		return errors.Errorf("the SHA256 digest of chart %s is %s, not %s", filepath.Base(path), digest, expected)
+	}
+	return nil
+}
+
+// sameHost reports whether both URLs have the same scheme, host and port.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+// findRepositoryEntry returns the repository of the repository config file
+// serving the given URL, if any.
+func findRepositoryEntry(repositoryConfig, href string) *repo.Entry {
+	if repositoryConfig == "" {
+		return nil
+	}
+
+	f, err := repo.LoadFile(repositoryConfig)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range f.Repositories {
+		if entry.URL != "" && strings.HasPrefix(href, strings.TrimSuffix(entry.URL, "/")+"/") {
+			return entry
+		}
+	}
+	return nil
+}
+
+// findChartRepository returns the URL of the first repository of the
+// repository config file whose cached index has the version of the chart,
+// if any.
+func findChartRepository(m *Meta, chartName, version string) string {
+	f, err := repo.LoadFile(m.Settings.RepositoryConfig)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range f.Repositories {
+		idx, err := repo.LoadIndexFile(filepath.Join(m.Settings.RepositoryCache, helmpath.CacheIndexFile(entry.Name)))
+		if err != nil {
+			continue
+		}
+		if _, err := idx.Get(chartName, version); err == nil {
+			return entry.URL
+		}
+	}
+	return ""
+}
+
+func newTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: opts.insecureSkipVerify,
+	}
+
+	certPEM, keyPEM := []byte(opts.certPEM), []byte(opts.keyPEM)
+	if opts.certFile != "" && len(certPEM) == 0 {
+		b, err := ioutil.ReadFile(opts.certFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read cert file: %q", opts.certFile)
+		}
+		certPEM = b
+	}
+	if opts.keyFile != "" && len(keyPEM) == 0 {
+		b, err := ioutil.ReadFile(opts.keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read key file: %q", opts.keyFile)
+		}
+		keyPEM = b
+	}
+
+	if len(certPEM) != 0 || len(keyPEM) != 0 {
+		if len(certPEM) == 0 || len(keyPEM) == 0 {
+			return nil, errors.New("both a client certificate and a client key are required")
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load x509 key pair")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	caPEM := []byte(opts.caPEM)
+	if opts.caFile != "" && len(caPEM) == 0 {
+		b, err := ioutil.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read CA file: %q", opts.caFile)
+		}
+		caPEM = b
+	}
+	if len(caPEM) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("failed to append CA certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// getters returns the getters used to download the charts of a release. The
+// Helm getters are used unless provider specific settings are needed.
+func (m *Meta) getters(cpo *action.ChartPathOptions, tlsOpts tlsOptions, auth httpAuth) (getter.Providers, error) {
+	providers := getter.All(m.Settings)
+	if m.RepositoryProxy == nil && len(m.RepositoryTLS) == 0 && m.Netrc == nil && auth.isZero() &&
+		tlsOpts.certPEM == "" && tlsOpts.keyPEM == "" && tlsOpts.caPEM == "" {
+		return providers, nil
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if m.RepositoryProxy != nil {
+		var err error
+		proxy, err = m.RepositoryProxy.ProxyFunc()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := httpGetterOptions{
+		username:         cpo.Username,
+		password:         cpo.Password,
+		auth:             auth,
+		tls:              tlsOpts,
+		proxy:            proxy,
+		repositoryConfig: m.Settings.RepositoryConfig,
+		repositoryTLS:    m.RepositoryTLS,
+		netrc:            m.Netrc,
+	}
+
+	// ByScheme picks the first provider supporting the scheme.
+	return append(getter.Providers{{
+		Schemes: []string{"http", "https"},
+		New: func(_ ...getter.Option) (getter.Getter, error) {
+			return &httpGetter{opts: opts}, nil
+		},
+	}}, providers...), nil
+}
+
+// downloadOptions are the options of the chart downloads of a release.
+type downloadOptions struct {
+	tls        tlsOptions
+	skipUpdate bool
+	auth       httpAuth
+	// sha256 is the digest the archive of a chart URL must have.
+	sha256 string
+	// passCredentials sends the credentials of the repository to the other
+	// hosts its index links the charts to.
+	passCredentials bool
+}
+
+// downloadChart downloads the chart into the repository cache and returns
+// its path, as action.ChartPathOptions.LocateChart does but using the
+// provider getters.
+func downloadChart(m *Meta, name string, cpo *action.ChartPathOptions, opts downloadOptions) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, ".") {
+		return name, errors.Errorf("path %q not found", name)
+	}
+
+	version := strings.TrimSpace(cpo.Version)
+
+	getters, err := m.getters(cpo, opts.tls, opts.auth)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the charts whose version is known before downloading them are
+	// cached: those of the repositories set by URL, and the chart URLs.
+	var cacheKey string
+	if cpo.RepoURL != "" {
+		chartURL, digest, err := findChartInRepoURL(m, cpo, name, version, getters, opts.skipUpdate)
+		if err != nil {
+			return "", err
+		}
+		cacheKey = chartCacheKey(chartURL, digest)
+		name = chartURL
+
+		// Like Helm 3.6, the credentials are only sent to the host of the
+		// repository unless told otherwise.
+		if !opts.passCredentials && !sameHost(chartURL, cpo.RepoURL) {
+			debug("Not passing the credentials of %s to %s", cpo.RepoURL, chartURL)
+			anonymous := *cpo
+			anonymous.Username, anonymous.Password = "", ""
+			cpo = &anonymous
+			if getters, err = m.getters(cpo, opts.tls, httpAuth{}); err != nil {
+				return "", err
+			}
+		}
+	} else if u, err := url.ParseRequestURI(name); err == nil && u.Host != "" {
+		cacheKey = chartCacheKey(name, version)
+	}
+
+	dl := downloader.ChartDownloader{
+		Out:     os.Stdout,
+		Keyring: cpo.Keyring,
+		Getters: getters,
+		Options: []getter.Option{
+			getter.WithBasicAuth(cpo.Username, cpo.Password),
+			getter.WithTLSClientConfig(cpo.CertFile, cpo.KeyFile, cpo.CaFile),
+			getter.WithInsecureSkipVerifyTLS(cpo.InsecureSkipTLSverify),
+		},
+		RepositoryConfig: m.Settings.RepositoryConfig,
+		RepositoryCache:  m.Settings.RepositoryCache,
+	}
+	if cpo.Verify {
+		dl.Verify = downloader.VerifyAlways
+	}
+
+	// The provenance files aren't cached, the verified charts are always
+	// downloaded.
+	cache := m.ChartCache
+	if cache == nil || cpo.Verify {
+		cacheKey = ""
+	}
+	if cacheKey != "" {
+		if path, ok := cache.get(cacheKey); ok {
+			return path, verifyChartSHA256(path, opts.sha256)
+		}
+	}
+
+	if err := os.MkdirAll(m.Settings.RepositoryCache, 0755); err != nil {
+		return "", err
+	}
+
+	filename, _, err := dl.DownloadTo(name, version, m.Settings.RepositoryCache)
+	if err != nil {
+		if m.Settings.Debug {
+			return filename, err
+		}
+		if isTransientError(err) {
+			return filename, errors.Wrapf(err, "failed to download %q", name)
+		}
+		return filename, errors.Errorf("failed to download %q (hint: running `helm repo update` may help)", name)
+	}
+
+	if err := verifyChartSHA256(filename, opts.sha256); err != nil {
+		os.Remove(filename)
+		return "", err
+	}
+
+	if cacheKey != "" {
+		if _, err := cache.put(cacheKey, filename); err != nil {
+			debug("Unable to cache the chart %s: %s", filename, err)
+		}
+	}
+
+	return filepath.Abs(filename)
+}
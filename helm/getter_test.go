@@ -0,0 +1,331 @@
+package helm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+func TestMatchNoProxy(t *testing.T) {
+	patterns := []string{"localhost", ".example.com", "10.0.0.0/8", "charts.internal:8080"}
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"localhost:8080", true},
+		{"example.com", true},
+		{"charts.example.com", true},
+		{"example.org", false},
+		{"10.1.2.3:443", true},
+		{"192.168.0.1", false},
+		{"charts.internal", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchNoProxy(tt.host, patterns); got != tt.expected {
+			t.Errorf("matchNoProxy(%q): expected %t, got %t", tt.host, tt.expected, got)
+		}
+	}
+
+	if !matchNoProxy("anything", []string{"*"}) {
+		t.Errorf("expected * to match any host")
+	}
+}
+
+func TestHTTPGetterProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("index"))
+	}))
+	defer proxy.Close()
+
+	p := &RepositoryProxy{HTTPProxy: proxy.URL, NoProxy: "noproxy.example.com"}
+	proxyFunc, err := p.ProxyFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &httpGetter{opts: httpGetterOptions{proxy: proxyFunc}}
+	buf, err := g.Get("http://charts.example.com/index.yaml")
+	if err != nil {
+		t.Fatalf("error getting index: %v", err)
+	}
+
+	if proxied != "http://charts.example.com/index.yaml" {
+		t.Fatalf("expected request to go through the proxy, got %q", proxied)
+	}
+	if buf.String() != "index" {
+		t.Fatalf("unexpected response %q", buf.String())
+	}
+
+	req, _ := http.NewRequest("GET", "http://noproxy.example.com/index.yaml", nil)
+	u, err := proxyFunc(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != nil {
+		t.Fatalf("expected no proxy for %q, got %q", req.URL, u)
+	}
+}
+
+func TestHTTPGetterAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + " " + r.Header.Get("Accept")))
+	}))
+	defer server.Close()
+
+	g := &httpGetter{opts: httpGetterOptions{username: "user", password: "secret", auth: httpAuth{token: "abc"}}}
+	buf, err := g.Get(server.URL + "/index.yaml")
+	if err != nil {
+		t.Fatalf("error getting index: %v", err)
+	}
+	if buf.String() != "Bearer abc " {
+		t.Fatalf("expected the bearer token to be sent, got %q", buf.String())
+	}
+
+	g = &httpGetter{opts: httpGetterOptions{auth: httpAuth{headers: map[string]string{
+		"Authorization": "token ghp_abc",
+		"Accept":        "application/octet-stream",
+	}}}}
+	buf, err = g.Get(server.URL + "/repos/example/charts/releases/assets/1")
+	if err != nil {
+		t.Fatalf("error getting asset: %v", err)
+	}
+	if buf.String() != "token ghp_abc application/octet-stream" {
+		t.Fatalf("expected the headers to be sent, got %q", buf.String())
+	}
+}
+
+func TestFindRepositoryTLS(t *testing.T) {
+	entries := []RepositoryTLS{
+		{URL: "https://charts.example.com", CertFile: "a"},
+		{URL: "https://charts.example.com/private/", CertFile: "b"},
+	}
+
+	tests := []struct {
+		href     string
+		expected string
+	}{
+		{"https://charts.example.com/index.yaml", "a"},
+		{"https://charts.example.com/private/index.yaml", "b"},
+		{"https://charts.example.com.evil/index.yaml", ""},
+		{"oci://charts.example.com/private", ""},
+	}
+
+	for _, tt := range tests {
+		var got string
+		if entry := findRepositoryTLS(entries, tt.href); entry != nil {
+			got = entry.CertFile
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.href, tt.expected, got)
+		}
+	}
+}
+
+func TestHTTPGetterClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certPEM, keyPEM := generateClientCertificate(t, "terraform")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	g := &httpGetter{opts: httpGetterOptions{
+		repositoryTLS: []RepositoryTLS{{
+			URL:               server.URL,
+			ClientCertificate: string(certPEM),
+			ClientKey:         string(keyPEM),
+			CACertificate:     string(caPEM),
+		}},
+	}}
+	buf, err := g.Get(server.URL + "/index.yaml")
+	if err != nil {
+		t.Fatalf("error getting index: %v", err)
+	}
+	if buf.String() != "terraform" {
+		t.Fatalf("expected the client certificate to be sent, got %q", buf.String())
+	}
+
+	g = &httpGetter{opts: httpGetterOptions{tls: tlsOptions{caPEM: string(caPEM)}}}
+	if _, err := g.Get(server.URL + "/index.yaml"); err == nil {
+		t.Fatal("expected an error without client certificate")
+	}
+}
+
+func generateClientCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestFindChartRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repositories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"repositories.yaml": `apiVersion: v1
+repositories:
+- name: stable
+  url: https://charts.example.com/stable
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+`,
+		"stable-index.yaml": `apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 5.0.0
+`,
+		"bitnami-index.yaml": `apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 6.0.1
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Meta{Settings: cli.New()}
+	m.Settings.RepositoryConfig = filepath.Join(dir, "repositories.yaml")
+	m.Settings.RepositoryCache = dir
+
+	if url := findChartRepository(m, "redis", "6.0.1"); url != "https://charts.bitnami.com/bitnami" {
+		t.Errorf("expected the bitnami repository, got %q", url)
+	}
+	if url := findChartRepository(m, "redis", "7.0.0"); url != "" {
+		t.Errorf("expected no repository, got %q", url)
+	}
+}
+
+func TestDownloadChartPassCredentials(t *testing.T) {
+	var authorized bool
+	charts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, authorized = r.BasicAuth()
+		w.Write([]byte("chart"))
+	}))
+	defer charts.Close()
+
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 6.0.1
+    urls:
+    - ` + charts.URL + `/redis-6.0.1.tgz
+`))
+	}))
+	defer repository.Close()
+
+	cache, err := ioutil.TempDir("", "repository-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	m := &Meta{Settings: settings}
+	cpo := &action.ChartPathOptions{RepoURL: repository.URL, Username: "user", Password: "secret", Version: "6.0.1"}
+
+	for _, pass := range []bool{false, true} {
+		if _, err := downloadChart(m, "redis", cpo, downloadOptions{passCredentials: pass}); err != nil {
+			t.Fatal(err)
+		}
+		if authorized != pass {
+			t.Errorf("pass credentials %t: expected the credentials to be sent to the chart host to be %t", pass, pass)
+		}
+	}
+}
+
+func TestDownloadChartSHA256(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chart"))
+	}))
+	defer server.Close()
+
+	cache, err := ioutil.TempDir("", "repository-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	m := &Meta{Settings: settings}
+	chartURL := server.URL + "/redis-6.0.1.tgz"
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte("chart")))
+
+	tests := []struct {
+		sha256 string
+		err    string
+	}{
+		{"", ""},
+		{strings.Repeat("0", 64), "the SHA256 digest of chart redis-6.0.1.tgz is " + digest},
+		{digest, ""},
+		{"sha256:" + strings.ToUpper(digest), ""},
+	}
+	for _, tt := range tests {
+		_, err := downloadChart(m, chartURL, &action.ChartPathOptions{}, downloadOptions{sha256: tt.sha256})
+		if tt.err == "" && err != nil {
+			t.Errorf("%q: unexpected error %s", tt.sha256, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%q: expected the error %q, got %v", tt.sha256, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// hookAnnotation is the annotation of the hooks listing their events.
+const hookAnnotation = "helm.sh/hook"
+
+// hookEvents are the events of the hooks which can be skipped.
+var hookEvents = []string{
+	string(release.HookPreInstall),
+	string(release.HookPostInstall),
+	string(release.HookPreUpgrade),
+	string(release.HookPostUpgrade),
+	string(release.HookPreDelete),
+	string(release.HookPostDelete),
+	string(release.HookPreRollback),
+	string(release.HookPostRollback),
+}
+
+// hooksDisabled reports whether the hooks of the release must not run.
+// disable_webhooks predates disable_hooks, and doesn't apply to uninstall.
+func hooksDisabled(d resourceGetter, operation string) bool {
+	if d.Get("disable_hooks").(bool) {
+		return true
+	}
+	return operation != "delete" && d.Get("disable_webhooks").(bool)
+}
+
+const (
+	hookDeleteKeep       = "keep"
+	hookDeleteKeepFailed = "keep-failed"
+	hookDeleteAlways     = "delete"
+)
+
+// hookDeletePolicies are the overrides of the hook-delete-policy of the
+// hooks of the chart.
+var hookDeletePolicies = []string{
+	hookDeleteKeep,
+	hookDeleteKeepFailed,
+	hookDeleteAlways,
+}
+
+// hookKubeClient skips the hooks of some events, and overrides the deletion
+// policies of the hooks. Helm doesn't tell which event the hooks are run
+// for: the operation is known, and the hooks are run for the post- event
+// once the resources of the release are applied. Likewise, the deletions
+// of a hook before it runs are the before-hook-creation ones.
+type hookKubeClient struct {
+	kube.Interface
+	operation    string
+	skip         map[string]bool
+	deletePolicy string
+	applied      bool
+
+	// results are the results of the hooks which ran, by resources.
+	results map[string]error
+}
+
+// newHookKubeClient returns the client skipping the hooks of the release
+// listed in skip_hooks for the operation and applying the
+// hook_delete_policy, or the given client if there is nothing to change.
+func newHookKubeClient(d resourceGetter, client kube.Interface, operation string) kube.Interface {
+	skip := map[string]bool{}
+	for _, e := range d.Get("skip_hooks").(*schema.Set).List() {
+		skip[e.(string)] = true
+	}
+	deletePolicy := d.Get("hook_delete_policy").(string)
+	if !skip["pre-"+operation] && !skip["post-"+operation] && deletePolicy == "" {
+		return client
+	}
+	return &hookKubeClient{
+		Interface:    client,
+		operation:    operation,
+		skip:         skip,
+		deletePolicy: deletePolicy,
+		results:      map[string]error{},
+	}
+}
+
+// event returns the event the hooks are currently run for.
+func (c *hookKubeClient) event() string {
+	if c.applied {
+		return "post-" + c.operation
+	}
+	return "pre-" + c.operation
+}
+
+// skipped reports whether the resources are hooks of a skipped event.
+func (c *hookKubeClient) skipped(resources kube.ResourceList) bool {
+	return c.skip[c.event()] && isHook(resources)
+}
+
+// isHook reports whether the resources are hooks.
+func isHook(resources kube.ResourceList) bool {
+	for _, info := range resources {
+		if accessor, err := meta.Accessor(info.Object); err == nil {
+			if _, ok := accessor.GetAnnotations()[hookAnnotation]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Create implements kube.Interface
+func (c *hookKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	if !isHook(resources) {
+		c.applied = true
+		return c.Interface.Create(resources)
+	}
+	if c.skipped(resources) {
+		debug("Skipping the %s hooks %s", c.event(), resourceNames(resources))
+		return &kube.Result{}, nil
+	}
+
+	// The hooks kept by the previous runs are replaced, whatever their
+	// hook-delete-policy.
+	if c.deletePolicy == hookDeleteKeep || c.deletePolicy == hookDeleteKeepFailed {
+		if _, errs := c.Interface.Delete(resources); len(errs) > 0 {
+			debug("Unable to delete the previous hooks %s: %v", resourceNames(resources), errs)
+		}
+	}
+	return c.Interface.Create(resources)
+}
+
+// Update implements kube.Interface
+func (c *hookKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	c.applied = true
+	return c.Interface.Update(original, target, force)
+}
+
+// Delete implements kube.Interface
+func (c *hookKubeClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	if !isHook(resources) {
+		if c.operation == "delete" {
+			c.applied = true
+		}
+		return c.Interface.Delete(resources)
+	}
+
+	// The hooks are always deleted before they run, Helm can't create them
+	// otherwise.
+	result, ran := c.results[resourceNames(resources)]
+	if ran && (c.deletePolicy == hookDeleteKeep || c.deletePolicy == hookDeleteAlways ||
+		(c.deletePolicy == hookDeleteKeepFailed && result != nil)) {
+		debug("Keeping the hooks %s, as set by hook_delete_policy", resourceNames(resources))
+		return &kube.Result{}, nil
+	}
+	return c.Interface.Delete(resources)
+}
+
+// WatchUntilReady implements kube.Interface
+func (c *hookKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	if c.skipped(resources) {
+		return nil
+	}
+
+	err := c.Interface.WatchUntilReady(resources, timeout)
+	if !isHook(resources) {
+		return err
+	}
+	c.results[resourceNames(resources)] = err
+
+	// Helm only deletes the hooks having a policy, they are deleted here
+	// regardless of it.
+	if c.deletePolicy == hookDeleteAlways {
+		debug("Deleting the hooks %s, as set by hook_delete_policy", resourceNames(resources))
+		if _, errs := c.Interface.Delete(resources); len(errs) > 0 {
+			debug("Unable to delete the hooks %s: %v", resourceNames(resources), errs)
+		}
+	}
+	return err
+}
+
+// resourceNames returns the names of the resources, for logging.
+func resourceNames(resources kube.ResourceList) string {
+	var names []string
+	for _, info := range resources {
+		names = append(names, info.Mapping.GroupVersionKind.Kind+"/"+info.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// hookLogsError is a failure of the hooks of the release along with the
+// logs of their pods, which usually tell why they failed.
+type hookLogsError struct {
+	err  error
+	logs []string
+}
+
+func (e *hookLogsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hookLogsError) Unwrap() error {
+	return e.err
+}
+
+// withHookLogs attaches the last lines of the logs of the pods of the hooks
+// to the error. Failing to get the logs doesn't hide the error.
+func withHookLogs(clientset func() (kubernetes.Interface, error), resources kube.ResourceList, lines int64, err error) error {
+	if err == nil || clientset == nil || lines <= 0 {
+		return err
+	}
+
+	cs, cerr := clientset()
+	if cerr != nil {
+		debug("Unable to get the logs of the hooks: %s", cerr)
+		return err
+	}
+
+	var logs []string
+	for _, info := range resources {
+		l, lerr := hookPodLogs(cs, info, lines)
+		if lerr != nil {
+			debug("Unable to get the logs of hook %s: %s", info.Name, lerr)
+			continue
+		}
+		logs = append(logs, l...)
+	}
+	if len(logs) == 0 {
+		return err
+	}
+	return &hookLogsError{err: err, logs: logs}
+}
+
+// hookPodLogs returns the last lines of the logs of the containers of the
+// hook, a Job or a Pod.
+func hookPodLogs(clientset kubernetes.Interface, info *resource.Info, lines int64) ([]string, error) {
+	ctx := context.Background()
+	pods := clientset.CoreV1().Pods(info.Namespace)
+
+	var items []v1.Pod
+	switch info.Mapping.GroupVersionKind.Kind {
+	case "Job":
+		list, err := pods.List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"job-name": info.Name}).String(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the pods of job %s", info.Name)
+		}
+		items = list.Items
+	case "Pod":
+		pod, err := pods.Get(ctx, info.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		items = []v1.Pod{*pod}
+	default:
+		return nil, nil
+	}
+
+	var logs []string
+	for _, pod := range items {
+		containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, c := range containers {
+			raw, err := pods.GetLogs(pod.Name, &v1.PodLogOptions{Container: c.Name, TailLines: &lines}).DoRaw(ctx)
+			if err != nil {
+				debug("Unable to get the logs of container %s of pod %s: %s", c.Name, pod.Name, err)
+				continue
+			}
+			if out := strings.TrimSpace(string(raw)); out != "" {
+				logs = append(logs, fmt.Sprintf("Logs of pod %s (container %s):\n%s", pod.Name, c.Name, out))
+			}
+		}
+	}
+	return logs, nil
+}
@@ -0,0 +1,105 @@
+package helm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// recordingKubeClient records the resources created, watched and deleted.
+type recordingKubeClient struct {
+	kube.Interface
+	created  []string
+	watched  []string
+	deleted  []string
+	watchErr error
+}
+
+func (c *recordingKubeClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	c.deleted = append(c.deleted, resourceNames(resources))
+	return &kube.Result{}, nil
+}
+
+func (c *recordingKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	c.created = append(c.created, resourceNames(resources))
+	return &kube.Result{}, nil
+}
+
+func (c *recordingKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	return &kube.Result{}, nil
+}
+
+func (c *recordingKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	c.watched = append(c.watched, resourceNames(resources))
+	return c.watchErr
+}
+
+func hookResources(name, hook string) kube.ResourceList {
+	obj := &unstructured.Unstructured{}
+	if hook != "" {
+		obj.SetAnnotations(map[string]string{hookAnnotation: hook})
+	}
+	return kube.ResourceList{{
+		Name:    name,
+		Object:  obj,
+		Mapping: &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Kind: "Job"}},
+	}}
+}
+
+func TestHookKubeClient(t *testing.T) {
+	resources := hookResources
+
+	d := resourceRelease().TestResourceData()
+	d.Set("skip_hooks", []interface{}{"pre-upgrade"})
+
+	inner := &recordingKubeClient{}
+	client := newHookKubeClient(d, inner, "upgrade")
+
+	// Helm runs the pre-upgrade hooks, updates the resources of the
+	// release, then runs the post-upgrade hooks.
+	client.Create(resources("migrate", "pre-install,pre-upgrade"))
+	client.WatchUntilReady(resources("migrate", "pre-install,pre-upgrade"), time.Minute)
+	client.Update(nil, resources("app", ""), false)
+	client.Create(resources("notify", "post-upgrade"))
+	client.WatchUntilReady(resources("notify", "post-upgrade"), time.Minute)
+
+	if len(inner.created) != 1 || inner.created[0] != "Job/notify" {
+		t.Errorf("expected only the post-upgrade hook to be created, got %v", inner.created)
+	}
+	if len(inner.watched) != 1 || inner.watched[0] != "Job/notify" {
+		t.Errorf("expected only the post-upgrade hook to be watched, got %v", inner.watched)
+	}
+
+	if c := newHookKubeClient(d, inner, "install"); c != kube.Interface(inner) {
+		t.Error("expected the client to be unchanged when no install hook is skipped")
+	}
+}
+
+func TestHookKubeClientDeletePolicy(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	d.Set("hook_delete_policy", hookDeleteKeepFailed)
+
+	inner := &recordingKubeClient{watchErr: errors.New("job failed")}
+	client := newHookKubeClient(d, inner, "install")
+
+	// Helm deletes the hook before creating it, and after its failure as
+	// set by hook-delete-policy: hook-failed.
+	hook := hookResources("migrate", "pre-install")
+	client.Delete(hook)
+	client.Create(hook)
+	if err := client.WatchUntilReady(hook, time.Minute); err == nil {
+		t.Fatal("expected the error of the hook")
+	}
+	client.Delete(hook)
+
+	// The hook is only deleted before its creation: by Helm, then by the
+	// client replacing the hooks kept by the previous runs.
+	if len(inner.deleted) != 2 {
+		t.Errorf("expected the failed hook to be kept, got the deletions %v", inner.deleted)
+	}
+}
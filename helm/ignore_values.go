@@ -0,0 +1,94 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// ignoredValuePaths returns the paths of the values set by ignore_value_paths.
+func ignoredValuePaths(d resourceGetter) []string {
+	paths, _ := d.Get("ignore_value_paths").([]interface{})
+	return expandStringSlice(paths)
+}
+
+// suppressIgnoredValues suppresses the diff of a values entry when only the
+// values at the ignored paths change.
+func suppressIgnoredValues(k, old, new string, d *schema.ResourceData) bool {
+	paths := ignoredValuePaths(d)
+	if len(paths) == 0 || strings.HasSuffix(k, ".#") {
+		return false
+	}
+
+	var oldValues, newValues map[string]interface{}
+	if err := yaml.Unmarshal([]byte(old), &oldValues); err != nil {
+		return false
+	}
+	if err := yaml.Unmarshal([]byte(new), &newValues); err != nil {
+		return false
+	}
+	for _, path := range paths {
+		deleteValuePath(oldValues, path)
+		deleteValuePath(newValues, path)
+	}
+	return reflect.DeepEqual(oldValues, newValues)
+}
+
+// lookupValuePath returns the value at the path of the values, the keys of
+// the nested maps being separated by dots.
+func lookupValuePath(values map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	m := values
+	for _, key := range keys[:len(keys)-1] {
+		v, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = v
+	}
+	v, ok := m[keys[len(keys)-1]]
+	return v, ok
+}
+
+// setValuePath sets the value at the path of the values, creating the
+// missing maps.
+func setValuePath(values map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	m := values
+	for _, key := range keys[:len(keys)-1] {
+		v, ok := m[key].(map[string]interface{})
+		if !ok {
+			v = map[string]interface{}{}
+			m[key] = v
+		}
+		m = v
+	}
+	m[keys[len(keys)-1]] = value
+}
+
+// deleteValuePath deletes the value at the path of the values.
+func deleteValuePath(values map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	m := values
+	for _, key := range keys[:len(keys)-1] {
+		v, ok := m[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = v
+	}
+	delete(m, keys[len(keys)-1])
+}
+
+// keepIgnoredValues sets the values at the ignored paths to those of the
+// deployed release, if it has them, so that the values changed outside of
+// Terraform are kept by the upgrade.
+func keepIgnoredValues(values, deployed map[string]interface{}, paths []string) {
+	for _, path := range paths {
+		if v, ok := lookupValuePath(deployed, path); ok {
+			setValuePath(values, path, v)
+		}
+	}
+}
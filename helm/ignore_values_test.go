@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeepIgnoredValues(t *testing.T) {
+	values := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.19"},
+		"replicas": int64(2),
+	}
+	deployed := map[string]interface{}{
+		"image":          map[string]interface{}{"repository": "nginx", "tag": "1.20"},
+		"podAnnotations": map[string]interface{}{"checksum": "abc"},
+	}
+
+	keepIgnoredValues(values, deployed, []string{"image.tag", "podAnnotations.checksum", "replicas"})
+
+	expected := map[string]interface{}{
+		"image":          map[string]interface{}{"repository": "nginx", "tag": "1.20"},
+		"podAnnotations": map[string]interface{}{"checksum": "abc"},
+		"replicas":       int64(2),
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestSuppressIgnoredValues(t *testing.T) {
+	d := resourceRelease().Data(nil)
+	d.Set("ignore_value_paths", []string{"image.tag"})
+
+	tests := []struct {
+		old, new string
+		suppress bool
+	}{
+		{"image:\n  tag: '1.19'\n", "image:\n  tag: '1.20'\n", true},
+		{"image:\n  tag: '1.19'\n", "image:\n  tag: '1.20'\nreplicas: 2\n", false},
+		{"image: {repository: nginx, tag: '1.19'}", "image:\n  repository: nginx\n", true},
+	}
+	for _, tt := range tests {
+		if got := suppressIgnoredValues("values.0", tt.old, tt.new, d); got != tt.suppress {
+			t.Errorf("%q -> %q: expected suppress to be %t", tt.old, tt.new, tt.suppress)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// indexCache caches the parsed indexes of the chart repositories, so that
+// the releases sharing a repository download its index once per provider
+// instance rather than once each.
+type indexCache struct {
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]indexCacheEntry
+}
+
+type indexCacheEntry struct {
+	index   *repo.IndexFile
+	fetched time.Time
+}
+
+func newIndexCache(ttl time.Duration) *indexCache {
+	return &indexCache{ttl: ttl, entries: map[string]indexCacheEntry{}}
+}
+
+// get returns the cached index of the key if it is fresh, or loads it. The
+// indexes are not cached if the TTL is zero.
+func (c *indexCache) get(key string, load func() (*repo.IndexFile, error)) (*repo.IndexFile, error) {
+	if c == nil || c.ttl <= 0 {
+		return load()
+	}
+
+	c.mutex.Lock()
+	e, ok := c.entries[key]
+	c.mutex.Unlock()
+	if ok && time.Since(e.fetched) < c.ttl {
+		debug("Using the cached index of %s", key)
+		return e.index, nil
+	}
+
+	index, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.entries[key] = indexCacheEntry{index: index, fetched: time.Now()}
+	c.mutex.Unlock()
+	return index, nil
+}
+
+// findChartInRepoURL returns the URL and the digest of the chart version in
+// the repository, as repo.FindChartInAuthRepoURL does but with the index
+// cached by the provider. The index downloaded by a previous run is used if skipUpdate is
+// set.
+func findChartInRepoURL(m *Meta, cpo *action.ChartPathOptions, name, version string, getters getter.Providers, skipUpdate bool) (string, string, error) {
+	index, err := m.indexes.get(cpo.RepoURL+" "+cpo.Username, func() (*repo.IndexFile, error) {
+		if skipUpdate {
+			path := filepath.Join(m.Settings.RepositoryCache, helmpath.CacheIndexFile(indexCacheName(m, cpo.RepoURL)))
+			if index, err := repo.LoadIndexFile(path); err == nil {
+				debug("Using the index of %s downloaded into %s", cpo.RepoURL, path)
+				return index, nil
+			}
+		}
+		return downloadIndex(m, cpo, getters)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	errMsg := fmt.Sprintf("chart %q", name)
+	if version != "" {
+		errMsg = fmt.Sprintf("%s version %q", errMsg, version)
+	}
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return "", "", errors.Errorf("%s not found in %s repository", errMsg, cpo.RepoURL)
+	}
+	if len(cv.URLs) == 0 {
+		return "", "", errors.Errorf("%s has no downloadable URLs", errMsg)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(cpo.RepoURL, cv.URLs[0])
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to make chart URL absolute")
+	}
+	return chartURL, cv.Digest, nil
+}
+
+// indexCacheName returns the name the index of the repository is cached
+// under: the name of the repository if it was added with helm repo add, so
+// that its index is refreshed as by helm repo update, or one derived from
+// its URL.
+func indexCacheName(m *Meta, repoURL string) string {
+	if entry := findRepositoryEntry(m.Settings.RepositoryConfig, strings.TrimSuffix(repoURL, "/")+"/index.yaml"); entry != nil && entry.Name != "" {
+		return entry.Name
+	}
+	sum := sha256.Sum256([]byte(repoURL))
+	return "url-" + hex.EncodeToString(sum[:8])
+}
+
+// downloadIndex downloads the index of the repository into the repository
+// cache and parses it.
+func downloadIndex(m *Meta, cpo *action.ChartPathOptions, getters getter.Providers) (*repo.IndexFile, error) {
+	r, err := repo.NewChartRepository(&repo.Entry{
+		Name:     indexCacheName(m, cpo.RepoURL),
+		URL:      cpo.RepoURL,
+		Username: cpo.Username,
+		Password: cpo.Password,
+		CertFile: cpo.CertFile,
+		KeyFile:  cpo.KeyFile,
+		CAFile:   cpo.CaFile,
+
+		InsecureSkipTLSverify: cpo.InsecureSkipTLSverify,
+	}, getters)
+	if err != nil {
+		return nil, err
+	}
+	r.CachePath = m.Settings.RepositoryCache
+
+	path, err := r.DownloadIndexFile()
+	if err != nil {
+		return nil, errors.Wrapf(err, "looks like %q is not a valid chart repository or cannot be reached", cpo.RepoURL)
+	}
+	return repo.LoadIndexFile(path)
+}
+
+// skipRepoUpdate reports whether the indexes of the repositories downloaded
+// by the previous runs are used rather than refreshed.
+func skipRepoUpdate(d resourceGetter, m *Meta) bool {
+	return m.SkipRepoUpdate || d.Get("skip_repo_update").(bool)
+}
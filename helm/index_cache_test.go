@@ -0,0 +1,74 @@
+package helm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+func TestFindChartInRepoURLCachesIndex(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`apiVersion: v1
+entries:
+  redis:
+  - name: redis
+    version: 6.0.1
+    urls:
+    - charts/redis-6.0.1.tgz
+`))
+	}))
+	defer server.Close()
+
+	cache, err := ioutil.TempDir("", "repository-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	getters := getter.All(settings)
+	cpo := &action.ChartPathOptions{RepoURL: server.URL}
+
+	tests := []struct {
+		ttl        time.Duration
+		skipUpdate bool
+		expected   int
+	}{
+		{5 * time.Minute, false, 1},
+		{0, false, 2},
+		{0, true, 0},
+	}
+	for _, tt := range tests {
+		requests = 0
+		m := &Meta{Settings: settings, indexes: newIndexCache(tt.ttl)}
+		for i := 0; i < 2; i++ {
+			url, _, err := findChartInRepoURL(m, cpo, "redis", "6.0.1", getters, tt.skipUpdate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != server.URL+"/charts/redis-6.0.1.tgz" {
+				t.Errorf("unexpected chart URL %q", url)
+			}
+		}
+		if requests != tt.expected {
+			t.Errorf("ttl %s, skip update %t: expected %d index downloads, got %d", tt.ttl, tt.skipUpdate, tt.expected, requests)
+		}
+	}
+
+	m := &Meta{Settings: settings, indexes: newIndexCache(time.Minute)}
+	if _, _, err := findChartInRepoURL(m, cpo, "redis", "7.0.0", getters, false); err == nil {
+		t.Error("expected an error for a missing version")
+	}
+}
@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"k8s.io/client-go/transport"
+)
+
+// tokenSourceWrapper returns a transport wrapper authenticating the requests
+// with the tokens of the given source.
+func tokenSourceWrapper(ts oauth2.TokenSource) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &oauth2.Transport{Source: ts, Base: rt}
+	}
+}
+
+const (
+	eksTokenPrefix     = "k8s-aws-v1."
+	eksClusterIDHeader = "x-k8s-aws-id"
+
+	// EKS tokens are valid for 15 minutes, they are renewed before.
+	eksTokenLifetime = 14 * time.Minute
+)
+
+// eksTokenSource generates the tokens of an EKS cluster, as done by
+// `aws eks get-token`. A token is a presigned STS GetCallerIdentity URL.
+type eksTokenSource struct {
+	clusterName string
+	client      *sts.STS
+}
+
+// newEKSTokenSource returns the token source of the EKS cluster, using the
+// AWS credentials of the environment or of the assumed role.
+func newEKSTokenSource(clusterName, region, roleARN string) (*eksTokenSource, error) {
+	config := aws.Config{
+		STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
+	}
+	if region != "" {
+		config.Region = aws.String(region)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the AWS session: %v", err)
+	}
+
+	var client *sts.STS
+	if roleARN != "" {
+		client = sts.New(sess, &aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+	} else {
+		client = sts.New(sess)
+	}
+
+	return &eksTokenSource{clusterName: clusterName, client: client}, nil
+}
+
+// Token implements oauth2.TokenSource
+func (s *eksTokenSource) Token() (*oauth2.Token, error) {
+	req, _ := s.client.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, s.clusterName)
+
+	// The expiry of the presigned URL is ignored by EKS.
+	presigned, err := req.Presign(60 * time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the EKS token: %v", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned)),
+		Expiry:      time.Now().Add(eksTokenLifetime),
+	}, nil
+}
+
+// gkeDefaultScopes are the scopes of the tokens used by the gke-gcloud-auth-plugin.
+var gkeDefaultScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// newGKETokenSource returns the source of the OAuth2 access tokens used to
+// authenticate against GKE clusters. The Application Default Credentials
+// are used unless service account credentials are given, which covers
+// workload identity and the GCE metadata server.
+func newGKETokenSource(credentials string, scopes []string) (oauth2.TokenSource, error) {
+	if len(scopes) == 0 {
+		scopes = gkeDefaultScopes
+	}
+
+	ctx := context.Background()
+	if credentials != "" {
+		creds, err := google.CredentialsFromJSON(ctx, []byte(credentials), scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the GKE credentials: %v", err)
+		}
+		return creds.TokenSource, nil
+	}
+
+	ts, err := google.DefaultTokenSource(ctx, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the Application Default Credentials: %v", err)
+	}
+	return ts, nil
+}
+
+const (
+	// azureAKSServerID is the application ID of the Azure Kubernetes
+	// Service AAD server, the audience of the tokens of AKS clusters.
+	azureAKSServerID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+	azureActiveDirectoryEndpoint = "https://login.microsoftonline.com/"
+)
+
+// azureOptions are the settings used to obtain the AAD tokens of an AKS
+// cluster.
+type azureOptions struct {
+	tenantID     string
+	clientID     string
+	clientSecret string
+	useMSI       bool
+	serverID     string
+	endpoint     string
+}
+
+// azureGet returns the attribute of the azure block, defaulting to the
+// environment variable used by the azurerm provider. DefaultFunc can't be
+// used since the block may be empty.
+func azureGet(spec map[string]interface{}, key, env string) string {
+	if v, ok := spec[key].(string); ok && v != "" {
+		return v
+	}
+	if env == "" {
+		return ""
+	}
+	return os.Getenv(env)
+}
+
+// azureTokenSource provides the AAD tokens of an AKS cluster, as done by
+// kubelogin.
+type azureTokenSource struct {
+	spt *adal.ServicePrincipalToken
+}
+
+// newAzureTokenSource returns the token source of a service principal, or
+// of the managed identity of the host when useMSI is set.
+func newAzureTokenSource(opts azureOptions) (*azureTokenSource, error) {
+	resource := opts.serverID
+	if resource == "" {
+		resource = azureAKSServerID
+	}
+
+	if opts.useMSI {
+		endpoint, err := adal.GetMSIVMEndpoint()
+		if err != nil {
+			return nil, err
+		}
+
+		var spt *adal.ServicePrincipalToken
+		if opts.clientID != "" {
+			spt, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, resource, opts.clientID)
+		} else {
+			spt, err = adal.NewServicePrincipalTokenFromMSI(endpoint, resource)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the managed identity token: %v", err)
+		}
+		return &azureTokenSource{spt: spt}, nil
+	}
+
+	if opts.tenantID == "" || opts.clientID == "" || opts.clientSecret == "" {
+		return nil, fmt.Errorf("tenant_id, client_id and client_secret are required to authenticate with a service principal")
+	}
+
+	endpoint := opts.endpoint
+	if endpoint == "" {
+		endpoint = azureActiveDirectoryEndpoint
+	}
+	config, err := adal.NewOAuthConfig(endpoint, opts.tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	spt, err := adal.NewServicePrincipalToken(*config, opts.clientID, opts.clientSecret, resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the service principal token: %v", err)
+	}
+	return &azureTokenSource{spt: spt}, nil
+}
+
+// Token implements oauth2.TokenSource
+func (s *azureTokenSource) Token() (*oauth2.Token, error) {
+	if err := s.spt.EnsureFresh(); err != nil {
+		return nil, fmt.Errorf("failed to refresh the AAD token: %v", err)
+	}
+
+	t := s.spt.Token()
+	return &oauth2.Token{
+		AccessToken: t.AccessToken,
+		Expiry:      t.Expires(),
+	}, nil
+}
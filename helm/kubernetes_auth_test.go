@@ -0,0 +1,108 @@
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestEKSTokenSource(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	ts := &eksTokenSource{clusterName: "test", client: sts.New(sess)}
+
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token.AccessToken, eksTokenPrefix) {
+		t.Fatalf("expected the token to start with %q, got %q", eksTokenPrefix, token.AccessToken)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token.AccessToken, eksTokenPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	if q.Get("Action") != "GetCallerIdentity" {
+		t.Errorf("expected a GetCallerIdentity URL, got %q", u)
+	}
+	if !strings.Contains(q.Get("X-Amz-SignedHeaders"), eksClusterIDHeader) {
+		t.Errorf("expected the %s header to be signed, got %q", eksClusterIDHeader, q.Get("X-Amz-SignedHeaders"))
+	}
+}
+
+func TestGKETokenSourceCredentials(t *testing.T) {
+	if _, err := newGKETokenSource("not json", nil); err == nil {
+		t.Fatal("expected an error for invalid credentials")
+	}
+
+	credentials := `{
+  "type": "service_account",
+  "client_email": "deployer@example.iam.gserviceaccount.com",
+  "private_key_id": "1",
+  "private_key": "",
+  "token_uri": "https://oauth2.googleapis.com/token"
+}`
+	ts, err := newGKETokenSource(credentials, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts == nil {
+		t.Fatal("expected a token source")
+	}
+}
+
+func TestAzureTokenSource(t *testing.T) {
+	if _, err := newAzureTokenSource(azureOptions{tenantID: "tenant", clientID: "client"}); err == nil {
+		t.Fatal("expected an error without client secret")
+	}
+
+	var resource string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		resource = r.PostForm.Get("resource")
+		fmt.Fprintf(w, `{"access_token": "aad-token", "token_type": "Bearer", "expires_in": "3600", "expires_on": "%d", "resource": "%s"}`,
+			time.Now().Add(time.Hour).Unix(), resource)
+	}))
+	defer server.Close()
+
+	ts, err := newAzureTokenSource(azureOptions{
+		tenantID:     "tenant",
+		clientID:     "client",
+		clientSecret: "secret",
+		endpoint:     server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "aad-token" {
+		t.Errorf("expected the AAD token, got %q", token.AccessToken)
+	}
+	if resource != azureAKSServerID {
+		t.Errorf("expected the token to be requested for the AKS server, got %q", resource)
+	}
+}
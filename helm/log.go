@@ -0,0 +1,57 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// The phases of the operations on the releases, logged along with the debug
+// output of Helm.
+const (
+	phasePlan   = "plan"
+	phaseRead   = "read"
+	phaseCreate = "create"
+	phaseUpdate = "update"
+	phaseDelete = "delete"
+	phaseImport = "import"
+)
+
+// releaseLogger writes the debug output of Helm as JSON to stderr, which the
+// plugin protocol forwards to Terraform with its fields, so that the TF_LOG
+// consumers can filter it by release.
+var releaseLogger hclog.Logger = hclog.New(&hclog.LoggerOptions{
+	Name:       "helm",
+	Level:      hclog.Trace,
+	Output:     os.Stderr,
+	JSONFormat: true,
+})
+
+// releaseLog returns the debug log of the operations on the release, its
+// messages carrying the release, namespace and phase fields.
+func releaseLog(name, namespace, phase string) action.DebugLog {
+	l := releaseLogger.With("release", name, "namespace", namespace, "phase", phase)
+	return func(format string, v ...interface{}) {
+		l.Debug(fmt.Sprintf(format, v...))
+	}
+}
+
+// setReleaseLog routes the debug output of the actions, the kube client and
+// the storage driver of the Helm configuration to the log. The sql drivers
+// are shared by the releases, they keep logging with debug.
+func setReleaseLog(cfg *action.Configuration, log action.DebugLog) {
+	cfg.Log = log
+	if kc, ok := cfg.KubeClient.(*kube.Client); ok {
+		kc.Log = log
+	}
+	switch d := cfg.Releases.Driver.(type) {
+	case *driver.Secrets:
+		d.Log = log
+	case *driver.ConfigMaps:
+		d.Log = log
+	}
+}
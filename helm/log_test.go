@@ -0,0 +1,35 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestReleaseLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := releaseLogger
+	defer func() { releaseLogger = logger }()
+	releaseLogger = hclog.New(&hclog.LoggerOptions{Level: hclog.Trace, Output: &buf, JSONFormat: true})
+
+	releaseLog("redis", "cache", phaseUpdate)("upgrading %s", "redis")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log entry, got %q: %s", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"@message":  "upgrading redis",
+		"@level":    "debug",
+		"release":   "redis",
+		"namespace": "cache",
+		"phase":     "update",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, entry[k])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	manifestStorageNone       = "none"
+	manifestStorageFull       = "full"
+	manifestStorageCompressed = "compressed"
+	manifestStorageHash       = "hash"
+)
+
+// manifestStorages are the ways the manifest of the release is stored in
+// the state.
+var manifestStorages = []string{
+	manifestStorageNone,
+	manifestStorageFull,
+	manifestStorageCompressed,
+	manifestStorageHash,
+}
+
+// storedManifest returns the manifest of the release as stored in the
+// state: not at all, as is, gzipped and base64 encoded, or as its SHA256
+// digest, which is enough to detect changes.
+func storedManifest(manifest, storage string) (string, error) {
+	switch storage {
+	case manifestStorageFull:
+		return manifest, nil
+	case manifestStorageCompressed:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write([]byte(manifest)); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	case manifestStorageHash:
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest))), nil
+	}
+	return "", nil
+}
+
+// manifestSeparator matches the separators of the documents of a manifest.
+var manifestSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// removeManifestFields removes the fields from the documents of the
+// manifest which have them, the others being kept as is. The fields are
+// paths like metadata.annotations.checksum, the lists being indexed, e.g.
+// webhooks[0], or matched as a whole with webhooks[*].
+func removeManifestFields(manifest string, fields []string) string {
+	if len(fields) == 0 {
+		return manifest
+	}
+
+	docs := manifestSeparator.Split(manifest, -1)
+	for i, doc := range docs {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj == nil {
+			continue
+		}
+
+		removed := false
+		for _, field := range fields {
+			removed = removeField(obj, fieldPath(field)) || removed
+		}
+		if !removed {
+			continue
+		}
+
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			continue
+		}
+		docs[i] = "\n" + manifestComments(doc) + string(out)
+	}
+	return strings.Join(docs, "---")
+}
+
+// fieldPath splits the path of the field into its segments, ignoring the
+// leading $ and dot of JSONPath expressions.
+func fieldPath(field string) []string {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	return strings.Split(field, ".")
+}
+
+// removeField removes the field at the path from the object, and reports
+// whether it had it.
+func removeField(obj interface{}, path []string) bool {
+	m, ok := obj.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return false
+	}
+
+	key, index := path[0], ""
+	if i := strings.Index(key, "["); i >= 0 && strings.HasSuffix(key, "]") {
+		key, index = key[:i], key[i+1:len(key)-1]
+	}
+	v, ok := m[key]
+	if !ok {
+		return false
+	}
+
+	if index == "" {
+		if len(path) == 1 {
+			delete(m, key)
+			return true
+		}
+		return removeField(v, path[1:])
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return false
+	}
+	if index == "*" {
+		if len(path) == 1 {
+			delete(m, key)
+			return true
+		}
+		removed := false
+		for _, e := range list {
+			removed = removeField(e, path[1:]) || removed
+		}
+		return removed
+	}
+
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 || n >= len(list) {
+		return false
+	}
+	if len(path) == 1 {
+		m[key] = append(list[:n:n], list[n+1:]...)
+		return true
+	}
+	return removeField(list[n], path[1:])
+}
+
+// manifestComments returns the comment lines heading the document, such as
+// the one naming its template.
+func manifestComments(doc string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimLeft(doc, "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
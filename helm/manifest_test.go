@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStoredManifest(t *testing.T) {
+	manifest := "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n"
+
+	if s, _ := storedManifest(manifest, manifestStorageNone); s != "" {
+		t.Errorf("expected no manifest, got %q", s)
+	}
+	if s, _ := storedManifest(manifest, manifestStorageFull); s != manifest {
+		t.Errorf("expected the manifest, got %q", s)
+	}
+	if s, _ := storedManifest(manifest, manifestStorageHash); !strings.HasPrefix(s, "sha256:") || len(s) != 71 {
+		t.Errorf("expected a SHA256 digest, got %q", s)
+	}
+
+	s, err := storedManifest(manifest, manifestStorageCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decompressed) != manifest {
+		t.Errorf("unexpected decompressed manifest %q", decompressed)
+	}
+}
+
+func TestRemoveManifestFields(t *testing.T) {
+	manifest := `---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+---
+# Source: test/templates/webhook.yaml
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: test
+  annotations:
+    checksum: abc
+webhooks:
+- name: a
+  clientConfig:
+    caBundle: Zm9v
+- name: b
+  clientConfig:
+    caBundle: YmFy
+`
+
+	expected := `---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+---
+# Source: test/templates/webhook.yaml
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: test
+webhooks:
+- clientConfig: {}
+  name: a
+- clientConfig: {}
+  name: b
+`
+	got := removeManifestFields(manifest, []string{"webhooks[*].clientConfig.caBundle", "$.metadata.annotations"})
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if got := removeManifestFields(manifest, []string{"spec.replicas"}); got != manifest {
+		t.Errorf("expected the manifest to be kept as is, got:\n%s", got)
+	}
+}
@@ -0,0 +1,146 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// namespaceMetadata are the labels and annotations of the namespace created
+// for the release. The old values are used to remove the labels and
+// annotations which are no longer set.
+type namespaceMetadata struct {
+	labels         map[string]string
+	annotations    map[string]string
+	oldLabels      map[string]string
+	oldAnnotations map[string]string
+}
+
+// expandNamespaceMetadata returns the namespace metadata of the release.
+func expandNamespaceMetadata(d *schema.ResourceData) namespaceMetadata {
+	oldLabels, labels := d.GetChange("namespace_labels")
+	oldAnnotations, annotations := d.GetChange("namespace_annotations")
+	return namespaceMetadata{
+		labels:         expandStringMap(labels),
+		annotations:    expandStringMap(annotations),
+		oldLabels:      expandStringMap(oldLabels),
+		oldAnnotations: expandStringMap(oldAnnotations),
+	}
+}
+
+// ensureNamespace creates the namespace with the given labels and
+// annotations, or updates them if it already exists. It reports whether the
+// namespace was created.
+func ensureNamespace(cfg *action.Configuration, name string, md namespaceMetadata) (bool, error) {
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	namespaces := clientset.CoreV1().Namespaces()
+
+	_, err = namespaces.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		labels := map[string]string{
+			"name": name,
+		}
+		for k, v := range md.labels {
+			labels[k] = v
+		}
+
+		debug("Creating namespace %s", name)
+		_, err = namespaces.Create(ctx, &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      labels,
+				Annotations: md.annotations,
+			},
+		}, metav1.CreateOptions{})
+		if err == nil {
+			return true, nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return false, errors.Wrapf(err, "failed to create namespace %s", name)
+		}
+	} else if err != nil {
+		return false, errors.Wrapf(err, "failed to get namespace %s", name)
+	}
+
+	patch := namespaceMetadataPatch(md)
+	if patch == nil {
+		return false, nil
+	}
+
+	debug("Updating the metadata of namespace %s", name)
+	if _, err := namespaces.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return false, errors.Wrapf(err, "failed to update namespace %s", name)
+	}
+	return false, nil
+}
+
+// namespaceMetadataPatch returns the JSON merge patch setting the labels and
+// annotations of the namespace, or nil if there is nothing to change.
+func namespaceMetadataPatch(md namespaceMetadata) []byte {
+	labels := mergePatchMap(md.oldLabels, md.labels)
+	annotations := mergePatchMap(md.oldAnnotations, md.annotations)
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+	return patch
+}
+
+// mergePatchMap returns the entries of a JSON merge patch turning old into
+// new, removed keys being set to null.
+func mergePatchMap(old, new map[string]string) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, v := range new {
+		patch[k] = v
+	}
+	return patch
+}
+
+func expandStringMap(v interface{}) map[string]string {
+	m := map[string]string{}
+	for k, v := range v.(map[string]interface{}) {
+		m[k] = v.(string)
+	}
+	return m
+}
+
+// deleteCreatedNamespace deletes the namespace, if it still exists.
+func deleteCreatedNamespace(cfg *action.Configuration, name string) error {
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+
+	debug("Deleting namespace %s", name)
+	err = clientset.CoreV1().Namespaces().Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete namespace %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestNamespaceMetadataPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		md   namespaceMetadata
+		want string
+	}{
+		{
+			name: "unchanged",
+			md: namespaceMetadata{
+				labels:    map[string]string{"a": "1"},
+				oldLabels: map[string]string{"a": "1"},
+			},
+			want: `{"metadata":{"labels":{"a":"1"}}}`,
+		},
+		{
+			name: "empty",
+			md:   namespaceMetadata{},
+			want: "",
+		},
+		{
+			name: "removed",
+			md: namespaceMetadata{
+				labels:         map[string]string{"istio-injection": "enabled"},
+				oldLabels:      map[string]string{"istio-injection": "disabled", "team": "a"},
+				oldAnnotations: map[string]string{"owner": "a"},
+			},
+			want: `{"metadata":{"annotations":{"owner":null},"labels":{"istio-injection":"enabled","team":null}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := string(namespaceMetadataPatch(tt.md))
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package helm
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// netrcCredentials are the credentials of a machine of a netrc file.
+type netrcCredentials struct {
+	login    string
+	password string
+}
+
+// Netrc holds the credentials of a netrc file, by machine.
+type Netrc struct {
+	machines map[string]netrcCredentials
+	// fallback are the credentials of the default entry, if any.
+	fallback *netrcCredentials
+}
+
+// loadNetrc reads and parses the netrc file.
+func loadNetrc(path string) (*Netrc, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(data)), nil
+}
+
+// parseNetrc parses the machine, default, login and password tokens of a
+// netrc file, skipping the macro definitions.
+func parseNetrc(data string) *Netrc {
+	n := &Netrc{machines: map[string]netrcCredentials{}}
+
+	var current *netrcCredentials
+	var machine string
+	save := func() {
+		if current == nil {
+			return
+		}
+		if machine == "" {
+			n.fallback = current
+		} else if _, ok := n.machines[machine]; !ok {
+			n.machines[machine] = *current
+		}
+		current = nil
+	}
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		tokens := strings.Fields(lines[i])
+		for j := 0; j < len(tokens); j++ {
+			next := func() string {
+				if j+1 < len(tokens) {
+					j++
+					return tokens[j]
+				}
+				return ""
+			}
+
+			switch tokens[j] {
+			case "machine":
+				save()
+				machine, current = next(), &netrcCredentials{}
+			case "default":
+				save()
+				machine, current = "", &netrcCredentials{}
+			case "login":
+				if v := next(); current != nil {
+					current.login = v
+				}
+			case "password":
+				if v := next(); current != nil {
+					current.password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				// A macro runs until the next empty line.
+				save()
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(tokens)
+			default:
+				if strings.HasPrefix(tokens[j], "#") {
+					j = len(tokens)
+				}
+			}
+		}
+	}
+	save()
+	return n
+}
+
+// credentials returns the login and password of the host, with or without
+// its port, or those of the default entry.
+func (n *Netrc) credentials(host string) (string, string, bool) {
+	if n == nil {
+		return "", "", false
+	}
+	c, ok := n.machines[host]
+	if !ok {
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			c, ok = n.machines[host[:i]]
+		}
+	}
+	if !ok && n.fallback != nil {
+		c, ok = *n.fallback, true
+	}
+	return c.login, c.password, ok
+}
@@ -0,0 +1,62 @@
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	n := parseNetrc(`# CI credentials
+machine charts.example.com login ci password secret
+machine gitlab.example.com
+  login gitlab-ci-token
+  password token
+
+macdef init
+  machine ignored.example.com login nope password nope
+
+default login anonymous password guest
+`)
+
+	tests := []struct {
+		host     string
+		login    string
+		password string
+	}{
+		{"charts.example.com", "ci", "secret"},
+		{"charts.example.com:443", "ci", "secret"},
+		{"gitlab.example.com", "gitlab-ci-token", "token"},
+		{"ignored.example.com", "anonymous", "guest"},
+		{"other.example.com", "anonymous", "guest"},
+	}
+	for _, tt := range tests {
+		login, password, ok := n.credentials(tt.host)
+		if !ok || login != tt.login || password != tt.password {
+			t.Errorf("%s: expected %s:%s, got %s:%s", tt.host, tt.login, tt.password, login, password)
+		}
+	}
+
+	if _, _, ok := parseNetrc("machine a login b password c").credentials("d"); ok {
+		t.Error("expected no credentials without default entry")
+	}
+}
+
+func TestHTTPGetterNetrc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		w.Write([]byte(user + ":" + password))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	g := &httpGetter{opts: httpGetterOptions{netrc: parseNetrc("machine " + u.Hostname() + " login ci password secret")}}
+	buf, err := g.Get(server.URL + "/index.yaml")
+	if err != nil {
+		t.Fatalf("error getting index: %v", err)
+	}
+	if buf.String() != "ci:secret" {
+		t.Fatalf("expected the credentials of the netrc file to be sent, got %q", buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// outputsAnnotation marks the ConfigMaps of the chart whose data is exported
+// in the outputs of the release.
+const outputsAnnotation = "terraform.io/outputs"
+
+// releaseOutputs returns the values exported by the release: the data of the
+// ConfigMaps of the manifest annotated with outputsAnnotation, and the
+// values extracted from the notes with the patterns, which take precedence.
+func releaseOutputs(r *release.Release, patterns map[string]string) (map[string]string, error) {
+	outputs := map[string]string{}
+
+	manifests := releaseutil.SplitManifests(r.Manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	for _, k := range keys {
+		var obj struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		}
+		if err := yaml.Unmarshal([]byte(manifests[k]), &obj); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the manifest of release %s", r.Name)
+		}
+
+		if obj.Kind != "ConfigMap" || obj.Metadata.Annotations[outputsAnnotation] != "true" {
+			continue
+		}
+		for k, v := range obj.Data {
+			outputs[k] = v
+		}
+	}
+
+	for name, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output pattern %q: %v", name, err)
+		}
+
+		match := re.FindStringSubmatch(r.Info.Notes)
+		switch {
+		case match == nil:
+			continue
+		case len(match) > 1:
+			outputs[name] = match[1]
+		default:
+			outputs[name] = match[0]
+		}
+	}
+
+	return outputs, nil
+}
+
+// validateOutputPatterns checks that the output patterns are valid regular
+// expressions.
+func validateOutputPatterns(v interface{}, k string) ([]string, []error) {
+	var errs []error
+	for name, pattern := range v.(map[string]interface{}) {
+		if _, err := regexp.Compile(pattern.(string)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %v", k, name, err))
+		}
+	}
+	return nil, errs
+}
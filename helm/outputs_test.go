@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestReleaseOutputs(t *testing.T) {
+	r := &release.Release{
+		Name: "test",
+		Manifest: `---
+# Source: test/templates/outputs.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-outputs
+  annotations:
+    terraform.io/outputs: "true"
+data:
+  hostname: test.example.com
+  secret_name: test-credentials
+---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+data:
+  config: ignored
+`,
+		Info: &release.Info{
+			Notes: "The service is available at http://test.example.com:8080\nPort: 8080\n",
+		},
+	}
+
+	outputs, err := releaseOutputs(r, map[string]string{
+		"url":     `http://\S+`,
+		"port":    `Port: (\d+)`,
+		"missing": `User: (\w+)`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"hostname":    "test.example.com",
+		"secret_name": "test-credentials",
+		"url":         "http://test.example.com:8080",
+		"port":        "8080",
+	}
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Errorf("expected %v, got %v", expected, outputs)
+	}
+}
@@ -0,0 +1,148 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// The ownership metadata checked by Helm before adopting existing resources.
+const (
+	appManagedByLabel              = "app.kubernetes.io/managed-by"
+	appManagedByHelm               = "Helm"
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+)
+
+// ownershipChange is the ownership metadata of a resource before it was
+// adopted by the release, a nil value meaning the key was not set.
+type ownershipChange struct {
+	info        *resource.Info
+	labels      map[string]interface{}
+	annotations map[string]interface{}
+}
+
+// takeOwnership takes the ownership of the existing resources of the
+// release, as done by `helm install --take-ownership` since Helm 3.17. Helm
+// checks the ownership metadata of the existing resources before creating
+// or updating them, so it is set on the resources of the rendered chart
+// right before the install or the upgrade is run. The changes are undone
+// with restoreOwnership if the action fails.
+func takeOwnership(cfg *action.Configuration, d resourceGetter, path string, values map[string]interface{}, isUpgrade bool) ([]ownershipChange, error) {
+	rel, err := renderClusterRelease(cfg, d, path, values, isUpgrade)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := cfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build kubernetes objects from release manifest")
+	}
+
+	var changes []ownershipChange
+	for _, info := range resources {
+		change, err := takeResourceOwnership(info, rel.Name, rel.Namespace)
+		if err != nil {
+			restoreOwnership(changes)
+			return nil, errors.Wrapf(err, "failed to take the ownership of %s %q", info.Mapping.GroupVersionKind.Kind, info.Name)
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	return changes, nil
+}
+
+// takeResourceOwnership sets the ownership metadata of the release on the
+// resource, if it exists and isn't already owned by the release, and returns
+// its previous metadata.
+func takeResourceOwnership(info *resource.Info, releaseName, releaseNamespace string) (*ownershipChange, error) {
+	helper := resource.NewHelper(info.Client, info.Mapping)
+	existing, err := helper.Get(info.Namespace, info.Name, false)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessor, err := meta.Accessor(existing)
+	if err != nil {
+		return nil, err
+	}
+	labels, annotations := accessor.GetLabels(), accessor.GetAnnotations()
+	if labels[appManagedByLabel] == appManagedByHelm &&
+		annotations[helmReleaseNameAnnotation] == releaseName &&
+		annotations[helmReleaseNamespaceAnnotation] == releaseNamespace {
+		return nil, nil
+	}
+
+	change := &ownershipChange{
+		info:        info,
+		labels:      previousValues(labels, appManagedByLabel),
+		annotations: previousValues(annotations, helmReleaseNameAnnotation, helmReleaseNamespaceAnnotation),
+	}
+
+	debug("Taking the ownership of %s %q for release %s", info.Mapping.GroupVersionKind.Kind, info.Name, releaseName)
+	err = patchOwnership(info, map[string]interface{}{
+		appManagedByLabel: appManagedByHelm,
+	}, map[string]interface{}{
+		helmReleaseNameAnnotation:      releaseName,
+		helmReleaseNamespaceAnnotation: releaseNamespace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// restoreOwnership restores the ownership metadata of the resources adopted
+// by an action which failed. The resources which can't be restored are
+// logged, the error of the action being the one reported.
+func restoreOwnership(changes []ownershipChange) {
+	for _, c := range changes {
+		debug("Restoring the ownership of %s %q", c.info.Mapping.GroupVersionKind.Kind, c.info.Name)
+		if err := patchOwnership(c.info, c.labels, c.annotations); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("[WARN] Unable to restore the ownership of %s %q: %s", c.info.Mapping.GroupVersionKind.Kind, c.info.Name, err)
+		}
+	}
+}
+
+// patchOwnership sets the ownership labels and annotations of the resource,
+// the nil values removing their key.
+func patchOwnership(info *resource.Info, labels, annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	helper := resource.NewHelper(info.Client, info.Mapping)
+	_, err = helper.Patch(info.Namespace, info.Name, types.MergePatchType, patch, &metav1.PatchOptions{})
+	return err
+}
+
+// previousValues returns the values of the keys, nil for the missing ones.
+func previousValues(m map[string]string, keys ...string) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			values[k] = v
+		} else {
+			values[k] = nil
+		}
+	}
+	return values
+}
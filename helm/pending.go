@@ -0,0 +1,123 @@
+package helm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// The repairs of the releases stuck pending, their last operation having
+// been interrupted.
+const (
+	pendingRepairFail     = "fail"
+	pendingRepairRollback = "rollback"
+	pendingRepairDelete   = "delete"
+)
+
+// isPending reports whether an operation on the release is in progress, or
+// was interrupted.
+func isPending(status release.Status) bool {
+	switch status {
+	case release.StatusPendingInstall, release.StatusPendingUpgrade, release.StatusPendingRollback:
+		return true
+	}
+	return false
+}
+
+// repairPendingRelease repairs the last revision of the release if it is
+// stuck pending, as set by pending_repair, so that it can be installed or
+// upgraded again: the release is rolled back to its last deployed revision,
+// or the pending revision is deleted, which rolling back does too when there
+// is no revision to roll back to.
+func repairPendingRelease(d *schema.ResourceData, cfg *action.Configuration, name string) error {
+	last, err := cfg.Releases.Last(name)
+	if err == driver.ErrReleaseNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isPending(last.Info.Status) {
+		return nil
+	}
+
+	strategy := d.Get("pending_repair").(string)
+	if strategy == pendingRepairFail {
+		return fmt.Errorf("revision %d of release %s is %s, its operation was interrupted or is still in progress: set pending_repair to rollback or delete to repair it",
+			last.Version, name, last.Info.Status)
+	}
+
+	previous, err := lastDeployedRevision(cfg, name, last.Version)
+	if err != nil {
+		return err
+	}
+	if strategy == pendingRepairRollback && previous > 0 {
+		log.Printf("[INFO] Rolling back release %s, stuck %s at revision %d, to revision %d", name, last.Info.Status, last.Version, previous)
+		last.SetStatus(release.StatusFailed, fmt.Sprintf("Interrupted while %s", last.Info.Status))
+		if err := cfg.Releases.Update(last); err != nil {
+			return err
+		}
+
+		client := action.NewRollback(cfg)
+		client.Version = previous
+		client.Timeout = releaseTimeout(d, schema.TimeoutUpdate)
+		client.Wait = d.Get("wait").(bool)
+		client.DisableHooks = hooksDisabled(d, "rollback")
+		client.CleanupOnFail = d.Get("cleanup_on_fail").(bool)
+		return errors.Wrapf(client.Run(name), "failed to roll back release %s, stuck %s", name, last.Info.Status)
+	}
+
+	log.Printf("[INFO] Deleting revision %d of release %s, stuck %s", last.Version, name, last.Info.Status)
+	if _, err := cfg.Releases.Delete(name, last.Version); err != nil {
+		return errors.Wrapf(err, "failed to delete revision %d of release %s", last.Version, name)
+	}
+	return nil
+}
+
+// lastDeployedRevision returns the last revision of the release before the
+// given one which was deployed, or 0 if there is none.
+func lastDeployedRevision(cfg *action.Configuration, name string, before int) (int, error) {
+	history, err := cfg.Releases.History(name)
+	if err != nil {
+		return 0, err
+	}
+
+	previous := 0
+	for _, r := range history {
+		if r.Version < before && r.Version > previous &&
+			(r.Info.Status == release.StatusDeployed || r.Info.Status == release.StatusSuperseded) {
+			previous = r.Version
+		}
+	}
+	return previous, nil
+}
+
+// prepareInstallRetry checks the release left by a failed install attempt
+// before it is retried: the release is returned if the attempt deployed it
+// after all, e.g. when it timed out once the release was deployed, a failed
+// or uninstalled release is replaced, and the other releases are an error,
+// since they can't be installed over.
+func prepareInstallRetry(client *action.Install, cfg *action.Configuration) (*release.Release, error) {
+	last, err := cfg.Releases.Last(client.ReleaseName)
+	if err == driver.ErrReleaseNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch last.Info.Status {
+	case release.StatusDeployed:
+		log.Printf("[INFO] Release %s was deployed by the failed install attempt, not retrying it", client.ReleaseName)
+		return last, nil
+	case release.StatusFailed, release.StatusUninstalled:
+		client.Replace = true
+		return nil, nil
+	}
+	return nil, fmt.Errorf("revision %d of release %s was left %s by the failed install attempt, not retrying it", last.Version, client.ReleaseName, last.Info.Status)
+}
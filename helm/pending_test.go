@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/action"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestRepairPendingRelease(t *testing.T) {
+	tests := []struct {
+		repair   string
+		statuses []release.Status
+		err      string
+		expected []release.Status
+	}{
+		{pendingRepairFail, []release.Status{release.StatusDeployed}, "", []release.Status{release.StatusDeployed}},
+		{pendingRepairFail, []release.Status{release.StatusSuperseded, release.StatusPendingUpgrade}, "revision 2 of release test is pending-upgrade", nil},
+		{pendingRepairDelete, []release.Status{release.StatusSuperseded, release.StatusPendingUpgrade}, "", []release.Status{release.StatusSuperseded}},
+		{pendingRepairDelete, []release.Status{release.StatusPendingInstall}, "", nil},
+		{pendingRepairRollback, []release.Status{release.StatusDeployed, release.StatusFailed, release.StatusPendingUpgrade},
+			"", []release.Status{release.StatusSuperseded, release.StatusFailed, release.StatusFailed, release.StatusDeployed}},
+		// A pending install has no revision to roll back to.
+		{pendingRepairRollback, []release.Status{release.StatusPendingInstall}, "", nil},
+	}
+
+	for _, tt := range tests {
+		cfg := &action.Configuration{
+			Releases:   storage.Init(driver.NewMemory()),
+			KubeClient: &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+			Log:        debug,
+		}
+		for i, status := range tt.statuses {
+			r := &release.Release{Name: "test", Namespace: "default", Version: i + 1, Info: &release.Info{Status: status}}
+			if err := cfg.Releases.Create(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		d := schema.TestResourceDataRaw(t, resourceRelease().Schema, map[string]interface{}{
+			"name":           "test",
+			"chart":          "test",
+			"pending_repair": tt.repair,
+			"wait":           false,
+		})
+
+		err := repairPendingRelease(d, cfg, "test")
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s %v: expected error %q, got %v", tt.repair, tt.statuses, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: unexpected error: %s", tt.repair, tt.statuses, err)
+			continue
+		}
+
+		history, _ := cfg.Releases.History("test")
+		statuses := make([]release.Status, len(history))
+		for _, r := range history {
+			statuses[r.Version-1] = r.Info.Status
+		}
+		if len(statuses) != len(tt.expected) {
+			t.Errorf("%s %v: expected %v, got %v", tt.repair, tt.statuses, tt.expected, statuses)
+			continue
+		}
+		for i := range statuses {
+			if statuses[i] != tt.expected[i] {
+				t.Errorf("%s %v: expected %v, got %v", tt.repair, tt.statuses, tt.expected, statuses)
+				break
+			}
+		}
+	}
+}
+
+func TestPrepareInstallRetry(t *testing.T) {
+	tests := []struct {
+		status   release.Status
+		deployed bool
+		replace  bool
+		err      string
+	}{
+		{"", false, false, ""},
+		{release.StatusDeployed, true, false, ""},
+		{release.StatusFailed, false, true, ""},
+		{release.StatusUninstalled, false, true, ""},
+		{release.StatusPendingInstall, false, false, "revision 1 of release test was left pending-install"},
+	}
+
+	for _, tt := range tests {
+		cfg := &action.Configuration{
+			Releases:   storage.Init(driver.NewMemory()),
+			KubeClient: &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+			Log:        debug,
+		}
+		if tt.status != "" {
+			r := &release.Release{Name: "test", Namespace: "default", Version: 1, Info: &release.Info{Status: tt.status}}
+			if err := cfg.Releases.Create(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		client := action.NewInstall(cfg)
+		client.ReleaseName = "test"
+		rel, err := prepareInstallRetry(client, cfg)
+		if tt.err == "" && err != nil {
+			t.Errorf("%q: unexpected error %s", tt.status, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%q: expected the error %q, got %v", tt.status, tt.err, err)
+		}
+		if deployed := rel != nil; deployed != tt.deployed {
+			t.Errorf("%q: expected the release to be returned: %t, got %t", tt.status, tt.deployed, deployed)
+		}
+		if client.Replace != tt.replace {
+			t.Errorf("%q: expected replace to be %t, got %t", tt.status, tt.replace, client.Replace)
+		}
+	}
+}
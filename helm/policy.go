@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// policyOptions are the settings of the evaluation of the Rego policies on
+// the rendered manifests.
+type policyOptions struct {
+	regoPaths []string
+	query     string
+	opaPath   string
+}
+
+// expandPolicyOptions returns the policy settings of the release.
+func expandPolicyOptions(d resourceGetter) policyOptions {
+	opts := policyOptions{
+		query:   d.Get("policy.0.query").(string),
+		opaPath: d.Get("policy.0.opa_binary_path").(string),
+	}
+	for _, p := range d.Get("policy.0.rego_paths").([]interface{}) {
+		opts.regoPaths = append(opts.regoPaths, p.(string))
+	}
+	return opts
+}
+
+// opaResult is the result of opa eval --format json.
+type opaResult struct {
+	Result []struct {
+		Expressions []struct {
+			Value interface{} `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+// evaluatePolicy evaluates the deny rules of the policies on each rendered
+// manifest with the OPA binary, as done by conftest, and fails with the
+// messages of the denials.
+func evaluatePolicy(opts policyOptions, manifests []string) error {
+	var denials []string
+	for _, manifest := range manifests {
+		input, err := yaml.YAMLToJSON([]byte(manifest))
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert %s to JSON", manifestName(manifest))
+		}
+		if string(input) == "null" {
+			continue
+		}
+
+		messages, err := evaluateOPA(opts, input)
+		if err != nil {
+			return errors.Wrapf(err, "failed to evaluate the policies on %s", manifestName(manifest))
+		}
+		for _, msg := range messages {
+			denials = append(denials, fmt.Sprintf("%s: %s", manifestName(manifest), msg))
+		}
+	}
+	if len(denials) == 0 {
+		return nil
+	}
+
+	sort.Strings(denials)
+	return fmt.Errorf("manifests denied by the policies: \n\t%s", strings.Join(denials, "\n\t"))
+}
+
+// evaluateOPA evaluates the query on the input, and returns the messages of
+// the denials.
+func evaluateOPA(opts policyOptions, input []byte) ([]string, error) {
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, p := range opts.regoPaths {
+		args = append(args, "--data", p)
+	}
+	args = append(args, opts.query)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(opts.opaPath, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "error while running %s: %s", opts.opaPath, strings.TrimSpace(stderr.String()))
+	}
+
+	return opaDenials(stdout.Bytes())
+}
+
+// opaDenials returns the messages of the denials of the result of opa eval.
+// The deny rules are sets of messages, which may not be strings.
+func opaDenials(output []byte) ([]string, error) {
+	var result opaResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the result of opa eval")
+	}
+
+	var messages []string
+	for _, r := range result.Result {
+		for _, e := range r.Expressions {
+			values, ok := e.Value.([]interface{})
+			if !ok {
+				values = []interface{}{e.Value}
+			}
+			for _, v := range values {
+				switch v := v.(type) {
+				case string:
+					messages = append(messages, v)
+				case bool:
+					if v {
+						messages = append(messages, "denied")
+					}
+				default:
+					b, _ := json.Marshal(v)
+					messages = append(messages, string(b))
+				}
+			}
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,59 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOPADenials(t *testing.T) {
+	output := `{"result":[{"expressions":[{"value":["containers must not run as root",{"msg":"missing limits"}],"text":"data.main.deny"}]}]}`
+	messages, err := opaDenials([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"containers must not run as root", `{"msg":"missing limits"}`}
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, messages)
+	}
+
+	messages, err = opaDenials([]byte(`{}`))
+	if err != nil || len(messages) != 0 {
+		t.Errorf("expected no denial for an undefined query, got %v (%v)", messages, err)
+	}
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake OPA denies the Deployments.
+	opa := filepath.Join(dir, "opa")
+	script := `#!/bin/sh
+if grep -q Deployment; then
+  echo '{"result":[{"expressions":[{"value":["deployments are not allowed"]}]}]}'
+else
+  echo '{"result":[{"expressions":[{"value":[]}]}]}'
+fi
+`
+	if err := ioutil.WriteFile(opa, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests := []string{
+		"# Source: app/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\n",
+		"# Source: app/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\n",
+	}
+	err = evaluatePolicy(policyOptions{regoPaths: []string{"policy"}, query: "data.main.deny", opaPath: opa}, manifests)
+	if err == nil || !strings.Contains(err.Error(), "app/templates/deployment.yaml: deployments are not allowed") {
+		t.Fatalf("expected the deployment to be denied, got %v", err)
+	}
+	if strings.Contains(err.Error(), "configmap") {
+		t.Errorf("expected the config map to be allowed, got %v", err)
+	}
+}
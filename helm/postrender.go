@@ -0,0 +1,121 @@
+package helm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/postrender"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// releasePostRenderer returns the post-renderer of the release: the
+// postrender command, followed by the injection of the common metadata.
+// It returns nil if there is nothing to post-render.
+func releasePostRenderer(d resourceGetter) (postrender.PostRenderer, error) {
+	var renderers postRenderers
+
+	if cmd := d.Get("postrender.0.binary_path").(string); cmd != "" {
+		pr, err := postrender.NewExec(cmd)
+		if err != nil {
+			return nil, err
+		}
+		renderers = append(renderers, pr)
+	}
+
+	md := &commonMetadataPostRenderer{
+		labels:      expandStringMap(d.Get("common_metadata.0.labels")),
+		annotations: expandStringMap(d.Get("common_metadata.0.annotations")),
+	}
+	if len(md.labels) > 0 || len(md.annotations) > 0 {
+		renderers = append(renderers, md)
+	}
+
+	switch len(renderers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return renderers[0], nil
+	}
+	return renderers, nil
+}
+
+// postRenderers runs the post-renderers one after the other.
+type postRenderers []postrender.PostRenderer
+
+// Run implements postrender.PostRenderer
+func (p postRenderers) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	var err error
+	for _, pr := range p {
+		manifests, err = pr.Run(manifests)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifests, nil
+}
+
+// commonMetadataPostRenderer sets the labels and annotations on all the
+// rendered objects, overriding those set by the chart.
+type commonMetadataPostRenderer struct {
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// Run implements postrender.PostRenderer
+func (r *commonMetadataPostRenderer) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	out := &bytes.Buffer{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(manifests))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the rendered manifests")
+		}
+
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, errors.Wrap(err, "failed to parse the rendered manifests")
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		metadata, ok := obj["metadata"].(map[string]interface{})
+		if !ok {
+			metadata = map[string]interface{}{}
+			obj["metadata"] = metadata
+		}
+		mergeStringMap(metadata, "labels", r.labels)
+		mergeStringMap(metadata, "annotations", r.annotations)
+
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		out.Write(b)
+	}
+	return out, nil
+}
+
+// mergeStringMap sets the values on the map of obj at key, creating it if
+// needed.
+func mergeStringMap(obj map[string]interface{}, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	m, ok := obj[key].(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		obj[key] = m
+	}
+	for k, v := range values {
+		m[k] = v
+	}
+}
@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"bytes"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestCommonMetadataPostRenderer(t *testing.T) {
+	manifests := `---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  labels:
+    team: chart
+---
+# Source: test/templates/empty.yaml
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test
+`
+
+	r := &commonMetadataPostRenderer{
+		labels:      map[string]string{"team": "platform"},
+		annotations: map[string]string{"owner": "platform@example.com"},
+	}
+	out, err := r.Run(bytes.NewBufferString(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := bytes.Split(out.Bytes(), []byte("---\n"))[1:]
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d:\n%s", len(docs), out)
+	}
+
+	for _, doc := range docs {
+		var obj struct {
+			Metadata struct {
+				Labels      map[string]string `json:"labels"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj.Metadata.Labels["team"] != "platform" || obj.Metadata.Annotations["owner"] != "platform@example.com" {
+			t.Errorf("expected the common metadata to be set, got:\n%s", doc)
+		}
+	}
+}
@@ -5,17 +5,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 
 	// Import to initialize client auth plugins.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -26,9 +32,52 @@ type Meta struct {
 	data       *schema.ResourceData
 	Settings   *cli.EnvSettings
 	HelmDriver string
+	Offline    bool
+	BurstLimit int
 
-	// Used to lock some operations
-	sync.Mutex
+	// StorageNamespace is the namespace the revisions of the releases are
+	// stored in, instead of their own namespace.
+	StorageNamespace string
+	// ReleaseLabels and ReleaseAnnotations are set on the storage objects of
+	// the revisions of all the releases.
+	ReleaseLabels      map[string]string
+	ReleaseAnnotations map[string]string
+	// SQLStorage is the connection of the sql storage driver, set when
+	// helm_driver is sql.
+	SQLStorage *SQLStorage
+
+	SkipRepoUpdate bool
+
+	// TemplateOnlyPlan allows planning without reaching the cluster, the
+	// charts being rendered with KubeVersion and APIVersions.
+	TemplateOnlyPlan bool
+	KubeVersion      string
+	APIVersions      []string
+
+	RepositoryProxy *RepositoryProxy
+	RepositoryTLS   []RepositoryTLS
+	ChartCache      *ChartCache
+	Netrc           *Netrc
+
+	// Indexes of the chart repositories downloaded by the provider.
+	indexes *indexCache
+
+	// Used to serialize the access to the provider configuration data,
+	// since ResourceData is not safe for concurrent use.
+	dataMutex sync.Mutex
+
+	// Used to serialize the downloads into the repository cache, one
+	// mutex per repository.
+	repositoryMutexes sync.Map
+
+	// Client side rate limiter shared by all the Kubernetes clients, when
+	// shared_rate_limiter is set.
+	rateLimiter flowcontrol.RateLimiter
+
+	// Kubernetes client configurations by namespace, and the discovery
+	// shared by them, reused by all the operations of the provider.
+	kubeConfigs map[string]*KubeConfig
+	discovery   *discoveryCache
 }
 
 // Provider returns the provider schema to Terraform.
@@ -65,6 +114,162 @@ func Provider() *schema.Provider {
 				Description: "The path to the file containing cached repository indexes",
 				DefaultFunc: schema.EnvDefaultFunc("HELM_REPOSITORY_CACHE", helmpath.CachePath("repository")),
 			},
+			"netrc_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The path to a netrc file holding the credentials of the chart repositories.",
+				DefaultFunc: schema.EnvDefaultFunc("NETRC", ""),
+			},
+			"repository_proxy": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Proxy configuration used to reach chart repositories. It does not apply to the Kubernetes API, see `kubernetes.proxy_url`.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"http_proxy": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.IsURLWithScheme([]string{"http", "https", "socks5"}),
+							Description:  "Proxy used for http repositories. Defaults to the HTTP_PROXY environment variable.",
+						},
+						"https_proxy": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.IsURLWithScheme([]string{"http", "https", "socks5"}),
+							Description:  "Proxy used for https repositories. Defaults to the HTTPS_PROXY environment variable.",
+						},
+						"no_proxy": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Comma separated list of hosts, domains and CIDRs that are reached without the proxy.",
+						},
+					},
+				},
+			},
+			"chart_cache": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Cache of the downloaded chart archives, by repository, name, version and digest.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The directory of the cache. Defaults to the `charts` directory of the repository cache.",
+						},
+						"ttl": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      86400,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "The number of seconds the cached charts are used for. Set to 0 to use them forever.",
+						},
+						"max_size": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      1024,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "The maximum size of the cache in megabytes, the oldest charts being removed first. Set to 0 for no limit.",
+						},
+					},
+				},
+			},
+			"repository_tls": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "TLS configuration of the chart repositories and OCI registries whose URL starts with `url`. The settings of a release take precedence.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"url": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "URL prefix of the repositories the configuration applies to.",
+						},
+						"cert_file": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the client certificate file.",
+						},
+						"key_file": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the client key file.",
+						},
+						"ca_file": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the CA file.",
+						},
+						"client_certificate": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "PEM-encoded client certificate. Takes precedence over `cert_file`.",
+						},
+						"client_key": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "PEM-encoded client key. Takes precedence over `key_file`.",
+						},
+						"ca_certificate": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "PEM-encoded CA certificate. Takes precedence over `ca_file`.",
+						},
+					},
+				},
+			},
+			"burst_limit": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      100,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Helm burst limit. Increase this if you have a cluster with many CRDs.",
+			},
+			"shared_rate_limiter": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Share a single client side rate limiter, configured by the `qps` and `burst` of the kubernetes block, between all the releases.",
+			},
+			"repository_index_ttl": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      300,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "The number of seconds the indexes of the repositories set by URL are cached for by the provider. Set to 0 to download them for every chart.",
+			},
+			"skip_repo_update": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Use the indexes of the repositories downloaded by the previous runs rather than refreshing them, for all the releases.",
+			},
+			"template_only_plan": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Plan without failing when the cluster is unreachable: the charts are rendered and checked client-side with `kube_version` and `api_versions`, and the state of the releases is not refreshed.",
+			},
+			"kube_version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The Kubernetes version the charts are rendered for when the cluster is unreachable in `template_only_plan` mode.",
+			},
+			"api_versions": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The additional API versions the charts are rendered with when the cluster is unreachable in `template_only_plan` mode, e.g. those of the CRDs.",
+			},
+			"offline": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Forbid network access for retrieving charts. Charts are resolved from local paths and the repository cache only.",
+			},
 			"helm_driver": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -94,6 +299,89 @@ func Provider() *schema.Provider {
 					}
 				},
 			},
+			"storage_namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The namespace the revisions of the releases are stored in, instead of the namespace of each release.",
+			},
+			"release_labels": {
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: validateReleaseLabels,
+				Description:  "Labels set on the Secrets or ConfigMaps storing the revisions of all the releases. The release_labels of each release take precedence.",
+			},
+			"release_annotations": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Annotations set on the Secrets or ConfigMaps storing the revisions of all the releases. The release_annotations of each release take precedence.",
+			},
+			"sql": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Connection to the PostgreSQL database of the sql storage driver. The settings left unset are read from the PG* environment variables.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"connection_string": {
+							Type:          schema.TypeString,
+							Optional:      true,
+							Sensitive:     true,
+							ConflictsWith: sqlConnectionAttributes,
+							Description:   "The connection string of the database, as a URL or as key/value pairs. Defaults to the HELM_DRIVER_SQL_CONNECTION_STRING environment variable when the other settings are unset.",
+						},
+						"host": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The host of the database.",
+						},
+						"port": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validation.IsPortNumber,
+							Description:  "The port of the database.",
+						},
+						"database": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The name of the database.",
+						},
+						"user": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The user to connect as.",
+						},
+						"password": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "The password of the user.",
+						},
+						"sslmode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice([]string{"disable", "require", "verify-ca", "verify-full"}, false),
+							Description:  "The TLS mode of the connection: disable, require, verify-ca or verify-full.",
+						},
+						"sslrootcert": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the CA certificates verifying the server.",
+						},
+						"sslcert": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the client certificate.",
+						},
+						"sslkey": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the key of the client certificate.",
+						},
+					},
+				},
+			},
 			"kubernetes": {
 				Type:        schema.TypeList,
 				MaxItems:    1,
@@ -103,7 +391,16 @@ func Provider() *schema.Provider {
 			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"helm_release": resourceRelease(),
+			"helm_release":     resourceRelease(),
+			"helm_release_set": resourceReleaseSet(),
+			"helm_plugin":      resourcePlugin(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"helm_chart_crds":      dataChartCRDs(),
+			"helm_chart_values":    dataChartValues(),
+			"helm_env":             dataEnv(),
+			"helm_lint":            dataLint(),
+			"helm_release_history": dataReleaseHistory(),
 		},
 	}
 	p.ConfigureContextFunc = func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
@@ -139,6 +436,12 @@ func kubernetesResource() *schema.Resource {
 				DefaultFunc: schema.EnvDefaultFunc("KUBE_INSECURE", false),
 				Description: "Whether server should be accessed without verifying the TLS certificate.",
 			},
+			"tls_server_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_TLS_SERVER_NAME", ""),
+				Description: "Server name used to verify the TLS certificate of the server, and sent for SNI. Defaults to the hostname of `host`.",
+			},
 			"client_certificate": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -193,6 +496,182 @@ func kubernetesResource() *schema.Resource {
 				DefaultFunc: schema.EnvDefaultFunc("KUBE_TOKEN", ""),
 				Description: "Token to authenticate an service account",
 			},
+			"as": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Username to impersonate for the operations, like `kubectl --as`.",
+			},
+			"as_groups": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Groups to impersonate for the operations, like `kubectl --as-group`.",
+			},
+			"as_uid": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "UID to impersonate for the operations, like `kubectl --as-uid`. Requires `as`.",
+			},
+			"proxy_url": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("KUBE_PROXY_URL", ""),
+				ValidateFunc: validation.IsURLWithScheme([]string{"http", "https", "socks5"}),
+				Description:  "URL to the proxy to be used for all API requests. Can be set with KUBE_PROXY_URL.",
+			},
+			"qps": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				ValidateFunc: validation.FloatAtLeast(0),
+				Description:  "Maximum queries per second allowed from the client to the Kubernetes API server. Defaults to the client-go default of 5.",
+			},
+			"burst": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum burst of queries allowed from the client to the Kubernetes API server on top of qps. Defaults to the client-go default of 10.",
+			},
+			"oidc": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Description:   "OpenID Connect authentication. The ID token is refreshed with the refresh token when it expires.",
+				ConflictsWith: []string{"kubernetes.0.token"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"issuer_url": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "URL of the OIDC issuer.",
+						},
+						"client_id": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "OIDC client ID.",
+						},
+						"client_secret": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "OIDC client secret.",
+						},
+						"refresh_token": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Refresh token used to obtain new ID tokens.",
+						},
+						"id_token": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Initial ID token. Refreshed when expired.",
+						},
+						"ca_certificate": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "PEM-encoded CA certificate of the issuer.",
+						},
+						"extra_scopes": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Extra scopes requested when refreshing the ID token.",
+						},
+					},
+				},
+			},
+			"eks": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"kubernetes.0.token", "kubernetes.0.exec", "kubernetes.0.oidc", "kubernetes.0.gke", "kubernetes.0.azure"},
+				Description:   "Authenticate against an EKS cluster with the AWS credentials of the environment, without the aws CLI or aws-iam-authenticator.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"cluster_name": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "Name of the EKS cluster.",
+						},
+						"region": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "AWS region of the STS endpoint. Defaults to the region of the AWS environment.",
+						},
+						"role_arn": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "ARN of the IAM role to assume to authenticate.",
+						},
+					},
+				},
+			},
+			"gke": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"kubernetes.0.token", "kubernetes.0.exec", "kubernetes.0.oidc", "kubernetes.0.eks", "kubernetes.0.azure"},
+				Description:   "Authenticate against a GKE cluster with the Google Application Default Credentials, without the gcloud CLI.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"credentials": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "JSON key of a service account. Defaults to the Application Default Credentials.",
+						},
+						"scopes": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "OAuth2 scopes of the access tokens.",
+						},
+					},
+				},
+			},
+			"azure": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"kubernetes.0.token", "kubernetes.0.exec", "kubernetes.0.oidc", "kubernetes.0.eks", "kubernetes.0.gke"},
+				Description:   "Authenticate against an AKS cluster with Azure AD, using a service principal or a managed identity, without kubelogin.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"tenant_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Azure AD tenant ID. Defaults to the ARM_TENANT_ID environment variable.",
+						},
+						"client_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Client ID of the service principal, or of the user assigned managed identity. Defaults to the ARM_CLIENT_ID environment variable.",
+						},
+						"client_secret": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Client secret of the service principal. Defaults to the ARM_CLIENT_SECRET environment variable.",
+						},
+						"use_msi": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Use the managed identity of the host. Defaults to the ARM_USE_MSI environment variable.",
+						},
+						"server_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Application ID of the AAD server of the cluster. Defaults to the AKS AAD server.",
+						},
+						"active_directory_endpoint": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Azure AD endpoint, for sovereign clouds.",
+						},
+					},
+				},
+			},
 			"exec": {
 				Type:     schema.TypeList,
 				Optional: true,
@@ -217,6 +696,18 @@ func kubernetesResource() *schema.Resource {
 							Optional: true,
 							Elem:     &schema.Schema{Type: schema.TypeString},
 						},
+						"inherit_env": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+							Description: "Run the command with the environment of the provider. When false, the other variables than `PATH`, `HOME` and those of `env` and `env_passthrough` are set to empty values.",
+						},
+						"env_passthrough": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Names of the environment variables of the provider passed to the command when `inherit_env` is false.",
+						},
 					},
 				},
 				Description: "",
@@ -258,6 +749,10 @@ func checkKubernetesConfigurationValid(d *schema.ResourceData) error {
 		"client_certificate",
 		"token",
 		"exec",
+		"oidc",
+		"eks",
+		"gke",
+		"azure",
 	}
 	for _, a := range atLeastOneOf {
 		if _, ok := k8sGetOk(d, a); ok {
@@ -298,10 +793,114 @@ func providerConfigure(d *schema.ResourceData, terraformVersion string) (interfa
 	if v, ok := d.GetOk("helm_driver"); ok {
 		m.HelmDriver = v.(string)
 	}
+	m.StorageNamespace = d.Get("storage_namespace").(string)
+	m.ReleaseLabels = expandStringMap(d.Get("release_labels"))
+	m.ReleaseAnnotations = expandStringMap(d.Get("release_annotations"))
+
+	_, sql := d.GetOk("sql")
+	if sql && !isSQLDriver(m.HelmDriver) {
+		return nil, diag.Errorf("the sql block requires helm_driver to be sql, got %q", m.HelmDriver)
+	}
+	if isSQLDriver(m.HelmDriver) {
+		m.SQLStorage = &SQLStorage{
+			ConnectionString: d.Get("sql.0.connection_string").(string),
+			Host:             d.Get("sql.0.host").(string),
+			Port:             d.Get("sql.0.port").(int),
+			Database:         d.Get("sql.0.database").(string),
+			User:             d.Get("sql.0.user").(string),
+			Password:         d.Get("sql.0.password").(string),
+			SSLMode:          d.Get("sql.0.sslmode").(string),
+			SSLRootCert:      d.Get("sql.0.sslrootcert").(string),
+			SSLCert:          d.Get("sql.0.sslcert").(string),
+			SSLKey:           d.Get("sql.0.sslkey").(string),
+		}
+		// DefaultFunc is not triggered in the blocks.
+		if m.SQLStorage.DSN() == "" {
+			m.SQLStorage.ConnectionString = os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING")
+		}
+	}
+
+	m.Offline = d.Get("offline").(bool)
+	m.SkipRepoUpdate = d.Get("skip_repo_update").(bool)
+	m.TemplateOnlyPlan = d.Get("template_only_plan").(bool)
+	m.KubeVersion = d.Get("kube_version").(string)
+	m.APIVersions = expandStringSlice(d.Get("api_versions").([]interface{}))
+	m.indexes = newIndexCache(time.Duration(d.Get("repository_index_ttl").(int)) * time.Second)
+	m.BurstLimit = d.Get("burst_limit").(int)
+
+	if d.Get("shared_rate_limiter").(bool) {
+		qps, burst := float32(rest.DefaultQPS), rest.DefaultBurst
+		if v, ok := k8sGetOk(d, "qps"); ok {
+			qps = float32(v.(float64))
+		}
+		if v, ok := k8sGetOk(d, "burst"); ok {
+			burst = v.(int)
+		}
+		m.rateLimiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+	}
+
+	if _, ok := d.GetOk("repository_proxy"); ok {
+		m.RepositoryProxy = &RepositoryProxy{
+			HTTPProxy:  d.Get("repository_proxy.0.http_proxy").(string),
+			HTTPSProxy: d.Get("repository_proxy.0.https_proxy").(string),
+			NoProxy:    d.Get("repository_proxy.0.no_proxy").(string),
+		}
+	}
+
+	if v, ok := d.GetOk("netrc_file"); ok {
+		netrc, err := loadNetrc(v.(string))
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+		m.Netrc = netrc
+	}
+
+	if _, ok := d.GetOk("chart_cache"); ok {
+		m.ChartCache = &ChartCache{
+			Path:    d.Get("chart_cache.0.path").(string),
+			TTL:     time.Duration(d.Get("chart_cache.0.ttl").(int)) * time.Second,
+			MaxSize: int64(d.Get("chart_cache.0.max_size").(int)) << 20,
+		}
+		if m.ChartCache.Path == "" {
+			m.ChartCache.Path = filepath.Join(settings.RepositoryCache, "charts")
+		}
+	}
+
+	for _, v := range d.Get("repository_tls").([]interface{}) {
+		r := v.(map[string]interface{})
+		m.RepositoryTLS = append(m.RepositoryTLS, RepositoryTLS{
+			URL:               r["url"].(string),
+			CertFile:          r["cert_file"].(string),
+			KeyFile:           r["key_file"].(string),
+			CAFile:            r["ca_file"].(string),
+			ClientCertificate: r["client_certificate"].(string),
+			ClientKey:         r["client_key"].(string),
+			CACertificate:     r["ca_certificate"].(string),
+		})
+	}
 
 	return m, nil
 }
 
+// sqlConnectionAttributes are the settings of the sql block making up the
+// connection string.
+var sqlConnectionAttributes = []string{
+	"sql.0.host",
+	"sql.0.port",
+	"sql.0.database",
+	"sql.0.user",
+	"sql.0.password",
+	"sql.0.sslmode",
+	"sql.0.sslrootcert",
+	"sql.0.sslcert",
+	"sql.0.sslkey",
+}
+
+// isSQLDriver reports whether the storage driver is the sql driver.
+func isSQLDriver(helmDriver string) bool {
+	return strings.EqualFold(helmDriver, driver.SQLDriverName)
+}
+
 var k8sPrefix = "kubernetes.0."
 
 func k8sGetOk(d *schema.ResourceData, key string) (interface{}, bool) {
@@ -351,27 +950,94 @@ func expandStringSlice(s []interface{}) []string {
 
 // GetHelmConfiguration will return a new Helm configuration
 func (m *Meta) GetHelmConfiguration(namespace string) (*action.Configuration, error) {
-	m.Lock()
-	defer m.Unlock()
+	return m.getHelmConfiguration(namespace, "")
+}
+
+// getHelmConfiguration returns a new Helm configuration for the namespace,
+// the revisions of the releases being stored in the storage namespace, the
+// storage_namespace of the provider, or the namespace.
+func (m *Meta) getHelmConfiguration(namespace, storageNamespace string) (*action.Configuration, error) {
 	debug("[INFO] GetHelmConfiguration start")
 	actionConfig := new(action.Configuration)
 
-	if err := checkKubernetesConfigurationValid(m.data); err != nil {
+	kc, err := m.newKubeConfig(namespace)
+	if err != nil {
 		return nil, err
 	}
 
-	kc, err := newKubeConfig(m.data, &namespace)
-	if err != nil {
-		return nil, err
+	if storageNamespace == "" {
+		storageNamespace = m.StorageNamespace
+	}
+	if storageNamespace == "" {
+		storageNamespace = namespace
+	}
+
+	// The sql driver is connected with the sql block of the provider, Helm
+	// reading its connection string from the environment only.
+	helmDriver := m.HelmDriver
+	if m.SQLStorage != nil {
+		helmDriver = strings.ToLower(driver.MemoryDriverName)
 	}
 
-	if err := actionConfig.Init(kc, namespace, m.HelmDriver, debug); err != nil {
+	// The kube client works in the namespace of the kube config, the
+	// storage driver in the namespace it is initialized with.
+	if err := actionConfig.Init(kc, storageNamespace, helmDriver, debug); err != nil {
 		return nil, err
 	}
+
+	if m.SQLStorage != nil {
+		d, err := m.SQLStorage.driver(storageNamespace)
+		if err != nil {
+			return nil, err
+		}
+		actionConfig.Releases = storage.Init(d)
+	}
 	debug("[INFO] GetHelmConfiguration success")
 	return actionConfig, nil
 }
 
+// newKubeConfig builds the kubernetes client configuration for the given
+// namespace from the provider configuration, or returns the one already
+// built.
+func (m *Meta) newKubeConfig(namespace string) (*KubeConfig, error) {
+	m.dataMutex.Lock()
+	defer m.dataMutex.Unlock()
+
+	if kc, ok := m.kubeConfigs[namespace]; ok {
+		return kc, nil
+	}
+
+	if err := checkKubernetesConfigurationValid(m.data); err != nil {
+		return nil, err
+	}
+
+	kc, err := newKubeConfig(m.data, &namespace)
+	if err != nil || kc == nil {
+		return kc, err
+	}
+
+	kc.BurstLimit = m.BurstLimit
+	kc.RateLimiter = m.rateLimiter
+
+	if m.kubeConfigs == nil {
+		m.kubeConfigs = map[string]*KubeConfig{}
+		m.discovery = &discoveryCache{}
+	}
+	kc.discovery = m.discovery
+	m.kubeConfigs[namespace] = kc
+	return kc, nil
+}
+
+// lockRepository locks the repository identified by key, so only one chart
+// is downloaded at a time from it into the repository cache. It returns the
+// function to unlock it.
+func (m *Meta) lockRepository(key string) func() {
+	v, _ := m.repositoryMutexes.LoadOrStore(key, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
 func debug(format string, a ...interface{}) {
 	log.Printf("[DEBUG] %s", fmt.Sprintf(format, a...))
 }
@@ -0,0 +1,43 @@
+package helm
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// sensitiveValues returns the values of set_sensitive, longest first so that
+// the values containing others are redacted first.
+func sensitiveValues(d resourceGetter) []string {
+	var values []string
+	for _, raw := range d.Get("set_sensitive").(*schema.Set).List() {
+		if v := raw.(map[string]interface{})["value"].(string); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// redactSensitiveValues replaces the sensitive values found in the rendered
+// content of the release, and their base64 encoding as found in the data
+// of Secrets, so that they don't leak through the attributes.
+func redactSensitiveValues(s string, values []string) string {
+	if len(values) == 0 || s == "" {
+		return s
+	}
+
+	var oldnew []string
+	for _, v := range values {
+		oldnew = append(oldnew, base64.StdEncoding.EncodeToString([]byte(v)), sensitiveContentValue)
+	}
+	for _, v := range values {
+		oldnew = append(oldnew, v, sensitiveContentValue)
+	}
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
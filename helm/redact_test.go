@@ -0,0 +1,22 @@
+package helm
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestRedactSensitiveValues(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	d.Set("set_sensitive", []interface{}{
+		map[string]interface{}{"name": "password", "value": "hunter2", "type": ""},
+		map[string]interface{}{"name": "token", "value": "hunter2-token", "type": ""},
+	})
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	notes := "Login with hunter2, the API token is hunter2-token\npassword: " + encoded
+
+	expected := "Login with (sensitive value), the API token is (sensitive value)\npassword: (sensitive value)"
+	if got := redactSensitiveValues(notes, sensitiveValues(d)); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
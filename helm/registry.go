@@ -0,0 +1,224 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/deislabs/oras/pkg/auth/docker"
+	"github.com/deislabs/oras/pkg/content"
+	"github.com/deislabs/oras/pkg/oras"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const (
+	ociScheme = "oci://"
+
+	helmChartConfigMediaType       = "application/vnd.cncf.helm.config.v1+json"
+	helmChartContentMediaType      = "application/tar+gzip"
+	helmChartContentLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// registryOptions are the settings used to pull a chart from an OCI registry.
+type registryOptions struct {
+	plainHTTP bool
+	tls       tlsOptions
+
+	// digest pins the chart to the digest of its manifest, if the chart
+	// reference doesn't have one.
+	digest string
+}
+
+// isOCIChart reports whether the chart has to be pulled from an OCI registry.
+func isOCIChart(name string, cpo *action.ChartPathOptions) bool {
+	return strings.HasPrefix(name, ociScheme) || strings.HasPrefix(cpo.RepoURL, ociScheme)
+}
+
+// ociChartRef is the reference of a chart in an OCI registry.
+type ociChartRef struct {
+	// repository is the repository of the chart, without the oci:// scheme.
+	repository string
+	tag        string
+	digest     string
+	chartName  string
+}
+
+// String returns the registry reference of the chart.
+func (r ociChartRef) String() string {
+	s := r.repository
+	if r.tag != "" {
+		s += ":" + r.tag
+	}
+	if r.digest != "" {
+		s += "@" + r.digest
+	}
+	return s
+}
+
+// ociReference returns the registry reference of the chart. The chart can
+// be pinned to the digest of its manifest with the name@sha256:... syntax,
+// otherwise the version is used as the tag.
+func ociReference(name string, cpo *action.ChartPathOptions) (ociChartRef, error) {
+	ref := name
+	if cpo.RepoURL != "" && !strings.HasPrefix(name, ociScheme) {
+		ref = strings.TrimSuffix(cpo.RepoURL, "/") + "/" + name
+	}
+	ref = strings.TrimPrefix(ref, ociScheme)
+
+	r := ociChartRef{repository: ref}
+	if i := strings.Index(ref, "@"); i != -1 {
+		d, err := digest.Parse(ref[i+1:])
+		if err != nil {
+			return ociChartRef{}, fmt.Errorf("invalid digest in chart %q: %v", name, err)
+		}
+		r.repository, r.digest = ref[:i], d.String()
+	}
+
+	r.chartName = r.repository[strings.LastIndex(r.repository, "/")+1:]
+	if strings.Contains(r.chartName, ":") {
+		return ociChartRef{}, fmt.Errorf("chart %q must not contain a tag, use the version attribute instead", name)
+	}
+
+	version := strings.TrimSpace(cpo.Version)
+	if version == "" && r.digest == "" {
+		return ociChartRef{}, fmt.Errorf("a version or a digest is required to pull chart %q from an OCI registry", name)
+	}
+
+	// OCI tags can't contain "+", Helm replaces it with "_".
+	r.tag = strings.Replace(version, "+", "_", -1)
+	return r, nil
+}
+
+// ociResolver returns the resolver of the registry of the chart. The
+// registry credentials are read from the Helm registry config file.
+func ociResolver(m *Meta, ref ociChartRef, opts registryOptions) (remotes.Resolver, error) {
+	tlsConfig, err := newTLSConfig(resolveTLSOptions(m.RepositoryTLS, opts.tls, ociScheme+ref.repository))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create TLS config for client")
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if m.RepositoryProxy != nil {
+		proxy, err = m.RepositoryProxy.ProxyFunc()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := docker.NewClient(m.Settings.RegistryConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load the registry config")
+	}
+
+	return client.Resolver(context.Background(), &http.Client{
+		Transport: &http.Transport{
+			Proxy:           proxy,
+			TLSClientConfig: tlsConfig,
+		},
+	}, opts.plainHTTP)
+}
+
+// resolveOCIDigest returns the digest of the manifest of the chart.
+func resolveOCIDigest(m *Meta, name string, cpo *action.ChartPathOptions, opts registryOptions) (string, error) {
+	ref, err := ociReference(name, cpo)
+	if err != nil {
+		return "", err
+	}
+	if ref.digest != "" {
+		return ref.digest, nil
+	}
+
+	resolver, err := ociResolver(m, ref, opts)
+	if err != nil {
+		return "", err
+	}
+
+	_, desc, err := resolver.Resolve(context.Background(), ref.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve %q", ref)
+	}
+	return desc.Digest.String(), nil
+}
+
+// pullOCIChart pulls the chart from an OCI registry into the repository
+// cache and returns its path.
+func pullOCIChart(m *Meta, name string, cpo *action.ChartPathOptions, opts registryOptions) (string, error) {
+	ref, err := ociReference(name, cpo)
+	if err != nil {
+		return "", err
+	}
+	if ref.digest == "" {
+		ref.digest = opts.digest
+	}
+
+	// The charts pinned by digest are immutable.
+	var cacheKey string
+	if m.ChartCache != nil && ref.digest != "" {
+		cacheKey = chartCacheKey(ref.String())
+		if path, ok := m.ChartCache.get(cacheKey); ok {
+			return path, nil
+		}
+	}
+
+	resolver, err := ociResolver(m, ref, opts)
+	if err != nil {
+		return "", err
+	}
+
+	debug("pulling chart %q from OCI registry", ref)
+
+	store := content.NewMemoryStore()
+	_, layers, err := oras.Pull(context.Background(), resolver, ref.String(), store,
+		oras.WithPullEmptyNameAllowed(),
+		oras.WithAllowedMediaTypes([]string{
+			helmChartConfigMediaType,
+			helmChartContentMediaType,
+			helmChartContentLayerMediaType,
+		}))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to pull %q", ref)
+	}
+
+	var data []byte
+	for _, layer := range layers {
+		if layer.MediaType != helmChartContentMediaType && layer.MediaType != helmChartContentLayerMediaType {
+			continue
+		}
+		_, b, ok := store.Get(layer)
+		if ok {
+			data = b
+			break
+		}
+	}
+	if data == nil {
+		return "", errors.Errorf("%q does not contain a Helm chart", ref)
+	}
+
+	if err := os.MkdirAll(m.Settings.RepositoryCache, 0755); err != nil {
+		return "", err
+	}
+
+	version := strings.TrimSpace(cpo.Version)
+	if version == "" {
+		version = strings.Replace(ref.digest, ":", "-", 1)
+	}
+	filename := filepath.Join(m.Settings.RepositoryCache, fmt.Sprintf("%s-%s.tgz", ref.chartName, version))
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return "", err
+	}
+
+	if cacheKey != "" {
+		if _, err := m.ChartCache.put(cacheKey, filename); err != nil {
+			debug("Unable to cache the chart %s: %s", filename, err)
+		}
+	}
+
+	return filepath.Abs(filename)
+}
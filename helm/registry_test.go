@@ -0,0 +1,76 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+func TestOCIReference(t *testing.T) {
+	const digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name    string
+		cpo     action.ChartPathOptions
+		ref     string
+		chart   string
+		wantErr bool
+	}{
+		{
+			name:  "oci://registry.local:5000/charts/nginx",
+			cpo:   action.ChartPathOptions{Version: "1.2.3"},
+			ref:   "registry.local:5000/charts/nginx:1.2.3",
+			chart: "nginx",
+		},
+		{
+			name:  "nginx",
+			cpo:   action.ChartPathOptions{RepoURL: "oci://registry.local/charts/", Version: "1.2.3+build"},
+			ref:   "registry.local/charts/nginx:1.2.3_build",
+			chart: "nginx",
+		},
+		{
+			name:  "oci://registry.local/charts/nginx@" + digest,
+			cpo:   action.ChartPathOptions{},
+			ref:   "registry.local/charts/nginx@" + digest,
+			chart: "nginx",
+		},
+		{
+			name:  "nginx@" + digest,
+			cpo:   action.ChartPathOptions{RepoURL: "oci://registry.local/charts", Version: "1.2.3"},
+			ref:   "registry.local/charts/nginx:1.2.3@" + digest,
+			chart: "nginx",
+		},
+		{
+			name:    "oci://registry.local/charts/nginx@sha256:invalid",
+			cpo:     action.ChartPathOptions{},
+			wantErr: true,
+		},
+		{
+			name:    "oci://registry.local/charts/nginx",
+			cpo:     action.ChartPathOptions{},
+			wantErr: true,
+		},
+		{
+			name:    "oci://registry.local/charts/nginx:1.2.3",
+			cpo:     action.ChartPathOptions{Version: "1.2.3"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		ref, err := ociReference(tt.name, &tt.cpo)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ref.String() != tt.ref || ref.chartName != tt.chart {
+			t.Errorf("%s: expected %q (%q), got %q (%q)", tt.name, tt.ref, tt.chart, ref, ref.chartName)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/plugin"
+)
+
+func resourcePlugin() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourcePluginCreate,
+		ReadContext:   resourcePluginRead,
+		UpdateContext: resourcePluginUpdate,
+		DeleteContext: resourcePluginDelete,
+		Schema: map[string]*schema.Schema{
+			"url": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The location of the plugin: a git repository, the URL of a .tar.gz or .tgz archive, or a local directory.",
+			},
+			"version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The tag or branch of the git repository to install.",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The name of the plugin.",
+			},
+			"installed_version": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The version of the installed plugin.",
+			},
+			"description": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The description of the plugin.",
+			},
+			"path": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The directory the plugin is installed into.",
+			},
+		},
+	}
+}
+
+func resourcePluginCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	p, err := installPlugin(m, d.Get("url").(string), d.Get("version").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := runPluginHook(m, p, plugin.Install); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(p.Metadata.Name)
+	return diag.FromErr(setPluginAttributes(d, p))
+}
+
+func resourcePluginRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	p, err := plugin.LoadDir(filepath.Join(m.Settings.PluginsDirectory, d.Id()))
+	if os.IsNotExist(errors.Cause(err)) {
+		log.Printf("[WARN] Plugin %s not found, removing it from the state", d.Id())
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return diag.FromErr(setPluginAttributes(d, p))
+}
+
+func resourcePluginUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	if err := removePlugin(filepath.Join(m.Settings.PluginsDirectory, d.Id())); err != nil {
+		return diag.FromErr(err)
+	}
+
+	p, err := installPlugin(m, d.Get("url").(string), d.Get("version").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := runPluginHook(m, p, plugin.Update); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(p.Metadata.Name)
+	return diag.FromErr(setPluginAttributes(d, p))
+}
+
+func resourcePluginDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	m := meta.(*Meta)
+
+	p, err := plugin.LoadDir(filepath.Join(m.Settings.PluginsDirectory, d.Id()))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Like helm plugin uninstall, the hook runs once the plugin is removed.
+	if err := removePlugin(p.Dir); err != nil {
+		return diag.FromErr(err)
+	}
+	return diag.FromErr(runPluginHook(m, p, plugin.Delete))
+}
+
+func setPluginAttributes(d *schema.ResourceData, p *plugin.Plugin) error {
+	if err := d.Set("name", p.Metadata.Name); err != nil {
+		return err
+	}
+	if err := d.Set("installed_version", p.Metadata.Version); err != nil {
+		return err
+	}
+	if err := d.Set("description", p.Metadata.Description); err != nil {
+		return err
+	}
+	return d.Set("path", p.Dir)
+}
+
+// installPlugin installs the plugin into the plugins directory, as helm
+// plugin install does: the local directories are linked, the archives are
+// downloaded and extracted, and the other sources are cloned with git.
+func installPlugin(m *Meta, source, version string) (*plugin.Plugin, error) {
+	pluginsDir := m.Settings.PluginsDirectory
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		return nil, err
+	}
+
+	if fi, err := os.Stat(source); err == nil && fi.IsDir() {
+		src, err := filepath.Abs(source)
+		if err != nil {
+			return nil, err
+		}
+		p, err := loadPlugin(src)
+		if err != nil {
+			return nil, err
+		}
+		dst := filepath.Join(pluginsDir, p.Metadata.Name)
+		if err := os.Symlink(src, dst); err != nil {
+			return nil, errors.Wrapf(err, "failed to install plugin %s", p.Metadata.Name)
+		}
+		return plugin.LoadDir(dst)
+	}
+
+	// The plugin is staged in the plugins directory, to be moved in place
+	// once its name is known.
+	staging, err := ioutil.TempDir(pluginsDir, ".install-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if isPluginArchive(source) {
+		err = downloadPluginArchive(m, source, staging)
+	} else {
+		err = clonePlugin(source, version, staging)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := pluginRoot(staging)
+	if err != nil {
+		return nil, err
+	}
+	p, err := loadPlugin(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := filepath.Join(pluginsDir, p.Metadata.Name)
+	if _, err := os.Lstat(dst); err == nil {
+		return nil, fmt.Errorf("plugin %s already exists in %s", p.Metadata.Name, pluginsDir)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return nil, errors.Wrapf(err, "failed to install plugin %s", p.Metadata.Name)
+	}
+	return plugin.LoadDir(dst)
+}
+
+// loadPlugin loads the plugin of the directory, checking its name can be
+// used as directory name.
+func loadPlugin(dir string) (*plugin.Plugin, error) {
+	p, err := plugin.LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if name := p.Metadata.Name; name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid plugin name %q", name)
+	}
+	return p, nil
+}
+
+// isPluginArchive reports whether the source is the URL of an archive.
+func isPluginArchive(source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return strings.HasSuffix(u.Path, ".tar.gz") || strings.HasSuffix(u.Path, ".tgz")
+}
+
+// downloadPluginArchive downloads the archive of the plugin with the
+// getters of the provider, and extracts it into the directory.
+func downloadPluginArchive(m *Meta, source, dir string) error {
+	getters, err := m.getters(&action.ChartPathOptions{}, tlsOptions{}, httpAuth{})
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	g, err := getters.ByScheme(u.Scheme)
+	if err != nil {
+		return err
+	}
+
+	data, err := g.Get(source)
+	if err != nil {
+		return errors.Wrapf(err, "failed to download plugin %s", source)
+	}
+	return errors.Wrapf(extractTarGz(data, dir), "failed to extract plugin %s", source)
+}
+
+// extractTarGz extracts the regular files and the directories of the
+// archive into the directory.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(header.Mode)&0755|0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// clonePlugin clones the git repository of the plugin into the directory,
+// at the tag or branch if set.
+func clonePlugin(source, version, dir string) error {
+	args := []string{"clone", "--depth", "1"}
+	if version != "" {
+		args = append(args, "--branch", version)
+	}
+	args = append(args, "--", source, filepath.Join(dir, "plugin"))
+
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to clone plugin %s: %s", source, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// pluginRoot returns the directory of the extracted plugin: the directory
+// holding the plugin.yaml file, at the root or in a single directory.
+func pluginRoot(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, plugin.PluginFileName)); err == nil {
+		return dir, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		sub := filepath.Join(dir, entries[0].Name())
+		if _, err := os.Stat(filepath.Join(sub, plugin.PluginFileName)); err == nil {
+			return sub, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in the plugin", plugin.PluginFileName)
+}
+
+// removePlugin removes the plugin directory, or the link to it.
+func removePlugin(dir string) error {
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+// runPluginHook runs the hook of the plugin for the event, with the
+// environment Helm sets for the plugins.
+func runPluginHook(m *Meta, p *plugin.Plugin, event string) error {
+	hook := p.Metadata.Hooks[event]
+	if hook == "" {
+		return nil
+	}
+
+	env := m.Settings.EnvVars()
+	env["HELM_PLUGIN_NAME"] = p.Metadata.Name
+	env["HELM_PLUGIN_DIR"] = p.Dir
+
+	cmd := exec.Command("sh", "-c", hook)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	debug("Running the %s hook of plugin %s: %s", event, p.Metadata.Name, hook)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "the %s hook of plugin %s failed: %s", event, p.Metadata.Name, bytes.TrimSpace(out))
+	}
+	debug("%s", out)
+	return nil
+}
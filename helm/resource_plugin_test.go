@@ -0,0 +1,105 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/plugin"
+)
+
+func pluginArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInstallPluginArchive(t *testing.T) {
+	archive := pluginArchive(t, map[string]string{
+		"helm-test/plugin.yaml": `name: test
+version: 0.1.0
+description: A test plugin
+command: $HELM_PLUGIN_DIR/test.sh
+hooks:
+  install: touch $HELM_PLUGIN_DIR/installed
+`,
+		"helm-test/test.sh": "#!/bin/sh\necho test\n",
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Meta{Settings: cli.New()}
+	m.Settings.PluginsDirectory = dir
+
+	p, err := installPlugin(m, server.URL+"/helm-test-0.1.0.tar.gz", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Dir != filepath.Join(dir, "test") || p.Metadata.Version != "0.1.0" {
+		t.Errorf("unexpected plugin %s %s", p.Dir, p.Metadata.Version)
+	}
+	if _, err := os.Stat(filepath.Join(p.Dir, "test.sh")); err != nil {
+		t.Error(err)
+	}
+
+	if err := runPluginHook(m, p, plugin.Install); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(p.Dir, "installed")); err != nil {
+		t.Errorf("expected the install hook to run: %s", err)
+	}
+
+	if _, err := installPlugin(m, server.URL+"/helm-test-0.1.0.tar.gz", ""); err == nil {
+		t.Error("expected an error installing the plugin twice")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the staging directories to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestExtractTarGzIllegalPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := pluginArchive(t, map[string]string{"../evil": "evil"})
+	if err := extractTarGz(bytes.NewReader(archive), dir); err == nil {
+		t.Error("expected an error extracting a file outside of the directory")
+	}
+}
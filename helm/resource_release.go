@@ -1,15 +1,22 @@
 package helm
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
@@ -18,10 +25,14 @@ import (
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/downloader"
-	"helm.sh/helm/v3/pkg/getter"
-	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/provenance"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
 	"helm.sh/helm/v3/pkg/strvals"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/yaml"
 )
 
@@ -30,27 +41,58 @@ var errReleaseNotFound = errors.New("release not found")
 
 // defaultAttributes release attribute values
 var defaultAttributes = map[string]interface{}{
-	"verify":                     false,
-	"timeout":                    300,
-	"wait":                       true,
-	"disable_webhooks":           false,
-	"atomic":                     false,
-	"render_subchart_notes":      true,
-	"disable_openapi_validation": false,
-	"disable_crd_hooks":          false,
-	"force_update":               false,
-	"reset_values":               false,
-	"reuse_values":               false,
-	"recreate_pods":              false,
-	"max_history":                0,
-	"skip_crds":                  false,
-	"cleanup_on_fail":            false,
-	"dependency_update":          false,
-	"replace":                    false,
-	"create_namespace":           false,
-	"lint":                       false,
+	"verify":                      false,
+	"timeout":                     300,
+	"wait":                        true,
+	"disable_webhooks":            false,
+	"disable_hooks":               false,
+	"atomic":                      false,
+	"render_subchart_notes":       true,
+	"disable_openapi_validation":  false,
+	"disable_crd_hooks":           false,
+	"hook_log_lines":              20,
+	"force_update":                false,
+	"force_policy":                forcePolicyNever,
+	"rollout_restart":             false,
+	"reset_values":                false,
+	"reuse_values":                false,
+	"reset_then_reuse_values":     false,
+	"recreate_pods":               false,
+	"max_history":                 0,
+	"skip_crds":                   false,
+	"upgrade_crds":                false,
+	"keep_crds_on_destroy":        false,
+	"install_crds_first":          false,
+	"cleanup_on_fail":             false,
+	"dependency_update":           false,
+	"dependency_build":            false,
+	"replace":                     false,
+	"create_namespace":            false,
+	"delete_namespace_on_destroy": false,
+	"wait_for_delete":             false,
+	"uninstall_on_destroy":        true,
+	"delete_kept_resources":       false,
+	"delete_pvcs_on_destroy":      false,
+	"upgrade_install":             false,
+	"pending_repair":              pendingRepairFail,
+	"take_ownership":              false,
+	"skip_repo_update":            false,
+	"rename_in_place":             false,
+	"lint":                        false,
+	"validate_manifests":          false,
+	"check_removed_apis":          false,
+	"repair_removed_apis":         false,
+	"plain_http":                  false,
+	"insecure_skip_tls_verify":    false,
+	"pass_credentials":            false,
+	"manifest_storage":            manifestStorageNone,
+	"include_prereleases":         false,
+	"version_locked":              false,
 }
 
+// setValueTypes are the types of the values of the set blocks.
+var setValueTypes = []string{"auto", "string", "int", "float", "bool", "json"}
+
 func resourceRelease() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceReleaseCreate,
@@ -61,12 +103,31 @@ func resourceRelease() *schema.Resource {
 			StateContext: resourceHelmReleaseImportState,
 		},
 		CustomizeDiff: resourceDiff,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(unsetOperationTimeout),
+			Update: schema.DefaultTimeout(unsetOperationTimeout),
+			Delete: schema.DefaultTimeout(unsetOperationTimeout),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"generate_name", "name_template"},
+				Description:   "Release name.",
+			},
+			"generate_name": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"name_template"},
+				Description:   "Generate the release name from the chart name",
+			},
+			"name_template": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				ForceNew:    true,
-				Description: "Release name.",
+				Description: "The template used to generate the release name",
 			},
 			"repository": {
 				Type:        schema.TypeString,
@@ -99,16 +160,93 @@ func resourceRelease() *schema.Resource {
 				Sensitive:   true,
 				Description: "Password for HTTP basic authentication",
 			},
+			"repository_token": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"repository_username", "repository_password"},
+				Description:   "Bearer token for HTTP authentication, instead of basic authentication.",
+			},
+			"repository_headers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "HTTP headers sent when downloading the chart, e.g. to authenticate against GitHub or GitLab.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"pass_credentials": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["pass_credentials"],
+				Description: "Pass the credentials of the repository to the other hosts its index links the charts to.",
+			},
+			"repository_client_certificate": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "PEM-encoded client certificate for TLS authentication against the repository. Takes precedence over `repository_cert_file`.",
+			},
+			"repository_client_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "PEM-encoded client key for TLS authentication against the repository. Takes precedence over `repository_key_file`.",
+			},
+			"repository_ca_certificate": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "PEM-encoded CA certificate of the repository. Takes precedence over `repository_ca_file`.",
+			},
+			"plain_http": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["plain_http"],
+				Description: "Use insecure HTTP connections when pulling the chart from an OCI registry.",
+			},
+			"insecure_skip_tls_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["insecure_skip_tls_verify"],
+				Description: "Skip the TLS certificate verification of the chart repository or OCI registry.",
+			},
 			"chart": {
 				Type:        schema.TypeString,
 				Required:    true,
 				Description: "Chart name to be installed. A path may be used.",
 			},
+			"chart_sha256": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^((sha256:)?[0-9a-fA-F]{64})?$`), "must be a SHA256 digest"),
+				Description:  "The SHA256 digest of the archive of the chart, to verify the chart URLs.",
+			},
 			"version": {
 				Type:        schema.TypeString,
 				Optional:    true,
 				Computed:    true,
-				Description: "Specify the exact chart version to install. If this is not specified, the latest version is installed.",
+				Description: "Specify the exact chart version, or a version constraint, to install. If this is not specified, the latest version is installed.",
+			},
+			"rollback_to_revision": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Roll the release back to this revision when it is changed, instead of upgrading it",
+			},
+			"include_prereleases": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["include_prereleases"],
+				Description: "Match the prerelease versions of the chart with the version constraint, or install the latest prerelease if version is not set",
+			},
+			"version_locked": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["version_locked"],
+				Description: "Fail the plan instead of changing the version of the installed chart, unless the change is requested with the version attribute",
+			},
+			"resolved_version": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The version of the chart resolved from the version constraint during the plan.",
 			},
 			"devel": {
 				Type:        schema.TypeBool,
@@ -119,11 +257,49 @@ func resourceRelease() *schema.Resource {
 					return d.Get("version").(string) != ""
 				},
 			},
+			"local_chart_digest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "SHA256 digest of the chart contents when chart is a local directory, used to detect changes to the chart files.",
+			},
 			"values": {
 				Type:        schema.TypeList,
 				Optional:    true,
 				Description: "List of values in raw yaml format to pass to helm.",
 				Elem:        &schema.Schema{Type: schema.TypeString},
+				// The values changed at the ignored paths don't upgrade the
+				// release.
+				DiffSuppressFunc: suppressIgnoredValues,
+			},
+			"ignore_value_paths": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Paths of the values changed outside of Terraform, kept as deployed on upgrade and ignored in the values entries.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"values_merge": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "How the values entries are merged.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"maps": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      mapMergeDeep,
+							ValidateFunc: validation.StringInSlice([]string{mapMergeDeep, mapMergeReplace}, false),
+							Description:  "Merge the maps recursively, or replace them.",
+						},
+						"lists": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      listMergeReplace,
+							ValidateFunc: validation.StringInSlice([]string{listMergeReplace, listMergeAppend}, false),
+							Description:  "Replace the lists, or append to them.",
+						},
+					},
+				},
 			},
 			"set": {
 				Type:        schema.TypeSet,
@@ -144,9 +320,7 @@ func resourceRelease() *schema.Resource {
 							Optional: true,
 							// TODO: use ValidateDiagFunc once an SDK v2 version of StringInSlice exists.
 							// https://github.com/hashicorp/terraform-plugin-sdk/issues/534
-							ValidateFunc: validation.StringInSlice([]string{
-								"auto", "string",
-							}, false),
+							ValidateFunc: validation.StringInSlice(setValueTypes, false),
 						},
 					},
 				},
@@ -167,15 +341,19 @@ func resourceRelease() *schema.Resource {
 							Sensitive: true,
 						},
 						"type": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ValidateFunc: validation.StringInSlice([]string{
-								"auto", "string",
-							}, false),
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(setValueTypes, false),
 						},
 					},
 				},
 			},
+			"unset": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Keys of the values to remove, along with the defaults of the chart for them.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
 			"namespace": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -183,6 +361,11 @@ func resourceRelease() *schema.Resource {
 				Description: "Namespace to install the release into.",
 				DefaultFunc: schema.EnvDefaultFunc("HELM_NAMESPACE", "default"),
 			},
+			"storage_namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Namespace to store the revisions of the release in, instead of the namespace of the release. Defaults to the storage_namespace of the provider.",
+			},
 			"verify": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -205,18 +388,64 @@ func resourceRelease() *schema.Resource {
 				Default:     defaultAttributes["timeout"],
 				Description: "Time in seconds to wait for any individual kubernetes operation.",
 			},
+			"install_timeout": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Time in seconds for the install, upgrade or rollback of the release, instead of timeout.",
+			},
+			"wait_timeout": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Time in seconds to wait for the resources of the release to be ready, instead of the timeout of the operation.",
+			},
+			"hook_timeout": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Time in seconds to wait for each hook of the release to complete, instead of the timeout of the operation.",
+			},
 			"disable_webhooks": {
 				Type:        schema.TypeBool,
 				Optional:    true,
 				Default:     defaultAttributes["disable_webhooks"],
 				Description: "Prevent hooks from running.",
 			},
+			"disable_hooks": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["disable_hooks"],
+				Description: "Prevent hooks from running, including on uninstall. See helm install --no-hooks",
+			},
+			"skip_hooks": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice(hookEvents, false),
+				},
+				Description: "The events of the hooks which must not run, e.g. pre-upgrade.",
+			},
+			"hook_delete_policy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(hookDeletePolicies, false),
+				Description:  "Override the hook-delete-policy of the hooks of the chart: keep, keep-failed or delete.",
+			},
 			"disable_crd_hooks": {
 				Type:        schema.TypeBool,
 				Optional:    true,
 				Default:     defaultAttributes["disable_crd_hooks"],
 				Description: "Prevent CRD hooks from, running, but run other hooks.  See helm install --no-crd-hook",
 			},
+			"hook_log_lines": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      defaultAttributes["hook_log_lines"],
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Number of lines of the logs of the pods of the failed hooks reported in the error, 0 to disable.",
+			},
 			"reuse_values": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -229,11 +458,33 @@ func resourceRelease() *schema.Resource {
 				Description: "When upgrading, reset the values to the ones built into the chart",
 				Default:     defaultAttributes["reset_values"],
 			},
+			"reset_then_reuse_values": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Description:   "When upgrading, reset the values to the ones built into the chart, apply the last release's values and merge in any overrides",
+				Default:       defaultAttributes["reset_then_reuse_values"],
+				ConflictsWith: []string{"reuse_values", "reset_values"},
+			},
 			"force_update": {
 				Type:        schema.TypeBool,
 				Optional:    true,
 				Default:     defaultAttributes["force_update"],
 				Description: "Force resource update through delete/recreate if needed.",
+				Deprecated:  "Use force_policy instead.",
+			},
+			"force_policy": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       defaultAttributes["force_policy"],
+				ValidateFunc:  validation.StringInSlice([]string{forcePolicyNever, forcePolicyAlways, forcePolicyOnConflict}, false),
+				ConflictsWith: []string{"force_update"},
+				Description:   "When to force the update of the resources through their replacement: never, always, or on_conflict to replace them only when the upgrade changes immutable fields.",
+			},
+			"rollout_restart": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["rollout_restart"],
+				Description: "Restart the Deployments, StatefulSets and DaemonSets left unchanged by the upgrade, as kubectl rollout restart does.",
 			},
 			"recreate_pods": {
 				Type:        schema.TypeBool,
@@ -248,10 +499,11 @@ func resourceRelease() *schema.Resource {
 				Description: "Allow deletion of new resources created in this upgrade when upgrade fails",
 			},
 			"max_history": {
-				Type:        schema.TypeInt,
-				Optional:    true,
-				Default:     defaultAttributes["max_history"],
-				Description: "Limit the maximum number of revisions saved per release. Use 0 for no limit",
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      defaultAttributes["max_history"],
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Limit the maximum number of revisions saved per release. Use 0 for no limit",
 			},
 			"atomic": {
 				Type:        schema.TypeBool,
@@ -265,6 +517,31 @@ func resourceRelease() *schema.Resource {
 				Default:     defaultAttributes["skip_crds"],
 				Description: "If set, no CRDs will be installed. By default, CRDs are installed if not already present",
 			},
+			"upgrade_crds": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["upgrade_crds"],
+				Description: "If set, the CRDs of the chart are applied with server-side apply on upgrade. By default, Helm only creates the CRDs which are missing",
+			},
+			"crd_policy": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ValidateFunc:  validation.StringInSlice(crdPolicies, false),
+				ConflictsWith: []string{"skip_crds", "upgrade_crds"},
+				Description:   "How the CRDs of the crds/ directory of the chart are handled: skip, create, create-and-upgrade or fail-if-missing",
+			},
+			"install_crds_first": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["install_crds_first"],
+				Description: "Apply the CRDs rendered from the templates of the chart, and wait for them to be established, before installing or upgrading the rest of the release.",
+			},
+			"keep_crds_on_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["keep_crds_on_destroy"],
+				Description: "If set, the CRDs rendered by the templates of the chart are left on the cluster when the release is destroyed",
+			},
 			"render_subchart_notes": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -294,6 +571,18 @@ func resourceRelease() *schema.Resource {
 				Default:     defaultAttributes["dependency_update"],
 				Description: "Run helm dependency update before installing the chart",
 			},
+			"dependency_build": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["dependency_build"],
+				Description: "Run helm dependency build before installing a local chart, even if its dependencies are in its charts directory.",
+			},
+			"skip_repo_update": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["skip_repo_update"],
+				Description: "Use the index of the repository downloaded by the previous runs rather than refreshing it, and don't refresh the repositories when updating the dependencies",
+			},
 			"replace": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -314,6 +603,91 @@ func resourceRelease() *schema.Resource {
 				Default:     defaultAttributes["create_namespace"],
 				Description: "Create the namespace if it does not exist",
 			},
+			"namespace_labels": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Labels of the namespace created by create_namespace",
+			},
+			"namespace_annotations": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Annotations of the namespace created by create_namespace",
+			},
+			"delete_namespace_on_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["delete_namespace_on_destroy"],
+				Description: "Delete the namespace created by create_namespace when the release is destroyed",
+			},
+			"uninstall_on_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["uninstall_on_destroy"],
+				Description: "Uninstall the release when it is destroyed. If false, the release is abandoned: it is only removed from the state, and keeps running",
+			},
+			"delete_kept_resources": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["delete_kept_resources"],
+				Description: "Delete the resources annotated with helm.sh/resource-policy: keep when the release is destroyed, instead of leaving them on the cluster",
+			},
+			"wait_for_delete": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["wait_for_delete"],
+				Description: "Wait on destroy until the resources of the release are deleted, the resources held by finalizers included",
+			},
+			"delete_pvcs_on_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["delete_pvcs_on_destroy"],
+				Description: "Delete the persistent volume claims of the StatefulSets of the release when it is destroyed",
+			},
+			"release_labels": {
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: validateReleaseLabels,
+				Description:  "Labels of the release, set on the Secrets or ConfigMaps storing its revisions",
+			},
+			"release_annotations": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Annotations set on the Secrets or ConfigMaps storing the revisions of the release",
+			},
+			"cascade": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      cascadeBackground,
+				ValidateFunc: validation.StringInSlice([]string{cascadeBackground, cascadeForeground, cascadeOrphan}, false),
+				Description:  "The deletion cascade of the resources of the release on destroy: background, foreground or orphan",
+			},
+			"namespace_created": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the namespace was created by the provider",
+			},
+			"take_ownership": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["take_ownership"],
+				Description: "If set, the existing resources which are not owned by the release are adopted instead of failing the install or the upgrade",
+			},
+			"rename_in_place": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["rename_in_place"],
+				Description: "If set, changing the name of the release renames it without replacing it: the release is moved to the new name and its resources are adopted, instead of being deleted and recreated.",
+			},
+			"upgrade_install": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["upgrade_install"],
+				Description: "Upgrade the release when a release with the same name already exists on creation, instead of failing. Equivalent to `helm upgrade --install`.",
+			},
 			"postrender": {
 				Type:        schema.TypeList,
 				MaxItems:    1,
@@ -329,12 +703,273 @@ func resourceRelease() *schema.Resource {
 					},
 				},
 			},
+			"common_metadata": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Labels and annotations set on all the rendered resources.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"labels": {
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Labels set on all the rendered resources.",
+						},
+						"annotations": {
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Annotations set on all the rendered resources.",
+						},
+					},
+				},
+			},
+			"wait_for": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Limit the resources waited for when wait is set.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"kinds": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "The kinds of the resources waited for.",
+						},
+						"label_selector": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The label selector of the resources waited for.",
+						},
+					},
+				},
+			},
+			"readiness_check": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Readiness rules of the custom resources of the chart, waited for when wait is set.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"kind": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The kind of the custom resources.",
+						},
+						"api_group": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The API group of the custom resources. Defaults to any group.",
+						},
+						"condition": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "Ready",
+							Description: "The type of the condition of the ready custom resources.",
+						},
+						"status": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "True",
+							Description: "The status of the condition of the ready custom resources.",
+						},
+					},
+				},
+			},
+			"pending_repair": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      defaultAttributes["pending_repair"],
+				ValidateFunc: validation.StringInSlice([]string{pendingRepairFail, pendingRepairRollback, pendingRepairDelete}, false),
+				Description:  "How to repair the release when it is found stuck in pending-install, pending-upgrade or pending-rollback, a previous operation having been interrupted: fail, rollback to the last deployed revision, or delete the pending revision and retry.",
+			},
+			"upgrade_failure_policy": {
+				Type:          schema.TypeList,
+				MaxItems:      1,
+				Optional:      true,
+				ConflictsWith: []string{"atomic"},
+				Description:   "What to do with the release when an upgrade fails.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"action": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringInSlice([]string{upgradeFailureRollback, upgradeFailureLeave}, false),
+							Description:  "Roll the release back to the previous revision, or leave the failed revision for inspection.",
+						},
+						"rollback_on": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringInSlice([]string{upgradeFailureTimeout, upgradeFailureError}, false),
+							},
+							Description: "The classes of failures rolled back: timeout or error. Defaults to all of them.",
+						},
+					},
+				},
+			},
+			"rollout": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Upgrade the release with canary values first, and with its values once the canary is healthy.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"canary_values": {
+							Type:        schema.TypeList,
+							Required:    true,
+							MinItems:    1,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "List of values in raw yaml merged on top of the values of the release for the canary.",
+						},
+						"soak": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      60,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "Time in seconds the canary must stay healthy before the release is upgraded with its values.",
+						},
+						"rollback": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+							Description: "Roll the release back to the previous revision if the canary fails.",
+						},
+					},
+				},
+			},
+			"retry": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Retry the chart download, the installation and the upgrade when they fail with a transient error.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"attempts": {
+							Type:         schema.TypeInt,
+							Required:     true,
+							ValidateFunc: validation.IntAtLeast(1),
+							Description:  "Maximum number of attempts.",
+						},
+						"initial_backoff": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      5,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "Time in seconds to wait before the first retry, doubled after each attempt.",
+						},
+						"max_backoff": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      60,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "Maximum time in seconds to wait between two attempts.",
+						},
+					},
+				},
+			},
 			"lint": {
 				Type:        schema.TypeBool,
 				Optional:    true,
 				Default:     defaultAttributes["lint"],
 				Description: "Run helm lint when planning",
 			},
+			"validate_manifests": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["validate_manifests"],
+				Description: "Validate the rendered manifests against the OpenAPI schemas of the cluster when planning.",
+			},
+			"check_removed_apis": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["check_removed_apis"],
+				Description: "Check the rendered manifests and the manifest of the deployed release for the API versions removed from the cluster when planning.",
+			},
+			"repair_removed_apis": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     defaultAttributes["repair_removed_apis"],
+				Description: "Replace the API versions removed from the cluster in the manifest of the deployed release before upgrading it, as done by helm mapkubeapis.",
+			},
+			"policy": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Rego policies evaluated on the rendered manifests when planning.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"rego_paths": {
+							Type:        schema.TypeList,
+							Required:    true,
+							MinItems:    1,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "The paths of the Rego policies and of their data.",
+						},
+						"query": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "data.main.deny",
+							Description: "The query of the denials.",
+						},
+						"opa_binary_path": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "opa",
+							Description: "The path of the OPA binary.",
+						},
+					},
+				},
+			},
+			"chart_digest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The digest of the manifest of the chart, when it is pulled from an OCI registry.",
+			},
+			"notes": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The rendered notes of the chart.",
+			},
+			"manifest_storage": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      defaultAttributes["manifest_storage"],
+				ValidateFunc: validation.StringInSlice(manifestStorages, false),
+				Description:  "How the rendered manifest of the release is stored in the manifest attribute: none, full, compressed (gzipped and base64 encoded) or hash (its SHA256 digest).",
+			},
+			"ignore_fields": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Fields of the manifest ignored in the manifest attribute, such as those which change on every render.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"values_diff": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The changes of the merged values planned by the last upgrade, one line per changed path.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"manifest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The rendered manifest of the release, as set by manifest_storage.",
+			},
+			"output_patterns": {
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: validateOutputPatterns,
+				Description:  "Regular expressions extracting outputs from the notes of the chart. The first capture group, or the whole match, is exported.",
+			},
+			"outputs": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The values exported by the chart.",
+			},
 			"metadata": {
 				Type:        schema.TypeList,
 				Computed:    true,
@@ -376,6 +1011,26 @@ func resourceRelease() *schema.Resource {
 							Computed:    true,
 							Description: "Set of extra values, added to the chart. The sensitive data is cloaked. JSON encoded.",
 						},
+						"status": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The status of the release.",
+						},
+						"first_deployed": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The time the release was first deployed, in RFC 3339 format.",
+						},
+						"last_deployed": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The time the last revision of the release was deployed, in RFC 3339 format.",
+						},
+						"repository_url": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The URL of the repository of the chart.",
+						},
 					},
 				},
 			},
@@ -384,6 +1039,9 @@ func resourceRelease() *schema.Resource {
 }
 
 func resourceReleaseRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if diags, skip := skipUnreachableRead(d, meta.(*Meta)); skip {
+		return diags
+	}
 
 	exists, err := resourceReleaseExists(d, meta)
 	if err != nil {
@@ -404,9 +1062,8 @@ func resourceReleaseRead(ctx context.Context, d *schema.ResourceData, meta inter
 	debug("%s Started", logId)
 
 	m := meta.(*Meta)
-	n := d.Get("namespace").(string)
 
-	c, err := m.GetHelmConfiguration(n)
+	c, err := releaseHelmConfiguration(d, m, phaseRead)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -417,7 +1074,7 @@ func resourceReleaseRead(ctx context.Context, d *schema.ResourceData, meta inter
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	err = setIDAndMetadataFromRelease(d, r)
+	err = setIDAndMetadataFromRelease(d, m, r)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -426,33 +1083,86 @@ func resourceReleaseRead(ctx context.Context, d *schema.ResourceData, meta inter
 	return nil
 }
 
+// skipUnreachableRead reports whether the release is not refreshed, the
+// cluster being unreachable in template_only_plan mode. The state is kept
+// as is, with a warning.
+func skipUnreachableRead(d *schema.ResourceData, m *Meta) (diag.Diagnostics, bool) {
+	if !m.TemplateOnlyPlan {
+		return nil, false
+	}
+
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseRead)
+	if err == nil {
+		err = actionConfig.KubeClient.IsReachable()
+	}
+	if err == nil {
+		return nil, false
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Release not refreshed",
+		Detail:   fmt.Sprintf("The cluster of release %s is not reachable, its state is not refreshed: %s", d.Id(), err),
+	}}, true
+}
+
 func resourceReleaseCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	logId := fmt.Sprintf("[resourceReleaseCreate: %s]", d.Get("name").(string))
 	debug("%s Started", logId)
 
+	ctx, cancel := operationContext(ctx, d, schema.TimeoutCreate)
+	defer cancel()
+
 	m := meta.(*Meta)
-	n := d.Get("namespace").(string)
 
 	debug("%s Getting helm configuration", logId)
-	actionConfig, err := m.GetHelmConfiguration(n)
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseCreate)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	if name := d.Get("name").(string); name != "" {
+		if err := repairPendingRelease(d, actionConfig, name); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("upgrade_install").(bool) && d.Get("name").(string) != "" {
+		r, err := getRelease(m, actionConfig, d.Get("name").(string))
+		if err != nil && err != errReleaseNotFound {
+			return diag.FromErr(err)
+		}
+
+		// Uninstalled releases kept in the history can't be upgraded.
+		if err == nil && r.Info.Status != release.StatusUninstalled {
+			debug("%s Release already exists, upgrading it", logId)
+			return upgradeRelease(ctx, d, m, actionConfig, r.Version)
+		}
+	}
+
 	cpo, chartName, err := chartPathOptions(d, m)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	retryOpts := expandRetryOptions(d)
+
 	debug("%s Getting chart", logId)
-	c, path, err := getChart(d, m, chartName, cpo)
+	var c *chart.Chart
+	var path string
+	err = retry(ctx, retryOpts, logId+" Getting chart", func(int) (err error) {
+		c, path, err = getChart(d, m, chartName, cpo)
+		return err
+	})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	debug("%s Preparing for installation", logId)
+	if err := setChartDigest(d, m, chartName, cpo); err != nil {
+		return diag.FromErr(err)
+	}
+	warnings := chartSHA256Warning(d, chartName, cpo)
 
-	p := getter.All(m.Settings)
+	debug("%s Preparing for installation", logId)
 
 	values, err := getValues(d)
 	if err != nil {
@@ -466,68 +1176,114 @@ func resourceReleaseCreate(ctx context.Context, d *schema.ResourceData, meta int
 
 	updateDependency := d.Get("dependency_update").(bool)
 
-	if req := c.Metadata.Dependencies; req != nil {
-		// If CheckDependencies returns an error, we have unfulfilled dependencies.
-		// As of Helm 2.4.0, this is treated as a stopping condition:
-		// https://github.com/helm/helm/issues/2209
-		if err := action.CheckDependencies(c, req); err != nil {
-			if updateDependency {
-				man := &downloader.Manager{
-					Out:              os.Stdout,
-					ChartPath:        path,
-					Keyring:          d.Get("keyring").(string),
-					SkipUpdate:       false,
-					Getters:          p,
-					RepositoryConfig: m.Settings.RepositoryConfig,
-					RepositoryCache:  m.Settings.RepositoryCache,
-				}
-				if err := man.Update(); err != nil {
-					return diag.FromErr(err)
-				}
-			} else {
-				return diag.FromErr(err)
-			}
-		}
+	c, err = checkChartDependencies(d, c, path, m)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
+	policy := crdPolicy(d)
+
+	// Helm only prunes the history on upgrade, while the revisions of the
+	// uninstalled releases kept in the history pile up when replacing them.
+	actionConfig.Releases.MaxHistory = d.Get("max_history").(int)
+
 	client := action.NewInstall(actionConfig)
 	client.ChartPathOptions = *cpo
 	client.ClientOnly = false
 	client.DryRun = false
-	client.DisableHooks = d.Get("disable_webhooks").(bool)
+	client.DisableHooks = hooksDisabled(d, "install")
 	client.Wait = d.Get("wait").(bool)
 	client.Devel = d.Get("devel").(bool)
 	client.DependencyUpdate = updateDependency
-	client.Timeout = time.Duration(d.Get("timeout").(int)) * time.Second
+	client.Timeout = releaseTimeout(d, schema.TimeoutCreate)
 	client.Namespace = d.Get("namespace").(string)
 	client.ReleaseName = d.Get("name").(string)
-	client.GenerateName = false
-	client.NameTemplate = ""
+	client.GenerateName = d.Get("generate_name").(bool)
+	client.NameTemplate = d.Get("name_template").(string)
+
+	client.ReleaseName, _, err = client.NameAndChart([]string{chartName})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("name", client.ReleaseName); err != nil {
+		return diag.FromErr(err)
+	}
+
+	actionConfig.KubeClient, err = newWaitKubeClient(d, actionConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	actionConfig.KubeClient = newHookKubeClient(d, actionConfig.KubeClient, "install")
 	client.OutputDir = ""
 	client.Atomic = d.Get("atomic").(bool)
-	client.SkipCRDs = d.Get("skip_crds").(bool)
+	client.SkipCRDs = policy == crdPolicySkip || policy == crdPolicyFailIfMissing
 	client.SubNotes = d.Get("render_subchart_notes").(bool)
 	client.DisableOpenAPIValidation = d.Get("disable_openapi_validation").(bool)
 	client.Replace = d.Get("replace").(bool)
-	client.Description = d.Get("description").(string)
-	client.CreateNamespace = d.Get("create_namespace").(bool)
+	client.Description, err = releaseDescription(d, "install")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	// The namespace is created by ensureNamespace, with its labels and annotations.
+	client.CreateNamespace = false
 
-	if cmd := d.Get("postrender.0.binary_path").(string); cmd != "" {
-		pr, err := postrender.NewExec(cmd)
+	client.PostRenderer, err = releasePostRenderer(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.Get("create_namespace").(bool) {
+		created, err := ensureNamespace(actionConfig, client.Namespace, expandNamespaceMetadata(d))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if err := d.Set("namespace_created", created); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if policy == crdPolicyFailIfMissing {
+		if err := checkCRDs(actionConfig, c.CRDObjects()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
+	if d.Get("install_crds_first").(bool) {
+		err = retry(ctx, retryOpts, logId+" Installing CRDs", func(int) error {
+			return installTemplateCRDs(actionConfig, d, path, values, false)
+		})
 		if err != nil {
 			return diag.FromErr(err)
 		}
+	}
 
-		client.PostRenderer = pr
+	var adopted []ownershipChange
+	if d.Get("take_ownership").(bool) {
+		adopted, err = takeOwnership(actionConfig, d, path, values, false)
+		if err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	debug("%s Installing chart", logId)
 
-	rel, err := client.Run(c, values)
+	var rel *release.Release
+	err = retry(ctx, retryOpts, logId+" Installing chart", func(attempt int) (err error) {
+		if attempt > 1 {
+			// The failed attempt may have left a release behind.
+			if rel, err = prepareInstallRetry(client, actionConfig); rel != nil || err != nil {
+				return err
+			}
+		}
+		rel, err = client.Run(c, values)
+		return err
+	})
+	err = timeoutError(ctx, err, "installation", client.ReleaseName, client.Timeout)
 
 	if err != nil && rel == nil {
-		return diag.FromErr(err)
+		restoreOwnership(adopted)
+		return releaseDiagnostics(err)
 	}
 
 	if err != nil && rel != nil {
@@ -538,118 +1294,481 @@ func resourceReleaseCreate(ctx context.Context, d *schema.ResourceData, meta int
 		}
 
 		if !exists {
-			return diag.FromErr(err)
+			restoreOwnership(adopted)
+			return releaseDiagnostics(err)
 		}
 
 		debug("%s Release was created but returned an error", logId)
 
-		if err := setIDAndMetadataFromRelease(d, rel); err != nil {
+		if err := setIDAndMetadataFromRelease(d, m, rel); err != nil {
 			return diag.FromErr(err)
 		}
 
-		return nil
+		return warnings
 	}
 
-	err = setIDAndMetadataFromRelease(d, rel)
+	// The ID is set first, the release being installed even if the steps
+	// below fail.
+	err = setIDAndMetadataFromRelease(d, m, rel)
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	return nil
+
+	labels, annotations := releaseStorageMetadata(d, m)
+	if err := setReleaseMetadata(actionConfig, storageNamespace(d, m), rel, labels, annotations); err != nil {
+		return diag.FromErr(err)
+	}
+	return warnings
 }
 
 func resourceReleaseUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	ctx, cancel := operationContext(ctx, d, schema.TimeoutUpdate)
+	defer cancel()
+
 	m := meta.(*Meta)
-	n := d.Get("namespace").(string)
-	actionConfig, err := m.GetHelmConfiguration(n)
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseUpdate)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	if d.HasChange("storage_namespace") {
+		if err := moveReleaseStorageNamespace(d, m, actionConfig); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Changing how the release is stored, or how it is destroyed, doesn't
+	// upgrade it.
+	if !d.HasChangesExcept("manifest_storage", "ignore_fields", "storage_namespace",
+		"uninstall_on_destroy", "wait_for_delete", "delete_pvcs_on_destroy", "delete_kept_resources",
+		"delete_namespace_on_destroy", "cascade", "keep_crds_on_destroy") {
+		r, err := getRelease(m, actionConfig, d.Get("name").(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		return diag.FromErr(setIDAndMetadataFromRelease(d, m, r))
+	}
+
+	if err := repairPendingRelease(d, actionConfig, d.Get("name").(string)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if revision := d.Get("rollback_to_revision").(int); d.HasChange("rollback_to_revision") && revision > 0 {
+		return resourceReleaseRollbackAndUpgrade(ctx, d, m, actionConfig, revision)
+	}
+
+	previousRevision, _ := d.GetChange("metadata.0.revision")
+	return upgradeRelease(ctx, d, m, actionConfig, previousRevision.(int))
+}
+
+// upgradeRelease upgrades the release to the chart and values of the
+// configuration. It is shared by Update and by Create when upgrade_install
+// finds an existing release, previousRevision being the revision deployed
+// before the upgrade.
+func upgradeRelease(ctx context.Context, d *schema.ResourceData, m *Meta, actionConfig *action.Configuration, previousRevision int) diag.Diagnostics {
 	cpo, chartName, err := chartPathOptions(d, m)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	c, _, err := getChart(d, m, chartName, cpo)
+	retryOpts := expandRetryOptions(d)
+
+	var c *chart.Chart
+	var path string
+	err = retry(ctx, retryOpts, "[resourceReleaseUpdate] Getting chart", func(int) (err error) {
+		c, path, err = getChart(d, m, chartName, cpo)
+		return err
+	})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	if req := c.Metadata.Dependencies; req != nil {
-		if err := action.CheckDependencies(c, req); err != nil {
-			return diag.FromErr(err)
-		}
+	if err := setChartDigest(d, m, chartName, cpo); err != nil {
+		return diag.FromErr(err)
+	}
+	warnings := chartSHA256Warning(d, chartName, cpo)
+
+	c, err = checkChartDependencies(d, c, path, m)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
+	policy := crdPolicy(d)
+
 	client := action.NewUpgrade(actionConfig)
 	client.ChartPathOptions = *cpo
 	client.Devel = d.Get("devel").(bool)
 	client.Namespace = d.Get("namespace").(string)
-	client.Timeout = time.Duration(d.Get("timeout").(int)) * time.Second
+	client.Timeout = releaseTimeout(d, schema.TimeoutUpdate)
 	client.Wait = d.Get("wait").(bool)
 	client.DryRun = false
-	client.DisableHooks = d.Get("disable_webhooks").(bool)
+	client.DisableHooks = hooksDisabled(d, "upgrade")
 	client.Atomic = d.Get("atomic").(bool)
-	client.SkipCRDs = d.Get("skip_crds").(bool)
+	client.SkipCRDs = policy == crdPolicySkip || policy == crdPolicyFailIfMissing
 	client.SubNotes = d.Get("render_subchart_notes").(bool)
-	client.Force = d.Get("force_update").(bool)
+	client.Force = forcePolicy(d) == forcePolicyAlways
 	client.ResetValues = d.Get("reset_values").(bool)
 	client.ReuseValues = d.Get("reuse_values").(bool)
 	client.Recreate = d.Get("recreate_pods").(bool)
 	client.MaxHistory = d.Get("max_history").(int)
 	client.CleanupOnFail = d.Get("cleanup_on_fail").(bool)
-	client.Description = d.Get("description").(string)
+	client.Description, err = releaseDescription(d, "upgrade")
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	if cmd := d.Get("postrender.0.binary_path").(string); cmd != "" {
-		pr, err := postrender.NewExec(cmd)
+	client.PostRenderer, err = releasePostRenderer(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
+	values, err := getValues(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	name := d.Get("name").(string)
+
+	actionConfig.KubeClient, err = newWaitKubeClient(d, actionConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	actionConfig.KubeClient = newHookKubeClient(d, actionConfig.KubeClient, "upgrade")
+
+	// Helm 3.14 --reset-then-reuse-values: the values of the chart are
+	// used instead of those of the last release, but the values supplied
+	// to the last release are kept.
+	if d.Get("reset_then_reuse_values").(bool) {
+		last, err := getRelease(m, actionConfig, name)
 		if err != nil {
 			return diag.FromErr(err)
 		}
+		values = mergeMaps(last.Config, values)
+		client.ResetValues = true
+		client.ReuseValues = false
+	}
 
-		client.PostRenderer = pr
+	if paths := ignoredValuePaths(d); len(paths) > 0 {
+		last, err := getRelease(m, actionConfig, name)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		keepIgnoredValues(values, last.Config, paths)
 	}
 
-	values, err := getValues(d)
+	if d.Get("create_namespace").(bool) && (d.HasChange("namespace_labels") || d.HasChange("namespace_annotations")) {
+		if _, err := ensureNamespace(actionConfig, client.Namespace, expandNamespaceMetadata(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	switch policy {
+	case crdPolicyCreateAndUpgrade:
+		err = retry(ctx, retryOpts, "[resourceReleaseUpdate] Upgrading CRDs", func(int) error {
+			return upgradeCRDs(actionConfig, c.CRDObjects())
+		})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	case crdPolicyFailIfMissing:
+		if err := checkCRDs(actionConfig, c.CRDObjects()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("install_crds_first").(bool) {
+		err = retry(ctx, retryOpts, "[resourceReleaseUpdate] Installing CRDs", func(int) error {
+			return installTemplateCRDs(actionConfig, d, path, values, true)
+		})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// A release upgraded on create has no previous name to rename from.
+	if d.Id() != "" && d.HasChange("name") {
+		oldName, _ := d.GetChange("name")
+		if err := renameRelease(actionConfig, oldName.(string), name); err != nil {
+			return diag.FromErr(err)
+		}
+		d.SetId(name)
+	}
+
+	if d.Get("repair_removed_apis").(bool) {
+		if err := repairRemovedAPIs(actionConfig, name); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	var previous *release.Release
+	if d.Get("rollout_restart").(bool) {
+		previous, err = getRelease(m, actionConfig, name)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	rollout, err := expandRolloutOptions(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var adopted []ownershipChange
+	if d.Get("take_ownership").(bool) {
+		adopted, err = takeOwnership(actionConfig, d, path, values, true)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if rollout != nil {
+		if diags := upgradeCanary(ctx, d, actionConfig, client, name, c, values, previousRevision, rollout); diags.HasError() {
+			restoreOwnership(adopted)
+			return diags
+		}
+	}
+
+	var r *release.Release
+	err = retry(ctx, retryOpts, "[resourceReleaseUpdate] Upgrading release", func(int) (err error) {
+		r, err = client.Run(name, c, values)
+		return err
+	})
+	if err != nil && forcePolicy(d) == forcePolicyOnConflict {
+		if fields := immutableFields(err); len(fields) > 0 {
+			log.Printf("[INFO] The upgrade of release %s changes immutable fields, replacing the resources: %s", name, strings.Join(fields, ", "))
+			client.Force = true
+			r, err = client.Run(name, c, values)
+		}
+	}
+	if err != nil {
+		restoreOwnership(adopted)
+		return handleUpgradeFailure(ctx, d, actionConfig, name, previousRevision, timeoutError(ctx, immutableFieldsError(err), "upgrade", name, client.Timeout))
+	}
+
+	// The state is set first, the release being upgraded even if the steps
+	// below fail.
+	err = setIDAndMetadataFromRelease(d, m, r)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	if previous != nil {
+		if err := restartWorkloads(actionConfig, unchangedWorkloads(previous, r)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	labels, annotations := releaseStorageMetadata(d, m)
+	if err := setReleaseMetadata(actionConfig, storageNamespace(d, m), r, labels, annotations); err != nil {
+		return diag.FromErr(err)
+	}
+	return warnings
+}
+
+// resourceReleaseRollback rolls the release back to the revision, instead of
+// upgrading it.
+func resourceReleaseRollback(ctx context.Context, d *schema.ResourceData, m *Meta, actionConfig *action.Configuration, revision int) diag.Diagnostics {
 	name := d.Get("name").(string)
-	r, err := client.Run(name, c, values)
+	debug("[resourceReleaseRollback: %s] Rolling back to revision %d", name, revision)
+
+	actionConfig.Releases.MaxHistory = d.Get("max_history").(int)
+
+	client := action.NewRollback(actionConfig)
+	client.Version = revision
+	client.Timeout = releaseTimeout(d, schema.TimeoutUpdate)
+	client.Wait = d.Get("wait").(bool)
+	client.DisableHooks = hooksDisabled(d, "rollback")
+	client.Recreate = d.Get("recreate_pods").(bool)
+	client.Force = forcePolicy(d) == forcePolicyAlways
+	client.CleanupOnFail = d.Get("cleanup_on_fail").(bool)
+
+	kubeClient, err := newWaitKubeClient(d, actionConfig)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	actionConfig.KubeClient = newHookKubeClient(d, kubeClient, "rollback")
+
+	if err := client.Run(name); err != nil {
+		return releaseDiagnostics(timeoutError(ctx, err, "rollback", name, client.Timeout))
+	}
 
-	err = setIDAndMetadataFromRelease(d, r)
+	r, err := getRelease(m, actionConfig, name)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+
+	if err := setIDAndMetadataFromRelease(d, m, r); err != nil {
+		return diag.FromErr(err)
+	}
 	return nil
 }
 
+// rollbackAttributes are the attributes applying to the rollback of the
+// release, or only kept in the state: when only those change along with
+// rollback_to_revision, the release isn't upgraded after the rollback.
+var rollbackAttributes = map[string]bool{
+	"rollback_to_revision":        true,
+	"wait":                        true,
+	"wait_for":                    true,
+	"wait_timeout":                true,
+	"readiness_check":             true,
+	"timeout":                     true,
+	"install_timeout":             true,
+	"hook_timeout":                true,
+	"hook_log_lines":              true,
+	"disable_hooks":               true,
+	"disable_webhooks":            true,
+	"skip_hooks":                  true,
+	"hook_delete_policy":          true,
+	"recreate_pods":               true,
+	"force_update":                true,
+	"force_policy":                true,
+	"cleanup_on_fail":             true,
+	"max_history":                 true,
+	"pending_repair":              true,
+	"manifest_storage":            true,
+	"ignore_fields":               true,
+	"storage_namespace":           true,
+	"uninstall_on_destroy":        true,
+	"wait_for_delete":             true,
+	"delete_pvcs_on_destroy":      true,
+	"delete_kept_resources":       true,
+	"delete_namespace_on_destroy": true,
+	"cascade":                     true,
+	"keep_crds_on_destroy":        true,
+}
+
+// resourceReleaseRollbackAndUpgrade rolls the release back to the revision,
+// then upgrades it with the other changes of the configuration, if any, so
+// that none of them is dropped.
+func resourceReleaseRollbackAndUpgrade(ctx context.Context, d *schema.ResourceData, m *Meta, actionConfig *action.Configuration, revision int) diag.Diagnostics {
+	var except []string
+	for k := range rollbackAttributes {
+		except = append(except, k)
+	}
+	upgrade := d.HasChangesExcept(except...)
+
+	if diags := resourceReleaseRollback(ctx, d, m, actionConfig, revision); diags.HasError() || !upgrade {
+		return diags
+	}
+
+	debug("[resourceReleaseRollbackAndUpgrade: %s] Upgrading the release with the other changes", d.Get("name").(string))
+
+	// The kube client of the configuration is set up for the rollback.
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseUpdate)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return upgradeRelease(ctx, d, m, actionConfig, d.Get("metadata.0.revision").(int))
+}
+
 func resourceReleaseDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if !d.Get("uninstall_on_destroy").(bool) {
+		log.Printf("[INFO] Abandoning release %s, it is removed from the state but left installed", d.Get("name").(string))
+		d.SetId("")
+		return nil
+	}
+
+	ctx, cancel := operationContext(ctx, d, schema.TimeoutDelete)
+	defer cancel()
+
 	m := meta.(*Meta)
 	n := d.Get("namespace").(string)
-	actionConfig, err := m.GetHelmConfiguration(n)
+	actionConfig, err := releaseHelmConfiguration(d, m, phaseDelete)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	name := d.Get("name").(string)
+	name := d.Get("name").(string)
+
+	if d.Get("keep_crds_on_destroy").(bool) {
+		if err := keepCRDsOnUninstall(actionConfig, name); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("delete_kept_resources").(bool) {
+		if err := deleteKeptResources(actionConfig, name); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	kept, err := releaseKeptResources(actionConfig, name)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	uninstall := action.NewUninstall(actionConfig)
+	uninstall.Timeout = releaseTimeout(d, schema.TimeoutDelete)
+	uninstall.DisableHooks = hooksDisabled(d, "delete")
+	uninstall.Description, err = releaseDescription(d, "uninstall")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The resources are gathered from the manifest before it is deleted
+	// along with the release.
+	waitForDelete := d.Get("wait_for_delete").(bool)
+	var resources kube.ResourceList
+	var claims []corev1.PersistentVolumeClaim
+	if waitForDelete || d.Get("delete_pvcs_on_destroy").(bool) {
+		resources, err = releaseResources(actionConfig, name)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.Get("delete_pvcs_on_destroy").(bool) {
+		claims, err = releaseClaims(actionConfig, resources)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if cascade := d.Get("cascade").(string); cascade != cascadeBackground {
+		actionConfig.KubeClient = &cascadeKubeClient{
+			Interface:   actionConfig.KubeClient,
+			propagation: cascadePolicies[cascade],
+			timeout:     uninstall.Timeout,
+		}
+	}
+	actionConfig.KubeClient = newHookKubeClient(d, actionConfig.KubeClient, "delete")
+
+	// Helm only reports the templates of the kept resources in the Info of
+	// the response, the warning names the resources.
+	if _, err := uninstall.Run(name); err != nil {
+		return diag.FromErr(timeoutError(ctx, err, "uninstallation", name, uninstall.Timeout))
+	}
 
-	res, err := action.NewUninstall(actionConfig).Run(name)
+	var diags diag.Diagnostics
+	if len(kept) > 0 {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Resources kept on uninstall",
+			Detail: fmt.Sprintf("The following resources of release %q are annotated with %s: %s and were left on the cluster, set delete_kept_resources to delete them:\n\t%s",
+				name, kube.ResourcePolicyAnno, kube.KeepPolicy, strings.Join(kept, "\n\t")),
+		})
+	}
 
-	if err != nil {
-		return diag.FromErr(err)
+	if err := deleteReleaseClaims(actionConfig, claims, waitForDelete, uninstall.Timeout); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	if waitForDelete {
+		log.Printf("[INFO] Waiting for the resources of release %s to be deleted", name)
+		if err := waitForDeletion(resources, uninstall.Timeout); err != nil {
+			return append(diags, diag.FromErr(errors.Wrapf(err, "the resources of release %s were not deleted", name))...)
+		}
 	}
 
-	if res.Info != "" {
-		return diag.Errorf(res.Info)
+	// Only the namespaces created by the provider are deleted, never the
+	// existing ones the release was installed into.
+	if d.Get("delete_namespace_on_destroy").(bool) && d.Get("namespace_created").(bool) {
+		if err := deleteCreatedNamespace(actionConfig, n); err != nil {
+			return append(diags, diag.FromErr(err)...)
+		}
 	}
 
 	d.SetId("")
-	return nil
+	return diags
 }
 
 func resourceDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
@@ -664,18 +1783,65 @@ func resourceDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{})
 		return err
 	}
 
+	// Renaming a release replaces it, unless it is renamed in place.
+	if d.Id() != "" && d.HasChange("name") && !d.Get("rename_in_place").(bool) {
+		if err := d.ForceNew("name"); err != nil {
+			return err
+		}
+	}
+
+	if err := setValuesDiff(d); err != nil {
+		return err
+	}
+
+	if err := validateReleaseMetadataDriver(d, m); err != nil {
+		return err
+	}
+
 	cpo, chartName, err := chartPathOptions(d, m)
 	if err != nil {
 		return err
 	}
 
+	// Tags are mutable, the digest of the chart is resolved to pin the chart
+	// installed on apply, and to upgrade the release when the tag is moved.
+	if isOCIChart(chartName, cpo) && !m.Offline {
+		digest, err := resolveOCIDigest(m, chartName, cpo, registryOptions{
+			plainHTTP: d.Get("plain_http").(bool),
+			tls:       releaseTLSOptions(d, cpo),
+		})
+		if err != nil {
+			debug("%s Failed to resolve the chart digest: %s", logId, err)
+			return d.SetNewComputed("chart_digest")
+		}
+		if err := d.SetNew("chart_digest", digest); err != nil {
+			return err
+		}
+	}
+
 	// Get Chart metadata, if we fail - we're done
-	c, _, err := getChart(d, meta.(*Meta), chartName, cpo)
+	c, path, err := getChart(d, meta.(*Meta), chartName, cpo)
 	if err != nil {
 		return nil
 	}
 	debug("%s Got chart", logId)
 
+	// Local chart directories can change without a version bump, so we keep
+	// track of their contents to be able to trigger an upgrade.
+	if isLocalChartDir(path) {
+		if err := verifyChartLock(c, m); err != nil {
+			return err
+		}
+
+		digest, err := localChartDigest(c)
+		if err != nil {
+			return err
+		}
+		if err := d.SetNew("local_chart_digest", digest); err != nil {
+			return err
+		}
+	}
+
 	// Validates the resource configuration, the values, the chart itself, and
 	// the combination of both.
 	//
@@ -686,25 +1852,47 @@ func resourceDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{})
 			return err
 		}
 	}
+	if manifestChecksEnabled(d) && !m.Offline {
+		if err := checkManifests(d, m, c); err != nil {
+			return err
+		}
+	}
+	if err := checkSubchartValues(d, path); err != nil {
+		return err
+	}
 	debug("%s Release validated", logId)
 
+	if err := checkVersionLocked(d, c); err != nil {
+		return err
+	}
+
 	// Set desired version from the Chart metadata if available
 	if len(c.Metadata.Version) > 0 {
+		if err := d.SetNew("resolved_version", c.Metadata.Version); err != nil {
+			return err
+		}
 		return d.SetNew("version", c.Metadata.Version)
 	}
 
 	debug("%s Done", logId)
 
+	if err := d.SetNewComputed("resolved_version"); err != nil {
+		return err
+	}
 	return d.SetNewComputed("version")
 }
 
-func setIDAndMetadataFromRelease(d *schema.ResourceData, r *release.Release) error {
+func setIDAndMetadataFromRelease(d *schema.ResourceData, m *Meta, r *release.Release) error {
 	d.SetId(r.Name)
 
 	if err := d.Set("version", r.Chart.Metadata.Version); err != nil {
 		return err
 	}
 
+	if err := d.Set("resolved_version", r.Chart.Metadata.Version); err != nil {
+		return err
+	}
+
 	if err := d.Set("namespace", r.Namespace); err != nil {
 		return err
 	}
@@ -713,6 +1901,31 @@ func setIDAndMetadataFromRelease(d *schema.ResourceData, r *release.Release) err
 		return err
 	}
 
+	sensitive := sensitiveValues(d)
+	if err := d.Set("notes", redactSensitiveValues(r.Info.Notes, sensitive)); err != nil {
+		return err
+	}
+
+	manifest := removeManifestFields(r.Manifest, expandStringSlice(d.Get("ignore_fields").([]interface{})))
+	manifest, err := storedManifest(redactSensitiveValues(manifest, sensitive), d.Get("manifest_storage").(string))
+	if err != nil {
+		return err
+	}
+	if err := d.Set("manifest", manifest); err != nil {
+		return err
+	}
+
+	outputs, err := releaseOutputs(r, expandStringMap(d.Get("output_patterns")))
+	if err != nil {
+		return err
+	}
+	for k, v := range outputs {
+		outputs[k] = redactSensitiveValues(v, sensitive)
+	}
+	if err := d.Set("outputs", outputs); err != nil {
+		return err
+	}
+
 	cloakSetValues(r.Config, d)
 	values, err := json.Marshal(r.Config)
 	if err != nil {
@@ -720,16 +1933,61 @@ func setIDAndMetadataFromRelease(d *schema.ResourceData, r *release.Release) err
 	}
 
 	return d.Set("metadata", []map[string]interface{}{{
-		"name":        r.Name,
-		"revision":    r.Version,
-		"namespace":   r.Namespace,
-		"chart":       r.Chart.Metadata.Name,
-		"version":     r.Chart.Metadata.Version,
-		"app_version": r.Chart.Metadata.AppVersion,
-		"values":      string(values),
+		"name":           r.Name,
+		"revision":       r.Version,
+		"namespace":      r.Namespace,
+		"chart":          r.Chart.Metadata.Name,
+		"version":        r.Chart.Metadata.Version,
+		"app_version":    r.Chart.Metadata.AppVersion,
+		"values":         string(values),
+		"status":         r.Info.Status.String(),
+		"first_deployed": formatReleaseTime(r.Info.FirstDeployed),
+		"last_deployed":  formatReleaseTime(r.Info.LastDeployed),
+		"repository_url": releaseRepositoryURL(d, m),
 	}})
 }
 
+// formatReleaseTime formats the timestamp of the release in RFC 3339, or
+// returns an empty string if it isn't set.
+func formatReleaseTime(t helmtime.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// releaseRepositoryURL returns the URL of the repository the chart of the
+// release is downloaded from, resolving the names of the repositories
+// added with `helm repo add`. It returns an empty string for local charts.
+func releaseRepositoryURL(d resourceGetter, m *Meta) string {
+	chartName := strings.TrimSpace(d.Get("chart").(string))
+	if strings.HasPrefix(chartName, ociScheme) {
+		return chartName[:strings.LastIndex(chartName, "/")]
+	}
+
+	repositoryURL, chartName, err := resolveChartName(d.Get("repository").(string), chartName)
+	if err != nil || repositoryURL != "" {
+		return repositoryURL
+	}
+
+	i := strings.Index(chartName, "/")
+	if i == -1 {
+		return ""
+	}
+	if _, err := os.Stat(chartName); err == nil {
+		return ""
+	}
+
+	f, err := repo.LoadFile(m.Settings.RepositoryConfig)
+	if err != nil {
+		return ""
+	}
+	if entry := f.Get(chartName[:i]); entry != nil {
+		return entry.URL
+	}
+	return ""
+}
+
 func cloakSetValues(config map[string]interface{}, d resourceGetter) {
 	for _, raw := range d.Get("set_sensitive").(*schema.Set).List() {
 		set := raw.(map[string]interface{})
@@ -761,9 +2019,8 @@ func resourceReleaseExists(d *schema.ResourceData, meta interface{}) (bool, erro
 	debug("%s Start", logId)
 
 	m := meta.(*Meta)
-	n := d.Get("namespace").(string)
 
-	c, err := m.GetHelmConfiguration(n)
+	c, err := releaseHelmConfiguration(d, m, phaseRead)
 	if err != nil {
 		return false, err
 	}
@@ -795,18 +2052,80 @@ func getVersion(d resourceGetter, m *Meta) (version string) {
 		debug("setting version to >0.0.0-0")
 		version = ">0.0.0-0"
 	} else {
-		version = strings.TrimSpace(version)
+		version = normalizeVersionConstraint(strings.TrimSpace(version))
+	}
+
+	if d.Get("include_prereleases").(bool) {
+		version = includePrereleases(version)
 	}
 
 	return
 }
 
-func getChart(d resourceGetter, m *Meta, name string, cpo *action.ChartPathOptions) (c *chart.Chart, path string, err error) {
-	//Load function blows up if accessed concurrently
-	m.Lock()
-	defer m.Unlock()
+// unsetOperationTimeout is the default of the operations of the timeouts
+// block. The SDK doesn't tell whether the timeouts block is configured, this
+// duration of a hundred years tells the operations which are not set apart,
+// since no configuration sets it.
+const unsetOperationTimeout = 100 * 365 * 24 * time.Hour
+
+// operationTimeoutSlack is the time given to the provider on top of the
+// Helm operations, for the steps around them, when their deadline is derived
+// from the timeout attributes.
+const operationTimeoutSlack = 5 * time.Minute
+
+// releaseTimeout returns the timeout of the Helm operation: the timeout of
+// the operation in the timeouts block when set, otherwise the timeout
+// attribute.
+func releaseTimeout(d *schema.ResourceData, key string) time.Duration {
+	if t := d.Timeout(key); t != unsetOperationTimeout {
+		return t
+	}
+	if t := d.Get("install_timeout").(int); t > 0 && key != schema.TimeoutDelete {
+		return time.Duration(t) * time.Second
+	}
+	return time.Duration(d.Get("timeout").(int)) * time.Second
+}
+
+// operationContext returns the context of the operation. When the operation
+// is not set in the timeouts block, the deadline of the context is derived
+// from the timeout of the Helm operation, for each of its attempts, plus
+// some slack.
+func operationContext(ctx context.Context, d *schema.ResourceData, key string) (context.Context, context.CancelFunc) {
+	if d.Timeout(key) != unsetOperationTimeout {
+		return context.WithCancel(ctx)
+	}
+	attempts := time.Duration(expandRetryOptions(d).attempts)
+	return context.WithTimeout(ctx, releaseTimeout(d, key)*attempts+operationTimeoutSlack)
+}
+
+// operationTimeoutAttribute returns the attribute setting the timeout of
+// the install, upgrade or rollback of the release, if not set by the
+// timeouts block.
+func operationTimeoutAttribute(d resourceGetter) string {
+	if d.Get("install_timeout").(int) > 0 {
+		return "install_timeout"
+	}
+	return "timeout"
+}
+
+// timeoutError makes the errors of the operations which timed out explicit,
+// Helm only reports the condition which was being waited for.
+func timeoutError(ctx context.Context, err error, operation, name string, timeout time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	var budget *timeoutBudgetError
+	if errors.As(err, &budget) {
+		return fmt.Errorf("%s of release %q timed out, increase %s or check the status of its resources: %w", operation, name, budget.attribute, err)
+	}
+	if errors.Is(err, wait.ErrWaitTimeout) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s of release %q timed out after %s, increase the timeout or check the status of its resources: %w", operation, name, timeout, err)
+	}
+	return err
+}
 
-	path, err = cpo.LocateChart(name, m.Settings)
+func getChart(d resourceGetter, m *Meta, name string, cpo *action.ChartPathOptions) (c *chart.Chart, path string, err error) {
+	path, err = locateChart(d, m, name, cpo)
 
 	if err != nil {
 		return nil, "", err
@@ -821,6 +2140,337 @@ func getChart(d resourceGetter, m *Meta, name string, cpo *action.ChartPathOptio
 	return c, path, nil
 }
 
+// releaseRegistryOptions returns the options used to pull the chart of the
+// release from an OCI registry. The chart is pinned to the digest resolved
+// during the plan, if any.
+func releaseRegistryOptions(d resourceGetter, cpo *action.ChartPathOptions) registryOptions {
+	return registryOptions{
+		plainHTTP: d.Get("plain_http").(bool),
+		tls:       releaseTLSOptions(d, cpo),
+		digest:    d.Get("chart_digest").(string),
+	}
+}
+
+// chartSHA256Warning warns when the chart is the URL of an archive, which is
+// installed without being verified if chart_sha256 is not set.
+func chartSHA256Warning(d resourceGetter, name string, cpo *action.ChartPathOptions) diag.Diagnostics {
+	if cpo.RepoURL != "" || !isChartURL(name) || d.Get("chart_sha256").(string) != "" {
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Chart not verified",
+		Detail:   fmt.Sprintf("The archive of the chart URL %q is installed without being verified, set chart_sha256 to verify it.", name),
+	}}
+}
+
+// setChartDigest sets the digest of the chart of the release, pulled from an
+// OCI registry.
+func setChartDigest(d *schema.ResourceData, m *Meta, name string, cpo *action.ChartPathOptions) error {
+	if !isOCIChart(name, cpo) {
+		return d.Set("chart_digest", "")
+	}
+
+	opts := releaseRegistryOptions(d, cpo)
+	digest := opts.digest
+	if digest == "" && m.Offline {
+		return nil
+	}
+	if digest == "" {
+		var err error
+		digest, err = resolveOCIDigest(m, name, cpo, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return d.Set("chart_digest", digest)
+}
+
+// locateChart returns the local path of the chart, downloading it if needed.
+// In offline mode, charts are only looked up on the local filesystem and in
+// the repository cache.
+func locateChart(d resourceGetter, m *Meta, name string, cpo *action.ChartPathOptions) (string, error) {
+	name = strings.TrimSpace(name)
+	if _, err := os.Stat(name); err == nil {
+		return cpo.LocateChart(name, m.Settings)
+	}
+
+	if !m.Offline {
+		// Downloading concurrently from the same repository blows up as the
+		// index and the archives are written to the same cache files.
+		unlock := m.lockRepository(repositoryKey(name, cpo))
+		defer unlock()
+
+		if isOCIChart(name, cpo) {
+			return pullOCIChart(m, name, cpo, releaseRegistryOptions(d, cpo))
+		}
+
+		return downloadChart(m, name, cpo, downloadOptions{
+			tls:             releaseTLSOptions(d, cpo),
+			skipUpdate:      skipRepoUpdate(d, m),
+			passCredentials: d.Get("pass_credentials").(bool),
+			auth: httpAuth{
+				token:   d.Get("repository_token").(string),
+				headers: expandStringMap(d.Get("repository_headers")),
+			},
+			sha256: d.Get("chart_sha256").(string),
+		})
+	}
+
+	path, err := findCachedChart(m.Settings.RepositoryCache, name, cpo.Version)
+	if err != nil {
+		return "", err
+	}
+
+	if cpo.Verify {
+		if _, err := downloader.VerifyChart(path, cpo.Keyring); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// repositoryKey returns the repository from which the chart is downloaded.
+func repositoryKey(name string, cpo *action.ChartPathOptions) string {
+	if cpo.RepoURL != "" {
+		return cpo.RepoURL
+	}
+
+	if u, err := url.ParseRequestURI(name); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		return name[:i]
+	}
+
+	return name
+}
+
+// findCachedChart looks up a chart archive previously downloaded into the
+// repository cache, picking the latest version matching the constraint.
+func findCachedChart(cacheDir, name, version string) (string, error) {
+	if u, err := url.ParseRequestURI(name); err == nil && u.Scheme != "" && u.Scheme != "oci" {
+		path := filepath.Join(cacheDir, filepath.Base(u.Path))
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("chart %q is not available in the repository cache %q and can't be downloaded in offline mode", name, cacheDir)
+		}
+		return path, nil
+	}
+
+	chartName := name
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		chartName = name[i+1:]
+	}
+
+	constraint := "*"
+	if version != "" {
+		constraint = version
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q for chart %q: %s", version, name, err)
+	}
+
+	archives, err := filepath.Glob(filepath.Join(cacheDir, chartName+"-*.tgz"))
+	if err != nil {
+		return "", err
+	}
+
+	var path string
+	var latest *semver.Version
+	for _, archive := range archives {
+		v, err := semver.NewVersion(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), chartName+"-"), ".tgz"))
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest, path = v, archive
+		}
+	}
+
+	if path == "" {
+		if version == "" {
+			return "", fmt.Errorf("chart %q is not available in the repository cache %q and can't be downloaded in offline mode", name, cacheDir)
+		}
+		return "", fmt.Errorf("chart %q version %q is not available in the repository cache %q and can't be downloaded in offline mode", name, version, cacheDir)
+	}
+
+	return path, nil
+}
+
+func isLocalChartDir(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fi.IsDir()
+}
+
+// localChartDigest returns a SHA256 digest of all the files loaded for the
+// chart. The loader already honors .helmignore, so ignored files don't affect
+// the digest.
+func localChartDigest(c *chart.Chart) (string, error) {
+	files := make([]*chart.File, len(c.Raw))
+	copy(files, c.Raw)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	h := sha256.New()
+	for _, f := range files {
+		fh := sha256.Sum256(f.Data)
+		if _, err := fmt.Fprintf(h, "%s %x\n", f.Name, fh); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// checkChartDependencies verifies that all the dependencies of the chart are
+// present in its charts/ directory. When they are not, they are downloaded
+// again from Chart.lock for local charts, or updated if `dependency_update` is
+// set. The returned chart includes any dependency that was fetched.
+func checkChartDependencies(d resourceGetter, c *chart.Chart, path string, m *Meta) (*chart.Chart, error) {
+	req := c.Metadata.Dependencies
+	if req == nil {
+		return c, nil
+	}
+
+	// The dependencies of the local charts are always built from Chart.lock
+	// with `dependency_build`, the ones already in charts/ being possibly
+	// out of date.
+	forceBuild := d.Get("dependency_build").(bool) && isLocalChartDir(path)
+
+	// If CheckDependencies returns an error, we have unfulfilled dependencies.
+	// As of Helm 2.4.0, this is treated as a stopping condition:
+	// https://github.com/helm/helm/issues/2209
+	err := action.CheckDependencies(c, req)
+	if err == nil && !forceBuild {
+		return c, nil
+	}
+
+	updateDependency := d.Get("dependency_update").(bool)
+	buildDependency := (c.Lock != nil || forceBuild) && isLocalChartDir(path)
+	if !updateDependency && !buildDependency {
+		return nil, err
+	}
+
+	if m.Offline {
+		for _, dep := range req {
+			if dep.Repository != "" && !strings.HasPrefix(dep.Repository, "file://") {
+				return nil, fmt.Errorf("%s: dependency %q of chart %q can't be downloaded in offline mode", err, dep.Name, c.Metadata.Name)
+			}
+		}
+	}
+
+	cpo, _, err := chartPathOptions(d, m)
+	if err != nil {
+		return nil, err
+	}
+	getters, err := m.getters(cpo, releaseTLSOptions(d, cpo), httpAuth{})
+	if err != nil {
+		return nil, err
+	}
+
+	man := &downloader.Manager{
+		Out:              os.Stdout,
+		ChartPath:        path,
+		Keyring:          d.Get("keyring").(string),
+		SkipUpdate:       skipRepoUpdate(d, m),
+		Getters:          getters,
+		RepositoryConfig: m.Settings.RepositoryConfig,
+		RepositoryCache:  m.Settings.RepositoryCache,
+		Debug:            m.Settings.Debug,
+	}
+
+	if updateDependency {
+		debug("Updating dependencies for chart %q", path)
+		err = man.Update()
+	} else {
+		// Build verifies the Chart.lock digest before downloading anything,
+		// and updates the dependencies of the charts without Chart.lock.
+		debug("Building dependencies for chart %q from Chart.lock", path)
+		err = man.Build()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.Load(path)
+}
+
+// verifyChartLock checks that the Chart.lock of a chart is in sync with the
+// dependencies declared in its Chart.yaml, the same way `helm dependency
+// build` does.
+func verifyChartLock(c *chart.Chart, m *Meta) error {
+	if c.Lock == nil || c.Metadata.APIVersion != chart.APIVersionV2 {
+		return nil
+	}
+
+	req, err := resolveDependencyRepositories(c.Metadata.Dependencies, m)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal([2][]*chart.Dependency{req, c.Lock.Dependencies})
+	if err != nil {
+		return err
+	}
+
+	sum, err := provenance.Digest(bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	if "sha256:"+sum != c.Lock.Digest {
+		return fmt.Errorf("the lock file (Chart.lock) of chart %q is out of sync with the dependencies file (Chart.yaml). Please update the dependencies", c.Metadata.Name)
+	}
+
+	return nil
+}
+
+// resolveDependencyRepositories returns a copy of the dependencies with the
+// repository aliases (@name or alias:name) replaced by their URL, as Helm
+// does before computing the digest of the lock file.
+func resolveDependencyRepositories(deps []*chart.Dependency, m *Meta) ([]*chart.Dependency, error) {
+	var rf *repo.File
+
+	resolved := make([]*chart.Dependency, len(deps))
+	for i, dep := range deps {
+		dd := *dep
+		resolved[i] = &dd
+
+		name := ""
+		switch {
+		case strings.HasPrefix(dd.Repository, "@"):
+			name = strings.TrimPrefix(dd.Repository, "@")
+		case strings.HasPrefix(dd.Repository, "alias:"):
+			name = strings.TrimPrefix(dd.Repository, "alias:")
+		default:
+			continue
+		}
+
+		if rf == nil {
+			f, err := repo.LoadFile(m.Settings.RepositoryConfig)
+			if err != nil {
+				return nil, fmt.Errorf("could not resolve repository %q of dependency %q: %s", dd.Repository, dd.Name, err)
+			}
+			rf = f
+		}
+
+		entry := rf.Get(name)
+		if entry == nil {
+			return nil, fmt.Errorf("no repository definition for %s. Please add it via 'helm repo add'", dd.Repository)
+		}
+		dd.Repository = entry.URL
+	}
+
+	return resolved, nil
+}
+
 // Merges source and destination map, preferring values from the source map
 // Taken from github.com/helm/pkg/cli/values/options.go
 func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
@@ -844,6 +2494,7 @@ func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
 
 func getValues(d resourceGetter) (map[string]interface{}, error) {
 	base := map[string]interface{}{}
+	opts := expandValuesMergeOptions(d)
 
 	for _, raw := range d.Get("values").([]interface{}) {
 		if raw == nil {
@@ -860,7 +2511,7 @@ func getValues(d resourceGetter) (map[string]interface{}, error) {
 			return nil, fmt.Errorf("---> %v %s", err, values)
 		}
 
-		base = mergeMaps(base, currentMap)
+		base = mergeValues(base, currentMap, opts)
 	}
 
 	for _, raw := range d.Get("set").(*schema.Set).List() {
@@ -877,6 +2528,14 @@ func getValues(d resourceGetter) (map[string]interface{}, error) {
 		}
 	}
 
+	// Helm removes the keys set to null from the values of the chart.
+	for _, raw := range d.Get("unset").([]interface{}) {
+		name, _ := raw.(string)
+		if err := strvals.ParseInto(name+"=null", base); err != nil {
+			return nil, fmt.Errorf("failed parsing key %q, %s", name, err)
+		}
+	}
+
 	return base, logValues(base, d)
 }
 
@@ -894,6 +2553,16 @@ func getValue(base, set map[string]interface{}) error {
 		if err := strvals.ParseIntoString(fmt.Sprintf("%s=%s", name, value), base); err != nil {
 			return fmt.Errorf("failed parsing key %q with value %s, %s", name, value, err)
 		}
+	case "int", "float", "bool", "json":
+		v, err := typedValue(value, valueType)
+		if err != nil {
+			return fmt.Errorf("failed parsing key %q with value %s, %s", name, value, err)
+		}
+		// The value is set by the reader, strvals only parsing the key.
+		reader := func([]rune) (interface{}, error) { return v, nil }
+		if err := strvals.ParseIntoFile(name+"=value", base, reader); err != nil {
+			return fmt.Errorf("failed parsing key %q with value %s, %s", name, value, err)
+		}
 	default:
 		return fmt.Errorf("unexpected type: %s", valueType)
 	}
@@ -901,6 +2570,23 @@ func getValue(base, set map[string]interface{}) error {
 	return nil
 }
 
+// typedValue parses the value of a set block as the type.
+func typedValue(value, valueType string) (interface{}, error) {
+	switch valueType {
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "json":
+		var v interface{}
+		err := json.Unmarshal([]byte(value), &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unexpected type: %s", valueType)
+}
+
 func logValues(values map[string]interface{}, d resourceGetter) error {
 	// copy array to avoid change values by the cloak function.
 	asJSON, _ := json.Marshal(values)
@@ -926,10 +2612,7 @@ func logValues(values map[string]interface{}, d resourceGetter) error {
 }
 
 func getRelease(m *Meta, cfg *action.Configuration, name string) (*release.Release, error) {
-	debug("%s getRelease wait for lock", name)
-	m.Lock()
-	defer m.Unlock()
-	debug("%s getRelease got lock, started", name)
+	debug("%s getRelease started", name)
 
 	get := action.NewGet(cfg)
 	debug("%s getRelease post action created", name)
@@ -996,6 +2679,8 @@ func chartPathOptions(d resourceGetter, m *Meta) (*action.ChartPathOptions, stri
 		Version:  version,
 		Username: d.Get("repository_username").(string),
 		Password: d.Get("repository_password").(string),
+
+		InsecureSkipTLSverify: d.Get("insecure_skip_tls_verify").(bool),
 	}, chartName, nil
 }
 
@@ -1011,6 +2696,7 @@ func resourceHelmReleaseImportState(ctx context.Context, d *schema.ResourceData,
 	if err != nil {
 		return nil, err
 	}
+	setReleaseLog(c, releaseLog(name, namespace, phaseImport))
 
 	r, err := getRelease(m, c, name)
 	if err != nil {
@@ -1032,6 +2718,18 @@ func resourceHelmReleaseImportState(ctx context.Context, d *schema.ResourceData,
 		return nil, err
 	}
 
+	// The repository isn't stored in the release, it is looked up in the
+	// repositories known to Helm so that the generated configuration can
+	// be used as is.
+	if repository := findChartRepository(m, r.Chart.Metadata.Name, r.Chart.Metadata.Version); repository != "" {
+		if err := d.Set("repository", repository); err != nil {
+			return nil, err
+		}
+	}
+
+	// The values are not imported: the values supplied with set_sensitive
+	// can't be told apart, they would end up in plain text in values.
+
 	for key, value := range defaultAttributes {
 		err = d.Set(key, value)
 		if err != nil {
@@ -1039,7 +2737,7 @@ func resourceHelmReleaseImportState(ctx context.Context, d *schema.ResourceData,
 		}
 	}
 
-	if err := setIDAndMetadataFromRelease(d, r); err != nil {
+	if err := setIDAndMetadataFromRelease(d, m, r); err != nil {
 		return nil, err
 	}
 
@@ -1067,11 +2765,11 @@ func resourceReleaseValidate(d resourceGetter, meta interface{}, cpo *action.Cha
 		return err
 	}
 
-	return lintChart(meta.(*Meta), name, cpo, values)
+	return lintChart(d, meta.(*Meta), name, cpo, values)
 }
 
-func lintChart(m *Meta, name string, cpo *action.ChartPathOptions, values map[string]interface{}) (err error) {
-	path, err := cpo.LocateChart(name, m.Settings)
+func lintChart(d resourceGetter, m *Meta, name string, cpo *action.ChartPathOptions, values map[string]interface{}) (err error) {
+	path, err := locateChart(d, m, name, cpo)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,430 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// releaseSetSettings are the settings of helm_release_set shared by its
+// releases.
+var releaseSetSettings = []string{"wait", "atomic", "timeout"}
+
+func resourceReleaseSet() *schema.Resource {
+	release := resourceRelease()
+
+	return &schema.Resource{
+		CreateContext: resourceReleaseSetCreate,
+		ReadContext:   resourceReleaseSetRead,
+		UpdateContext: resourceReleaseSetUpdate,
+		DeleteContext: resourceReleaseSetDelete,
+		CustomizeDiff: resourceReleaseSetDiff,
+		Schema: map[string]*schema.Schema{
+			"release": {
+				Type:        schema.TypeList,
+				Required:    true,
+				MinItems:    1,
+				Description: "The releases of the set, installed in the order of their dependencies.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "Release name.",
+						},
+						"namespace": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "default",
+							Description: "Namespace to install the release into.",
+						},
+						"create_namespace": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     defaultAttributes["create_namespace"],
+							Description: "Create the namespace if it does not exist.",
+						},
+						"repository": release.Schema["repository"],
+						"chart":      release.Schema["chart"],
+						"version": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Specify the exact chart version, or a version constraint, to install. If this is not specified, the latest version is installed.",
+						},
+						"values": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "List of values in raw yaml format to pass to helm.",
+						},
+						"set": release.Schema["set"],
+						"depends_on": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "The names of the releases of the set installed before this one.",
+						},
+					},
+				},
+			},
+			"wait":    release.Schema["wait"],
+			"atomic":  release.Schema["atomic"],
+			"timeout": release.Schema["timeout"],
+			"statuses": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The status of each release, by name.",
+			},
+			"versions": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The version of the chart of each release, by name.",
+			},
+		},
+	}
+}
+
+// releaseSetOrder returns the releases of the set ordered by their
+// dependencies, the releases being in the declared order otherwise.
+func releaseSetOrder(releases []interface{}) ([]map[string]interface{}, error) {
+	byName := map[string]map[string]interface{}{}
+	var names []string
+	for _, raw := range releases {
+		r, _ := raw.(map[string]interface{})
+		name, _ := r["name"].(string)
+		if _, ok := byName[name]; ok {
+			return nil, fmt.Errorf("release %q is declared twice in the set", name)
+		}
+		byName[name] = r
+		names = append(names, name)
+	}
+	for _, name := range names {
+		for _, dep := range expandStringSlice(byName[name]["depends_on"].([]interface{})) {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("release %q depends on %q, which is not in the set", name, dep)
+			}
+		}
+	}
+
+	var ordered []map[string]interface{}
+	placed := map[string]bool{}
+	for len(ordered) < len(names) {
+		progress := false
+	Releases:
+		for _, name := range names {
+			if placed[name] {
+				continue
+			}
+			for _, dep := range expandStringSlice(byName[name]["depends_on"].([]interface{})) {
+				if !placed[dep] {
+					continue Releases
+				}
+			}
+			ordered = append(ordered, byName[name])
+			placed[name] = true
+			progress = true
+		}
+		if !progress {
+			var cycle []string
+			for _, name := range names {
+				if !placed[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, fmt.Errorf("the dependencies of releases %s are cyclic", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// releaseSetMemberAttributes are the attributes of helm_release set by the
+// release blocks of the set.
+var releaseSetMemberAttributes = []string{"name", "namespace", "create_namespace", "repository", "chart", "version", "values", "set"}
+
+// releaseSetMemberConfig returns the configuration of the release of the set
+// as a helm_release, with the settings of the set. The releases are managed
+// by helm_release, which plans and applies them.
+func releaseSetMemberConfig(d resourceGetter, r map[string]interface{}) *terraform.ResourceConfig {
+	raw := map[string]interface{}{}
+	for _, k := range releaseSetMemberAttributes {
+		v := r[k]
+		if s, ok := v.(*schema.Set); ok {
+			v = s.List()
+		}
+		if v != nil && v != "" {
+			raw[k] = v
+		}
+	}
+	for _, k := range releaseSetSettings {
+		raw[k] = d.Get(k)
+	}
+	return terraform.NewResourceConfigRaw(raw)
+}
+
+// releaseSetMemberState returns the state of the installed release of the
+// set, from its configuration when it was installed. The computed attributes
+// are refreshed by helm_release.
+func releaseSetMemberState(ctx context.Context, d resourceGetter, r map[string]interface{}) (*terraform.InstanceState, error) {
+	release := resourceRelease()
+	release.CustomizeDiff = nil
+
+	diff, err := release.Diff(ctx, nil, releaseSetMemberConfig(d, r), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, attr := range diff.Attributes {
+		if attr.NewComputed {
+			delete(diff.Attributes, k)
+		}
+	}
+
+	state := (&terraform.InstanceState{}).MergeDiff(diff)
+	state.ID = r["name"].(string)
+	return state, nil
+}
+
+// applyReleaseSetMember plans and applies the release of the set from its
+// state, nil if it is not installed, and returns its new state. The release
+// is left as is if its plan is empty.
+func applyReleaseSetMember(ctx context.Context, d resourceGetter, r map[string]interface{}, state *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, diag.Diagnostics) {
+	release := resourceRelease()
+
+	// The release is refreshed to be planned like helm_release, and
+	// installed again if it was deleted outside of Terraform.
+	if state != nil {
+		var diags diag.Diagnostics
+		state, diags = refreshReleaseSetMember(ctx, r, state, meta)
+		if diags.HasError() {
+			return nil, diags
+		}
+	}
+
+	diff, err := release.Diff(ctx, state, releaseSetMemberConfig(d, r), meta)
+	if err != nil {
+		return nil, releaseSetDiagnostics(diag.FromErr(err), r)
+	}
+	if diff == nil || diff.Empty() {
+		return state, nil
+	}
+
+	if state == nil {
+		log.Printf("[INFO] Installing release %s of the set", r["name"])
+	} else {
+		log.Printf("[INFO] Upgrading release %s of the set", r["name"])
+	}
+	state, diags := release.Apply(ctx, state, diff, meta)
+	return state, releaseSetDiagnostics(diags, r)
+}
+
+// refreshReleaseSetMember refreshes the state of the release of the set,
+// and returns nil if it doesn't exist anymore.
+func refreshReleaseSetMember(ctx context.Context, r map[string]interface{}, state *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, diag.Diagnostics) {
+	release := resourceRelease()
+
+	exists, err := resourceReleaseExists(release.Data(state), meta)
+	if err != nil {
+		return nil, releaseSetDiagnostics(diag.FromErr(err), r)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	state, diags := release.RefreshWithoutUpgrade(ctx, state, meta)
+	return state, releaseSetDiagnostics(diags, r)
+}
+
+// deleteReleaseSetMember uninstalls the release of the set, if it exists.
+func deleteReleaseSetMember(ctx context.Context, r map[string]interface{}, state *terraform.InstanceState, meta interface{}) diag.Diagnostics {
+	data := resourceRelease().Data(state)
+
+	exists, err := resourceReleaseExists(data, meta)
+	if err != nil {
+		return releaseSetDiagnostics(diag.FromErr(err), r)
+	}
+	if !exists {
+		return nil
+	}
+
+	log.Printf("[INFO] Uninstalling release %s of the set", r["name"])
+	return releaseSetDiagnostics(resourceReleaseDelete(ctx, data, meta), r)
+}
+
+// setReleaseSetAttributes sets the statuses and the versions of the
+// releases of the set.
+func setReleaseSetAttributes(d *schema.ResourceData, states []*terraform.InstanceState) error {
+	statuses := map[string]interface{}{}
+	versions := map[string]interface{}{}
+	for _, state := range states {
+		name := state.Attributes["name"]
+		statuses[name] = state.Attributes["status"]
+		versions[name] = state.Attributes["version"]
+	}
+	if err := d.Set("statuses", statuses); err != nil {
+		return err
+	}
+	return d.Set("versions", versions)
+}
+
+func resourceReleaseSetCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	releases, err := releaseSetOrder(d.Get("release").([]interface{}))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var names []string
+	for _, r := range releases {
+		names = append(names, r["name"].(string))
+	}
+	// The set is tracked from the start, to be replaced if any of its
+	// releases fails to be installed.
+	d.SetId(strings.Join(names, ","))
+
+	var states []*terraform.InstanceState
+	for _, r := range releases {
+		state, diags := applyReleaseSetMember(ctx, d, r, nil, meta)
+		if diags.HasError() {
+			return diags
+		}
+		states = append(states, state)
+	}
+	return diag.FromErr(setReleaseSetAttributes(d, states))
+}
+
+func resourceReleaseSetRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// The releases deleted outside of Terraform are removed from the set,
+	// to be installed again.
+	var installed []interface{}
+	var states []*terraform.InstanceState
+	for _, raw := range d.Get("release").([]interface{}) {
+		r := raw.(map[string]interface{})
+		state, err := releaseSetMemberState(ctx, d, r)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		state, diags := refreshReleaseSetMember(ctx, r, state, meta)
+		if diags.HasError() {
+			return diags
+		}
+		if state == nil {
+			log.Printf("[WARN] Release %s of the set not found, removing it from the state", r["name"])
+			continue
+		}
+		installed = append(installed, r)
+		states = append(states, state)
+	}
+
+	if len(installed) == 0 {
+		d.SetId("")
+		return nil
+	}
+	if err := d.Set("release", installed); err != nil {
+		return diag.FromErr(err)
+	}
+	return diag.FromErr(setReleaseSetAttributes(d, states))
+}
+
+func resourceReleaseSetUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	o, n := d.GetChange("release")
+	oldReleases, err := releaseSetOrder(o.([]interface{}))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	releases, err := releaseSetOrder(n.([]interface{}))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	current := map[string]bool{}
+	for _, r := range releases {
+		current[r["name"].(string)] = true
+	}
+
+	// The releases removed from the set are uninstalled first, the
+	// dependent releases first.
+	prior := map[string]*terraform.InstanceState{}
+	for i := len(oldReleases) - 1; i >= 0; i-- {
+		r := oldReleases[i]
+		state, err := releaseSetMemberState(ctx, priorValues{d}, r)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if current[r["name"].(string)] {
+			prior[r["name"].(string)] = state
+			continue
+		}
+		if diags := deleteReleaseSetMember(ctx, r, state, meta); diags.HasError() {
+			return diags
+		}
+	}
+
+	// The other releases are upgraded, or replaced like helm_release,
+	// and the new ones installed.
+	var states []*terraform.InstanceState
+	for _, r := range releases {
+		state, diags := applyReleaseSetMember(ctx, d, r, prior[r["name"].(string)], meta)
+		if diags.HasError() {
+			return diags
+		}
+		states = append(states, state)
+	}
+	return diag.FromErr(setReleaseSetAttributes(d, states))
+}
+
+func resourceReleaseSetDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	releases, err := releaseSetOrder(d.Get("release").([]interface{}))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The releases are uninstalled in the reverse order of their
+	// installation, the dependent releases first.
+	for i := len(releases) - 1; i >= 0; i-- {
+		r := releases[i]
+		state, err := releaseSetMemberState(ctx, d, r)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if diags := deleteReleaseSetMember(ctx, r, state, meta); diags.HasError() {
+			return diags
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
+
+func resourceReleaseSetDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.NewValueKnown("release") {
+		if _, err := releaseSetOrder(d.Get("release").([]interface{})); err != nil {
+			return err
+		}
+	}
+
+	changed := d.HasChange("release")
+	for _, k := range releaseSetSettings {
+		changed = changed || d.HasChange(k)
+	}
+	if !changed || d.Id() == "" {
+		return nil
+	}
+	if err := d.SetNewComputed("statuses"); err != nil {
+		return err
+	}
+	return d.SetNewComputed("versions")
+}
+
+// releaseSetDiagnostics prefixes the summaries of the diagnostics with the
+// name of the release of the set they are about.
+func releaseSetDiagnostics(diags diag.Diagnostics, r map[string]interface{}) diag.Diagnostics {
+	for i := range diags {
+		diags[i].Summary = fmt.Sprintf("release %s: %s", r["name"], diags[i].Summary)
+	}
+	return diags
+}
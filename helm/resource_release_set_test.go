@@ -0,0 +1,179 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestAccResourceReleaseSet_basic(t *testing.T) {
+	name := randName("set")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmReleaseSetConfig(namespace, name, "1.2.3"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release_set.test", "statuses."+name+"-first", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release_set.test", "statuses."+name+"-second", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release_set.test", "versions."+name+"-first", "1.2.3"),
+					resource.TestCheckResourceAttr("helm_release_set.test", "versions."+name+"-second", "1.2.3"),
+				),
+			},
+			{
+				Config: testAccHelmReleaseSetConfig(namespace, name, "2.0.0"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release_set.test", "statuses."+name+"-first", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release_set.test", "versions."+name+"-first", "2.0.0"),
+					resource.TestCheckResourceAttr("helm_release_set.test", "versions."+name+"-second", "1.2.3"),
+				),
+			},
+		},
+	})
+}
+
+func testAccHelmReleaseSetConfig(ns, name, version string) string {
+	return fmt.Sprintf(`
+		resource "helm_release_set" "test" {
+			release {
+				name       = "%[2]s-second"
+				namespace  = %[1]q
+				repository = %[3]q
+				chart      = "test-chart"
+				version    = "1.2.3"
+				depends_on = ["%[2]s-first"]
+			}
+
+			release {
+				name       = "%[2]s-first"
+				namespace  = %[1]q
+				repository = %[3]q
+				chart      = "test-chart"
+				version    = %[4]q
+
+				set {
+					name  = "foo"
+					value = "bar"
+				}
+			}
+		}
+	`, ns, name, testRepositoryURL, version)
+}
+
+func TestReleaseSetOrder(t *testing.T) {
+	release := func(name string, deps ...string) interface{} {
+		dependsOn := []interface{}{}
+		for _, dep := range deps {
+			dependsOn = append(dependsOn, dep)
+		}
+		return map[string]interface{}{"name": name, "depends_on": dependsOn}
+	}
+
+	tests := []struct {
+		releases []interface{}
+		expected []string
+		err      string
+	}{
+		{
+			releases: []interface{}{release("ingress"), release("cert-manager"), release("external-dns")},
+			expected: []string{"ingress", "cert-manager", "external-dns"},
+		},
+		{
+			releases: []interface{}{release("issuers", "cert-manager"), release("ingress", "issuers"), release("cert-manager")},
+			expected: []string{"cert-manager", "issuers", "ingress"},
+		},
+		{
+			releases: []interface{}{release("ingress"), release("ingress")},
+			err:      `release "ingress" is declared twice`,
+		},
+		{
+			releases: []interface{}{release("ingress", "cert-manager")},
+			err:      `release "ingress" depends on "cert-manager", which is not in the set`,
+		},
+		{
+			releases: []interface{}{release("ingress"), release("a", "b"), release("b", "a")},
+			err:      "the dependencies of releases a, b are cyclic",
+		},
+	}
+
+	for _, tt := range tests {
+		ordered, err := releaseSetOrder(tt.releases)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, r := range ordered {
+			names = append(names, r["name"].(string))
+		}
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("expected %v, got %v", tt.expected, names)
+		}
+	}
+}
+
+func TestReleaseSetMemberState(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceReleaseSet().Schema, map[string]interface{}{
+		"timeout": 600,
+		"release": []interface{}{
+			map[string]interface{}{
+				"name":      "ingress",
+				"namespace": "ingress",
+				"chart":     "ingress-nginx",
+				"values":    []interface{}{"replicaCount: 2\n"},
+				"set": []interface{}{
+					map[string]interface{}{"name": "controller.kind", "value": "DaemonSet"},
+				},
+			},
+		},
+	})
+
+	r := d.Get("release").([]interface{})[0].(map[string]interface{})
+	state, err := releaseSetMemberState(context.Background(), d, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ID != "ingress" {
+		t.Errorf("expected the release to be identified by its name, got %q", state.ID)
+	}
+
+	md := resourceRelease().Data(state)
+	if md.Get("name") != "ingress" || md.Get("namespace") != "ingress" || md.Get("chart") != "ingress-nginx" {
+		t.Errorf("expected the settings of the release, got %v", state)
+	}
+	if md.Get("timeout") != 600 || md.Get("wait") != true {
+		t.Errorf("expected the settings of the set, got timeout %v and wait %v", md.Get("timeout"), md.Get("wait"))
+	}
+	if md.Get("render_subchart_notes") != true || md.Get("max_history") != 0 {
+		t.Error("expected the defaults of helm_release")
+	}
+
+	values, err := getValues(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"replicaCount": float64(2),
+		"controller":   map[string]interface{}{"kind": "DaemonSet"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
@@ -1,25 +1,35 @@
 package helm
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/pkg/errors"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/helmpath"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
@@ -440,6 +450,61 @@ func TestAccResourceRelease_updateAfterFail(t *testing.T) {
 	})
 }
 
+func TestAccResourceRelease_rollbackToRevision(t *testing.T) {
+	name := randName("rollback")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmReleaseConfigRollback(testResourceName, namespace, name, "first", 0),
+				Check:  resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "1"),
+			},
+			{
+				Config: testAccHelmReleaseConfigRollback(testResourceName, namespace, name, "second", 0),
+				Check:  resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "2"),
+			},
+			{
+				// The values of the configuration are applied after the
+				// rollback.
+				Config: testAccHelmReleaseConfigRollback(testResourceName, namespace, name, "third", 1),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "4"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.values", "{\"podAnnotations\":{\"step\":\"third\"}}"),
+				),
+			},
+			{
+				Config: testAccHelmReleaseConfigRollback(testResourceName, namespace, name, "third", 2),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "5"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.values", "{\"podAnnotations\":{\"step\":\"second\"}}"),
+				),
+			},
+		},
+	})
+}
+
+func testAccHelmReleaseConfigRollback(resource, ns, name, step string, revision int) string {
+	return fmt.Sprintf(`
+		resource "helm_release" "%s" {
+ 			name        = %q
+			namespace   = %q
+			chart       = "./testdata/charts/test-chart"
+
+			rollback_to_revision = %d
+
+			set {
+				name  = "podAnnotations.step"
+				value = %q
+			}
+		}
+	`, resource, name, ns, revision, step)
+}
+
 func TestAccResourceRelease_updateExistingFailed(t *testing.T) {
 	name := randName("test-update-existing-failed")
 	namespace := createRandomNamespace(t)
@@ -608,6 +673,44 @@ func TestAccResourceRelease_createNamespace(t *testing.T) {
 	})
 }
 
+func TestAccResourceRelease_importSensitive(t *testing.T) {
+	name := randName("import-sensitive")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmReleaseConfigSensitiveValue(
+					testResourceName, namespace, name, "test-chart", "1.2.3", "podAnnotations.secret", "sensitive-import-value",
+				),
+				Check: resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+			},
+			{
+				Config: testAccHelmReleaseConfigSensitiveValue(
+					"imported", namespace, "import", "test-chart", "1.2.3", "podAnnotations.secret", "sensitive-import-value",
+				),
+				ResourceName:  "helm_release.imported",
+				ImportStateId: fmt.Sprintf("%s/%s", namespace, name),
+				ImportState:   true,
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					for _, s := range states {
+						for k, v := range s.Attributes {
+							if strings.HasPrefix(k, "values") && strings.Contains(v, "sensitive-import-value") {
+								return fmt.Errorf("the sensitive value is imported in %s", k)
+							}
+						}
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
 func testAccHelmReleaseConfigBasic(resource, ns, name, version string) string {
 	return fmt.Sprintf(`
 		resource "helm_release" "%s" {
@@ -726,6 +829,74 @@ func TestGetValuesString(t *testing.T) {
 	}
 }
 
+func TestGetValuesTyped(t *testing.T) {
+	d := resourceRelease().Data(nil)
+	err := d.Set("set", []interface{}{
+		map[string]interface{}{"name": "replicas", "value": "3", "type": "int"},
+		map[string]interface{}{"name": "ratio", "value": "0.5", "type": "float"},
+		map[string]interface{}{"name": "enabled", "value": "true", "type": "bool"},
+		map[string]interface{}{"name": "ports[0]", "value": `{"name": "http", "port": 80}`, "type": "json"},
+	})
+	if err != nil {
+		t.Fatalf("error setting values: %s", err)
+	}
+
+	values, err := getValues(d)
+	if err != nil {
+		t.Fatalf("error getValues: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"replicas": int64(3),
+		"ratio":    0.5,
+		"enabled":  true,
+		"ports": []interface{}{
+			map[string]interface{}{"name": "http", "port": float64(80)},
+		},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("error merging values, expected %v, got %v", expected, values)
+	}
+
+	err = d.Set("set", []interface{}{
+		map[string]interface{}{"name": "replicas", "value": "three", "type": "int"},
+	})
+	if err != nil {
+		t.Fatalf("error setting values: %s", err)
+	}
+	if _, err := getValues(d); err == nil {
+		t.Fatal("expected an error for an invalid int")
+	}
+}
+
+func TestGetValuesUnset(t *testing.T) {
+	d := resourceRelease().Data(nil)
+	err := d.Set("values", []string{"foo:\n  bar: baz\n  qux: quux"})
+	if err != nil {
+		t.Fatalf("error setting values: %s", err)
+	}
+	err = d.Set("unset", []string{"foo.bar", "corge"})
+	if err != nil {
+		t.Fatalf("error setting values: %s", err)
+	}
+
+	values, err := getValues(d)
+	if err != nil {
+		t.Fatalf("error getValues: %s", err)
+	}
+
+	foo := values["foo"].(map[string]interface{})
+	if v, ok := foo["bar"]; !ok || v != nil {
+		t.Fatalf("error unsetting values, expected foo.bar to be null, got %v", foo)
+	}
+	if foo["qux"] != "quux" {
+		t.Fatalf("error unsetting values, expected %q, got %v", "quux", foo["qux"])
+	}
+	if v, ok := values["corge"]; !ok || v != nil {
+		t.Fatalf("error unsetting values, expected corge to be null, got %v", values)
+	}
+}
+
 func TestCloakSetValues(t *testing.T) {
 	d := resourceRelease().Data(nil)
 	err := d.Set("set_sensitive", []interface{}{
@@ -968,7 +1139,8 @@ func TestAccResourceRelease_dependency(t *testing.T) {
 	namespace := createRandomNamespace(t)
 	defer deleteNamespace(t, namespace)
 
-	// remove the subcharts so we can use `dependency_update` to grab them
+	// remove the subcharts so they are built from the Chart.lock first and
+	// then grabbed again using `dependency_update`
 	if err := removeSubcharts("umbrella-chart"); err != nil {
 		t.Fatalf("Failed to remove subcharts: %s", err)
 	}
@@ -979,13 +1151,22 @@ func TestAccResourceRelease_dependency(t *testing.T) {
 		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
 		Steps: []resource.TestStep{
 			{
-				Config:      testAccHelmReleaseConfigDependency(testResourceName, namespace, name, false),
-				ExpectError: regexp.MustCompile("found in Chart.yaml, but missing in charts/ directory"),
+				Config: testAccHelmReleaseConfigDependency(testResourceName, namespace, name, false),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "1"),
+					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release.test", "dependency_update", "false"),
+				),
 			},
 			{
+				PreConfig: func() {
+					if err := removeSubcharts("umbrella-chart"); err != nil {
+						t.Fatalf("Failed to remove subcharts: %s", err)
+					}
+				},
 				Config: testAccHelmReleaseConfigDependency(testResourceName, namespace, name, true),
 				Check: resource.ComposeAggregateTestCheckFunc(
-					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "1"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "2"),
 					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
 					resource.TestCheckResourceAttr("helm_release.test", "dependency_update", "true"),
 				),
@@ -1017,6 +1198,39 @@ func TestAccResourceRelease_chartURL(t *testing.T) {
 	})
 }
 
+func TestAccResourceRelease_chartURLSHA256(t *testing.T) {
+	name := randName("chart-url-sha256")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	chartURL := fmt.Sprintf("%s/%s", testRepositoryURL, "test-chart-1.2.3.tgz")
+	archive, err := ioutil.ReadFile(filepath.Join(testRepositoryDir, "test-chart-1.2.3.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256(archive))
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccHelmReleaseConfig_chartURLSHA256(testResourceName, namespace, name, chartURL, strings.Repeat("0", 64)),
+				ExpectError: regexp.MustCompile("the SHA256 digest of chart"),
+			},
+			{
+				Config: testAccHelmReleaseConfig_chartURLSHA256(testResourceName, namespace, name, chartURL, digest),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.chart", "test-chart"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.version", "1.2.3"),
+				),
+			},
+		},
+	})
+}
+
 func TestAccResourceRelease_helm_repo_add(t *testing.T) {
 	name := randName("helm-repo-add")
 	namespace := createRandomNamespace(t)
@@ -1047,6 +1261,105 @@ func TestAccResourceRelease_helm_repo_add(t *testing.T) {
 	})
 }
 
+func TestAccResourceRelease_upgradeInstall(t *testing.T) {
+	name := randName("upgrade-install")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	// install the release outside of Terraform
+	cmd := exec.Command("helm", "install", name, filepath.Join(testChartsPath, "test-chart"), "--namespace", namespace)
+	out, err := cmd.CombinedOutput()
+	t.Log(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmReleaseConfig_upgradeInstall(testResourceName, namespace, name),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "2"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.version", "1.2.3"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccResourceRelease_upgradeInstallExisting(t *testing.T) {
+	name := randName("upgrade-install-existing")
+	namespace := createRandomNamespace(t)
+	defer deleteNamespace(t, namespace)
+
+	// install the release outside of Terraform
+	cmd := exec.Command("helm", "install", name, filepath.Join(testChartsPath, "test-chart"), "--namespace", namespace)
+	out, err := cmd.CombinedOutput()
+	t.Log(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckHelmReleaseDestroy(namespace),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccHelmReleaseConfig_upgradeInstallValues(testResourceName, namespace, name, "first"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "id", name),
+					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "2"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.values", "{\"podAnnotations\":{\"step\":\"first\"}}"),
+				),
+			},
+			{
+				Config: testAccHelmReleaseConfig_upgradeInstallValues(testResourceName, namespace, name, "second"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("helm_release.test", "id", name),
+					resource.TestCheckResourceAttr("helm_release.test", "status", release.StatusDeployed.String()),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.revision", "3"),
+					resource.TestCheckResourceAttr("helm_release.test", "metadata.0.values", "{\"podAnnotations\":{\"step\":\"second\"}}"),
+				),
+			},
+		},
+	})
+}
+
+func testAccHelmReleaseConfig_upgradeInstallValues(resource, ns, name, step string) string {
+	return fmt.Sprintf(`
+		resource "helm_release" "%s" {
+ 			name        = %q
+			namespace   = %q
+			chart       = "./testdata/charts/test-chart"
+
+			upgrade_install = true
+
+			set {
+				name  = "podAnnotations.step"
+				value = %q
+			}
+		}
+	`, resource, name, ns, step)
+}
+
+func testAccHelmReleaseConfig_upgradeInstall(resource, ns, name string) string {
+	return fmt.Sprintf(`
+		resource "helm_release" "%s" {
+ 			name        = %q
+			namespace   = %q
+			chart       = "./testdata/charts/test-chart"
+
+			upgrade_install = true
+		}
+	`, resource, name, ns)
+}
+
 func testAccHelmReleaseConfig_helm_repo_add(resource, ns, name string) string {
 	return fmt.Sprintf(`
 		resource "helm_release" "%s" {
@@ -1069,6 +1382,18 @@ func testAccHelmReleaseConfig_chartURL(resource, ns, name, url string) string {
 	`, resource, name, ns, url)
 }
 
+func testAccHelmReleaseConfig_chartURLSHA256(resource, ns, name, url, digest string) string {
+	return fmt.Sprintf(`
+		resource "helm_release" "%s" {
+ 			name         = %q
+			namespace    = %q
+			chart        = %q
+			chart_sha256 = %q
+			version      = "1.2.3"
+		}
+	`, resource, name, ns, url, digest)
+}
+
 func testAccHelmReleaseConfigDependency(resource, ns, name string, dependencyUpdate bool) string {
 	return fmt.Sprintf(`
 		resource "helm_release" "%s" {
@@ -1090,3 +1415,309 @@ func removeSubcharts(chartName string) error {
 	}
 	return os.RemoveAll(chartsPath)
 }
+
+func TestLocalChartDigest(t *testing.T) {
+	path := filepath.Join(testChartsPath, "test-chart")
+	if !isLocalChartDir(path) {
+		t.Fatalf("expected %q to be a local chart directory", path)
+	}
+
+	c, err := loader.Load(path)
+	if err != nil {
+		t.Fatalf("error loading chart: %v", err)
+	}
+
+	digest, err := localChartDigest(c)
+	if err != nil {
+		t.Fatalf("error computing digest: %v", err)
+	}
+
+	again, err := localChartDigest(c)
+	if err != nil {
+		t.Fatalf("error computing digest: %v", err)
+	}
+	if digest != again {
+		t.Fatalf("expected digest to be stable, got %q and %q", digest, again)
+	}
+
+	c.Raw = append(c.Raw, &chart.File{Name: "templates/extra.yaml", Data: []byte("foo: bar")})
+	changed, err := localChartDigest(c)
+	if err != nil {
+		t.Fatalf("error computing digest: %v", err)
+	}
+	if digest == changed {
+		t.Fatalf("expected digest to change when chart files change")
+	}
+}
+
+func TestVerifyChartLock(t *testing.T) {
+	m := &Meta{Settings: cli.New()}
+
+	c, err := loader.Load(filepath.Join(testChartsPath, "umbrella-chart"))
+	if err != nil {
+		t.Fatalf("error loading chart: %v", err)
+	}
+
+	if err := verifyChartLock(c, m); err != nil {
+		t.Fatalf("expected Chart.lock to be in sync, got: %v", err)
+	}
+
+	c.Metadata.Dependencies[0].Version = "1.x.x"
+	err = verifyChartLock(c, m)
+	if err == nil {
+		t.Fatalf("expected an error when Chart.lock is out of sync")
+	}
+	if !strings.Contains(err.Error(), "out of sync") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckChartDependenciesBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"umbrella-chart", "dependency-foo", "dependency-bar"} {
+		if err := copyDir(filepath.Join(testChartsPath, name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "umbrella-chart")
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(dir, "repositories.yaml")
+	settings.RepositoryCache = filepath.Join(dir, "cache")
+	m := &Meta{Settings: settings}
+
+	build := func(dependencyBuild bool) {
+		d := resourceRelease().Data(nil)
+		d.Set("dependency_build", dependencyBuild)
+
+		c, err := loader.Load(path)
+		if err != nil {
+			t.Fatalf("error loading chart: %v", err)
+		}
+		if _, err := checkChartDependencies(d, c, path, m); err != nil {
+			t.Fatalf("error building dependencies: %v", err)
+		}
+	}
+
+	// The missing dependencies are built from Chart.lock.
+	build(false)
+	archive := filepath.Join(path, "charts", "dependency-foo-0.1.0.tgz")
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("expected the dependency to be built: %v", err)
+	}
+
+	stale := filepath.Join(path, "charts", "dependency-foo-0.0.1.tgz")
+	if err := os.Rename(archive, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dependencies in charts/ are used as is without dependency_build.
+	build(false)
+	if _, err := os.Stat(stale); err != nil {
+		t.Fatalf("expected the dependencies to be kept: %v", err)
+	}
+
+	build(true)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected the stale dependency to be removed, got %v", err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("expected the dependency to be built again: %v", err)
+	}
+}
+
+// copyDir copies the directory src to dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, fi.Mode())
+	})
+}
+
+func TestFindCachedChart(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "helm-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	for _, f := range []string{"test-chart-1.2.3.tgz", "test-chart-2.0.0.tgz", "test-chart-v2-3.0.0.tgz"} {
+		if err := ioutil.WriteFile(filepath.Join(cacheDir, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+	}{
+		{"test-chart", "", "test-chart-2.0.0.tgz"},
+		{"test-chart", "1.2.3", "test-chart-1.2.3.tgz"},
+		{"repo/test-chart", "~1.2", "test-chart-1.2.3.tgz"},
+		{"https://example.com/charts/test-chart-2.0.0.tgz", "", "test-chart-2.0.0.tgz"},
+	}
+
+	for _, tt := range tests {
+		path, err := findCachedChart(cacheDir, tt.name, tt.version)
+		if err != nil {
+			t.Fatalf("error finding chart %q version %q: %v", tt.name, tt.version, err)
+		}
+		if filepath.Base(path) != tt.expected {
+			t.Fatalf("expected %q, got %q", tt.expected, filepath.Base(path))
+		}
+	}
+
+	if _, err := findCachedChart(cacheDir, "test-chart", "3.0.0"); err == nil {
+		t.Fatalf("expected an error for a chart version not in the cache")
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	ctx := context.Background()
+
+	err := timeoutError(ctx, errors.Wrap(wait.ErrWaitTimeout, "release test failed"), "installation", "test", 5*time.Minute)
+	if err == nil || !strings.Contains(err.Error(), `installation of release "test" timed out after 5m0s`) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	other := errors.New("chart not found")
+	if err := timeoutError(ctx, other, "installation", "test", 5*time.Minute); err != other {
+		t.Fatalf("expected the error to be returned as is, got %v", err)
+	}
+
+	if err := timeoutError(ctx, nil, "installation", "test", 5*time.Minute); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestReleaseRepositoryURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-repositories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rf := repo.NewFile()
+	rf.Add(&repo.Entry{Name: "stable", URL: "https://charts.example.com/stable"})
+	repositoryConfig := filepath.Join(dir, "repositories.yaml")
+	if err := rf.WriteFile(repositoryConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &Meta{Settings: &cli.EnvSettings{RepositoryConfig: repositoryConfig}}
+
+	tests := []struct {
+		chart      string
+		repository string
+		expected   string
+	}{
+		{"nginx", "https://charts.example.com/", "https://charts.example.com/"},
+		{"stable/nginx", "", "https://charts.example.com/stable"},
+		{"nginx", "stable", "https://charts.example.com/stable"},
+		{"unknown/nginx", "", ""},
+		{"oci://registry.example.com/charts/nginx", "", "oci://registry.example.com/charts"},
+		{"./testdata/charts/test-chart", "", ""},
+	}
+
+	for _, tt := range tests {
+		d := resourceRelease().TestResourceData()
+		d.Set("chart", tt.chart)
+		d.Set("repository", tt.repository)
+
+		if url := releaseRepositoryURL(d, m); url != tt.expected {
+			t.Errorf("%s (%s): expected %q, got %q", tt.chart, tt.repository, tt.expected, url)
+		}
+	}
+}
+
+func TestResourceReleaseDeleteAbandon(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	d.SetId("test")
+	d.Set("name", "test")
+	d.Set("uninstall_on_destroy", false)
+
+	// The release is abandoned without connecting to the cluster.
+	if diags := resourceReleaseDelete(context.Background(), d, &Meta{}); diags.HasError() {
+		t.Fatalf("unexpected error: %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("expected the release to be removed from the state, got %q", d.Id())
+	}
+}
+
+func TestReleaseTimeout(t *testing.T) {
+	newData := func(create time.Duration, attributes map[string]interface{}) *schema.ResourceData {
+		r := resourceRelease()
+		r.Timeouts.Create = &create
+		d := r.Data(nil)
+		for k, v := range attributes {
+			if err := d.Set(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return d
+	}
+
+	tests := []struct {
+		name       string
+		create     time.Duration
+		attributes map[string]interface{}
+		key        string
+		expected   time.Duration
+	}{
+		{"timeout attribute", unsetOperationTimeout, map[string]interface{}{"timeout": 600}, schema.TimeoutCreate, 10 * time.Minute},
+		{"install_timeout attribute", unsetOperationTimeout, map[string]interface{}{"timeout": 600, "install_timeout": 900}, schema.TimeoutCreate, 15 * time.Minute},
+		{"install_timeout ignored on delete", unsetOperationTimeout, map[string]interface{}{"timeout": 600, "install_timeout": 900}, schema.TimeoutDelete, 10 * time.Minute},
+		{"timeouts block", 20 * time.Minute, map[string]interface{}{"timeout": 600, "install_timeout": 900}, schema.TimeoutCreate, 20 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newData(tt.create, tt.attributes)
+			if timeout := releaseTimeout(d, tt.key); timeout != tt.expected {
+				t.Fatalf("expected a timeout of %s, got %s", tt.expected, timeout)
+			}
+		})
+	}
+}
+
+func TestOperationContext(t *testing.T) {
+	r := resourceRelease()
+	d := r.Data(nil)
+	d.Set("timeout", 600)
+	d.Set("retry", []interface{}{map[string]interface{}{"attempts": 2}})
+
+	ctx, cancel := operationContext(context.Background(), d, schema.TimeoutCreate)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if expected := 2*10*time.Minute + operationTimeoutSlack; !ok || time.Until(deadline) > expected || time.Until(deadline) < expected-time.Minute {
+		t.Errorf("expected a deadline in %s, got %s", expected, time.Until(deadline))
+	}
+
+	create := 30 * time.Minute
+	r.Timeouts.Create = &create
+	d = r.Data(nil)
+	ctx, cancel = operationContext(context.Background(), d, schema.TimeoutCreate)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("expected the deadline of the timeouts block to be left to the SDK")
+	}
+}
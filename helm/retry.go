@@ -0,0 +1,103 @@
+package helm
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// retryOptions configure the retries of the operations failing with a
+// transient error.
+type retryOptions struct {
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// expandRetryOptions returns the retry options of the release. Operations
+// are attempted once when the retry block is not set.
+func expandRetryOptions(d resourceGetter) retryOptions {
+	opts := retryOptions{attempts: 1}
+	if len(d.Get("retry").([]interface{})) == 0 {
+		return opts
+	}
+
+	opts.attempts = d.Get("retry.0.attempts").(int)
+	opts.initialBackoff = time.Duration(d.Get("retry.0.initial_backoff").(int)) * time.Second
+	opts.maxBackoff = time.Duration(d.Get("retry.0.max_backoff").(int)) * time.Second
+	return opts
+}
+
+// retry runs fn until it succeeds, fails with an error which is not
+// transient, or the attempts are exhausted. The backoff between the
+// attempts is doubled each time, up to the maximum backoff.
+func retry(ctx context.Context, opts retryOptions, operation string, fn func(attempt int) error) error {
+	backoff := opts.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt >= opts.attempts || !isTransientError(err) {
+			return err
+		}
+
+		debug("%s failed with a transient error (attempt %d of %d), retrying in %s: %s", operation, attempt, opts.attempts, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > opts.maxBackoff {
+			backoff = opts.maxBackoff
+		}
+	}
+}
+
+// transientErrorMessages are the messages of the transient errors which are
+// not typed, like the errors of etcd returned by the API server.
+var transientErrorMessages = []string{
+	"etcdserver: leader changed",
+	"etcdserver: request timed out",
+	"etcdserver: too many requests",
+	"connection reset by peer",
+	"connection refused",
+	"TLS handshake timeout",
+	"i/o timeout",
+	"http2: server sent GOAWAY",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+}
+
+// isTransientError reports whether the operation failing with err may
+// succeed if retried.
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	if apierrors.IsServerTimeout(cause) || apierrors.IsTimeout(cause) || apierrors.IsTooManyRequests(cause) ||
+		apierrors.IsInternalError(cause) || apierrors.IsServiceUnavailable(cause) || apierrors.IsUnexpectedServerError(cause) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, m := range transientErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package helm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{apierrors.NewServiceUnavailable("unavailable"), true},
+		{errors.Wrap(apierrors.NewTooManyRequests("slow down", 1), "release test failed"), true},
+		{errors.New("rpc error: code = Unknown desc = etcdserver: leader changed"), true},
+		{errors.New(`failed to fetch https://charts.example.com/index.yaml : 503 Service Unavailable`), true},
+		{wait.ErrWaitTimeout, false},
+		{apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "test"), false},
+		{errors.New("template: test/templates/pod.yaml:3: unexpected EOF in operand"), false},
+		{errors.New(`chart "test" not found`), false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransientError(tt.err); got != tt.transient {
+			t.Errorf("%q: expected transient to be %t", tt.err, tt.transient)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	opts := retryOptions{attempts: 3}
+	transient := apierrors.NewServiceUnavailable("unavailable")
+
+	attempts := 0
+	err := retry(context.Background(), opts, "test", func(int) error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected success after 3 attempts, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	err = retry(context.Background(), opts, "test", func(int) error {
+		attempts++
+		return transient
+	})
+	if err != transient || attempts != 3 {
+		t.Fatalf("expected the error after 3 attempts, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	permanent := errors.New("invalid chart")
+	err = retry(context.Background(), opts, "test", func(int) error {
+		attempts++
+		return permanent
+	})
+	if err != permanent || attempts != 1 {
+		t.Fatalf("expected no retry of permanent errors, got %d attempts and %v", attempts, err)
+	}
+}
@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// rolloutOptions are the settings of the canary of the upgrades, set by the
+// rollout block.
+type rolloutOptions struct {
+	canaryValues []map[string]interface{}
+	soak         time.Duration
+	rollback     bool
+}
+
+// expandRolloutOptions returns the settings of the rollout block, or nil if
+// the upgrades have no canary.
+func expandRolloutOptions(d resourceGetter) (*rolloutOptions, error) {
+	if len(d.Get("rollout").([]interface{})) == 0 {
+		return nil, nil
+	}
+
+	opts := &rolloutOptions{
+		soak:     time.Duration(d.Get("rollout.0.soak").(int)) * time.Second,
+		rollback: d.Get("rollout.0.rollback").(bool),
+	}
+	for _, raw := range d.Get("rollout.0.canary_values").([]interface{}) {
+		values := map[string]interface{}{}
+		if s, _ := raw.(string); s != "" {
+			if err := yaml.Unmarshal([]byte(s), &values); err != nil {
+				return nil, errors.Wrap(err, "invalid canary_values")
+			}
+		}
+		opts.canaryValues = append(opts.canaryValues, values)
+	}
+	return opts, nil
+}
+
+// canaryValues returns the values of the canary: the values of the release
+// with the canary overlays merged on top, as set by values_merge.
+func canaryValues(d resourceGetter, values map[string]interface{}, opts *rolloutOptions) map[string]interface{} {
+	merge := expandValuesMergeOptions(d)
+
+	canary := values
+	for _, overlay := range opts.canaryValues {
+		canary = mergeValues(canary, overlay, merge)
+	}
+	return canary
+}
+
+// upgradeCanary upgrades the release with the values of the canary and
+// waits for its resources to be ready, then for the soak period, and checks
+// they are still ready before the release is upgraded with its values. The
+// failed canary is rolled back to the previous revision, if set.
+func upgradeCanary(ctx context.Context, d *schema.ResourceData, cfg *action.Configuration, client *action.Upgrade, name string, c *chart.Chart, values map[string]interface{}, previousRevision int, opts *rolloutOptions) diag.Diagnostics {
+	wait := client.Wait
+	client.Wait = true
+	defer func() { client.Wait = wait }()
+
+	log.Printf("[INFO] Upgrading release %s with the canary values", name)
+	err := checkCanary(ctx, cfg, client, name, c, canaryValues(d, values, opts), opts.soak)
+	if err == nil {
+		return nil
+	}
+
+	diags := diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  "Canary failed",
+		Detail:   fmt.Sprintf("The canary of the upgrade of release %q failed, the release was not upgraded with its values: %s", name, err),
+	}}
+
+	last, lerr := cfg.Releases.Last(name)
+	if !opts.rollback || lerr != nil || last.Version <= previousRevision {
+		return diags
+	}
+
+	rollback := action.NewRollback(cfg)
+	rollback.Version = previousRevision
+	rollback.Timeout = client.Timeout
+	rollback.Wait = wait
+	rollback.DisableHooks = hooksDisabled(d, "rollback")
+	rollback.CleanupOnFail = d.Get("cleanup_on_fail").(bool)
+
+	debug("[upgradeCanary: %s] Rolling back to revision %d", name, previousRevision)
+	if rerr := rollback.Run(name); rerr != nil {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  "Rollback failed",
+			Detail:   fmt.Sprintf("The canary revision %d of release %q could not be rolled back to revision %d: %s", last.Version, name, previousRevision, rerr),
+		})
+	}
+	return append(diags, diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "Release rolled back",
+		Detail:   fmt.Sprintf("The canary revision %d of release %q was rolled back to revision %d.", last.Version, name, previousRevision),
+	})
+}
+
+// checkCanary upgrades the release with the values of the canary, and
+// checks its resources are still ready after the soak period.
+func checkCanary(ctx context.Context, cfg *action.Configuration, client *action.Upgrade, name string, c *chart.Chart, values map[string]interface{}, soak time.Duration) error {
+	rel, err := client.Run(name, c, values)
+	if err != nil {
+		return err
+	}
+
+	if soak > 0 {
+		log.Printf("[INFO] Soaking the canary of release %s for %s", name, soak)
+		select {
+		case <-time.After(soak):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	resources, err := cfg.KubeClient.Build(strings.NewReader(rel.Manifest), false)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(cfg.KubeClient.Wait(resources, client.Timeout), "the resources of the canary are not ready after the soak period")
+}
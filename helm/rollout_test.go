@@ -0,0 +1,50 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestCanaryValues(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceRelease().Schema, map[string]interface{}{
+		"name":  "test",
+		"chart": "test-chart",
+		"rollout": []interface{}{
+			map[string]interface{}{
+				"canary_values": []interface{}{"replicaCount: 1\n", "image:\n  tag: canary\n"},
+				"soak":          120,
+			},
+		},
+	})
+
+	opts, err := expandRolloutOptions(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.soak != 2*time.Minute || !opts.rollback {
+		t.Errorf("unexpected rollout options %+v", opts)
+	}
+
+	values := map[string]interface{}{
+		"replicaCount": 10,
+		"image":        map[string]interface{}{"repository": "nginx", "tag": "1.19"},
+	}
+	expected := map[string]interface{}{
+		"replicaCount": float64(1),
+		"image":        map[string]interface{}{"repository": "nginx", "tag": "canary"},
+	}
+	if canary := canaryValues(d, values, opts); !reflect.DeepEqual(canary, expected) {
+		t.Errorf("expected %v, got %v", expected, canary)
+	}
+	if values["replicaCount"] != 10 || values["image"].(map[string]interface{})["tag"] != "1.19" {
+		t.Errorf("expected the values of the release to be left as is, got %v", values)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceRelease().Schema, map[string]interface{}{"name": "test", "chart": "test-chart"})
+	if opts, err := expandRolloutOptions(d); opts != nil || err != nil {
+		t.Errorf("expected no canary, got %+v, %v", opts, err)
+	}
+}
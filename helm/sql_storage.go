@@ -0,0 +1,87 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// SQLStorage is the configuration of the connection of the sql storage
+// driver to its PostgreSQL database. The settings left empty are read from
+// the PG* environment variables by the PostgreSQL driver.
+type SQLStorage struct {
+	// ConnectionString is the connection string, as a URL or as key/value
+	// pairs, used instead of the other settings.
+	ConnectionString string
+
+	Host        string
+	Port        int
+	Database    string
+	User        string
+	Password    string
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// The drivers are connected once per namespace. Helm connects on each
+	// operation, never closing the connections.
+	drivers map[string]*driver.SQL
+	mutex   sync.Mutex
+}
+
+// DSN returns the connection string of the database: the connection string
+// if set, or the key/value pairs of the other settings.
+func (s *SQLStorage) DSN() string {
+	if s.ConnectionString != "" {
+		return s.ConnectionString
+	}
+
+	settings := map[string]string{
+		"host":        s.Host,
+		"dbname":      s.Database,
+		"user":        s.User,
+		"password":    s.Password,
+		"sslmode":     s.SSLMode,
+		"sslrootcert": s.SSLRootCert,
+		"sslcert":     s.SSLCert,
+		"sslkey":      s.SSLKey,
+	}
+	if s.Port != 0 {
+		settings["port"] = fmt.Sprint(s.Port)
+	}
+
+	var pairs []string
+	for k, v := range settings {
+		if v != "" {
+			pairs = append(pairs, fmt.Sprintf("%s='%s'", k, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// driver returns the sql storage driver of the namespace, connecting to the
+// database the first time.
+func (s *SQLStorage) driver(namespace string) (*driver.SQL, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if d, ok := s.drivers[namespace]; ok {
+		return d, nil
+	}
+
+	d, err := driver.NewSQL(s.DSN(), debug, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to the database of the sql storage driver")
+	}
+	if s.drivers == nil {
+		s.drivers = map[string]*driver.SQL{}
+	}
+	s.drivers[namespace] = d
+	return d, nil
+}
@@ -0,0 +1,34 @@
+package helm
+
+import "testing"
+
+func TestSQLStorageDSN(t *testing.T) {
+	tests := []struct {
+		storage  *SQLStorage
+		expected string
+	}{
+		{&SQLStorage{}, ""},
+		{
+			&SQLStorage{ConnectionString: "postgres://helm@db.example.com/helm", Host: "ignored"},
+			"postgres://helm@db.example.com/helm",
+		},
+		{
+			&SQLStorage{Host: "db.example.com", Port: 5432, Database: "helm", User: "helm", Password: `it's\secret`, SSLMode: "verify-full"},
+			`dbname='helm' host='db.example.com' password='it\'s\\secret' port='5432' sslmode='verify-full' user='helm'`,
+		},
+	}
+
+	for _, tt := range tests {
+		if dsn := tt.storage.DSN(); dsn != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, dsn)
+		}
+	}
+}
+
+func TestIsSQLDriver(t *testing.T) {
+	for v, expected := range map[string]bool{"sql": true, "SQL": true, "secret": false, "": false} {
+		if isSQLDriver(v) != expected {
+			t.Errorf("%q: expected %t", v, expected)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reservedReleaseLabels are the labels of the storage objects managed by Helm.
+var reservedReleaseLabels = map[string]bool{
+	"name":       true,
+	"owner":      true,
+	"status":     true,
+	"version":    true,
+	"createdAt":  true,
+	"modifiedAt": true,
+}
+
+// validateReleaseLabels rejects the labels managed by Helm.
+func validateReleaseLabels(v interface{}, k string) ([]string, []error) {
+	var errs []error
+	for label := range v.(map[string]interface{}) {
+		if reservedReleaseLabels[label] {
+			errs = append(errs, fmt.Errorf("%s: label %q is reserved by Helm", k, label))
+		}
+	}
+	return nil, errs
+}
+
+// storageNamespace returns the namespace the revisions of the release are
+// stored in: its storage_namespace, the storage_namespace of the provider, or
+// its namespace.
+func storageNamespace(d resourceGetter, m *Meta) string {
+	if ns := d.Get("storage_namespace").(string); ns != "" {
+		return ns
+	}
+	if m.StorageNamespace != "" {
+		return m.StorageNamespace
+	}
+	return d.Get("namespace").(string)
+}
+
+// releaseHelmConfiguration returns the Helm configuration of the release,
+// its revisions being stored in its storage namespace, and its debug output
+// logged with the release, its namespace and the phase.
+func releaseHelmConfiguration(d resourceGetter, m *Meta, phase string) (*action.Configuration, error) {
+	namespace := d.Get("namespace").(string)
+	cfg, err := m.getHelmConfiguration(namespace, storageNamespace(d, m))
+	if err != nil {
+		return nil, err
+	}
+	setReleaseLog(cfg, releaseLog(d.Get("name").(string), namespace, phase))
+	return cfg, nil
+}
+
+// storageObjectName returns the name of the Secret or ConfigMap storing the
+// revision of the release.
+func storageObjectName(rel *release.Release) string {
+	return fmt.Sprintf("%s.%s.v%d", storage.HelmStorageType, rel.Name, rel.Version)
+}
+
+// releaseStorageMetadata returns the labels and the annotations of the
+// storage objects of the release: those of the provider, overridden by
+// those of the release.
+func releaseStorageMetadata(d resourceGetter, m *Meta) (map[string]string, map[string]string) {
+	labels := map[string]string{}
+	for k, v := range m.ReleaseLabels {
+		labels[k] = v
+	}
+	for k, v := range expandStringMap(d.Get("release_labels")) {
+		labels[k] = v
+	}
+
+	annotations := map[string]string{}
+	for k, v := range m.ReleaseAnnotations {
+		annotations[k] = v
+	}
+	for k, v := range expandStringMap(d.Get("release_annotations")) {
+		annotations[k] = v
+	}
+	return labels, annotations
+}
+
+// validateReleaseMetadataDriver rejects the labels and annotations of the
+// release when the storage driver of the provider can't store them, so they
+// fail the plan instead of the apply once the release is installed.
+func validateReleaseMetadataDriver(d resourceGetter, m *Meta) error {
+	labels, annotations := releaseStorageMetadata(d, m)
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+
+	switch strings.ToLower(m.HelmDriver) {
+	case "", "secret", "secrets", "configmap", "configmaps":
+		return nil
+	}
+	return fmt.Errorf("release labels and annotations are not supported by the %s storage driver", m.HelmDriver)
+}
+
+// setReleaseMetadata sets the labels and the annotations on the storage
+// object of the revision of the release, as done for the labels by `helm
+// install --labels` since Helm 3.13. The labels can then be used to filter
+// the releases with `helm list -l`. The storage object is in the storage
+// namespace of the release.
+func setReleaseMetadata(cfg *action.Configuration, namespace string, rel *release.Release, labels, annotations map[string]string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	name := storageObjectName(rel)
+
+	switch cfg.Releases.Name() {
+	case driver.SecretsDriverName:
+		_, err = clientset.CoreV1().Secrets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case driver.ConfigMapsDriverName:
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	default:
+		return fmt.Errorf("release labels and annotations are not supported by the %s storage driver", cfg.Releases.Name())
+	}
+	return errors.Wrapf(err, "failed to set the labels and annotations of release %s", rel.Name)
+}
+
+// renameRelease moves the revisions of the release to the new name, leaving
+// its resources untouched. The resources are adopted by the release under
+// its new name on the next upgrade, which sets their ownership metadata.
+func renameRelease(cfg *action.Configuration, from, to string) error {
+	if _, err := cfg.Releases.History(to); err == nil {
+		return fmt.Errorf("cannot rename release %s to %s: release %s already exists", from, to, to)
+	}
+
+	history, err := cfg.Releases.History(from)
+	if err != nil {
+		return errors.Wrapf(err, "could not get the history of release %s", from)
+	}
+
+	for _, rel := range history {
+		renamed := *rel
+		renamed.Name = to
+		if err := cfg.Releases.Create(&renamed); err != nil {
+			return errors.Wrapf(err, "failed to create revision %d of release %s", rel.Version, to)
+		}
+	}
+	for _, rel := range history {
+		if _, err := cfg.Releases.Delete(from, rel.Version); err != nil {
+			return errors.Wrapf(err, "failed to delete revision %d of release %s", rel.Version, from)
+		}
+	}
+	return nil
+}
+
+// moveReleaseStorage moves the revisions of the release from the storage of
+// a Helm configuration to the storage of another, e.g. in another namespace.
+// The revisions are deleted once they are all copied.
+func moveReleaseStorage(from, to *action.Configuration, name string) error {
+	history, err := from.Releases.History(name)
+	if err != nil {
+		return errors.Wrapf(err, "could not get the history of release %s", name)
+	}
+
+	for _, rel := range history {
+		if err := to.Releases.Create(rel); err != nil && err != driver.ErrReleaseExists {
+			return errors.Wrapf(err, "failed to move revision %d of release %s", rel.Version, name)
+		}
+	}
+	for _, rel := range history {
+		if _, err := from.Releases.Delete(name, rel.Version); err != nil {
+			return errors.Wrapf(err, "failed to delete revision %d of release %s", rel.Version, name)
+		}
+	}
+	return nil
+}
+
+// moveReleaseStorageNamespace moves the revisions of the release to its new
+// storage namespace when its storage_namespace changes, under its previous
+// name if it is renamed too.
+func moveReleaseStorageNamespace(d *schema.ResourceData, m *Meta, to *action.Configuration) error {
+	old, _ := d.GetChange("storage_namespace")
+	from := old.(string)
+	if from == "" {
+		from = m.StorageNamespace
+	}
+	if from == "" {
+		from = d.Get("namespace").(string)
+	}
+	if from == storageNamespace(d, m) {
+		return nil
+	}
+
+	cfg, err := m.getHelmConfiguration(d.Get("namespace").(string), from)
+	if err != nil {
+		return err
+	}
+	name, _ := d.GetChange("name")
+	debug("Moving the revisions of release %s from namespace %s to %s", name, from, storageNamespace(d, m))
+	return moveReleaseStorage(cfg, to, name.(string))
+}
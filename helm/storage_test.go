@@ -0,0 +1,152 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestValidateReleaseLabels(t *testing.T) {
+	_, errs := validateReleaseLabels(map[string]interface{}{"team": "a", "env": "prod"}, "release_labels")
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	_, errs = validateReleaseLabels(map[string]interface{}{"team": "a", "owner": "b"}, "release_labels")
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
+
+func TestRenameRelease(t *testing.T) {
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	for _, r := range []*release.Release{
+		{Name: "old", Namespace: "default", Version: 1, Info: &release.Info{Status: release.StatusSuperseded}},
+		{Name: "old", Namespace: "default", Version: 2, Info: &release.Info{Status: release.StatusDeployed}},
+		{Name: "taken", Namespace: "default", Version: 1, Info: &release.Info{Status: release.StatusDeployed}},
+	} {
+		if err := cfg.Releases.Create(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := renameRelease(cfg, "old", "taken"); err == nil {
+		t.Error("expected an error renaming to an existing release")
+	}
+
+	if err := renameRelease(cfg, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Releases.History("old"); err == nil {
+		t.Error("expected the old release to be deleted")
+	}
+	history, err := cfg.Releases.History("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Errorf("expected 2 revisions, got %d", len(history))
+	}
+	last, err := cfg.Releases.Last("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Version != 2 || last.Info.Status != release.StatusDeployed {
+		t.Errorf("unexpected last revision %d %s", last.Version, last.Info.Status)
+	}
+}
+
+func TestMoveReleaseStorage(t *testing.T) {
+	from := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	to := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	for _, r := range []*release.Release{
+		{Name: "test", Namespace: "apps", Version: 1, Info: &release.Info{Status: release.StatusSuperseded}},
+		{Name: "test", Namespace: "apps", Version: 2, Info: &release.Info{Status: release.StatusDeployed}},
+	} {
+		if err := from.Releases.Create(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveReleaseStorage(from, to, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := from.Releases.History("test"); err == nil {
+		t.Error("expected the revisions to be deleted from the previous storage")
+	}
+	last, err := to.Releases.Last("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Version != 2 || last.Namespace != "apps" {
+		t.Errorf("unexpected last revision %d in namespace %s", last.Version, last.Namespace)
+	}
+}
+
+func TestStorageNamespace(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	d.Set("namespace", "apps")
+
+	if ns := storageNamespace(d, &Meta{}); ns != "apps" {
+		t.Errorf("expected the namespace of the release, got %q", ns)
+	}
+	if ns := storageNamespace(d, &Meta{StorageNamespace: "helm"}); ns != "helm" {
+		t.Errorf("expected the storage namespace of the provider, got %q", ns)
+	}
+	d.Set("storage_namespace", "releases")
+	if ns := storageNamespace(d, &Meta{StorageNamespace: "helm"}); ns != "releases" {
+		t.Errorf("expected the storage namespace of the release, got %q", ns)
+	}
+}
+
+func TestReleaseStorageMetadata(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	d.Set("release_labels", map[string]interface{}{"team": "payments"})
+	d.Set("release_annotations", map[string]interface{}{"backup.example.com/include": "false"})
+
+	m := &Meta{
+		ReleaseLabels:      map[string]string{"team": "platform", "env": "prod"},
+		ReleaseAnnotations: map[string]string{"backup.example.com/include": "true"},
+	}
+	labels, annotations := releaseStorageMetadata(d, m)
+
+	if expected := map[string]string{"team": "payments", "env": "prod"}; !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+	if expected := map[string]string{"backup.example.com/include": "false"}; !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("expected annotations %v, got %v", expected, annotations)
+	}
+	if m.ReleaseLabels["team"] != "platform" {
+		t.Errorf("expected the labels of the provider to be left as is, got %v", m.ReleaseLabels)
+	}
+}
+
+func TestValidateReleaseMetadataDriver(t *testing.T) {
+	d := resourceRelease().TestResourceData()
+	for _, driver := range []string{"", "secret", "configmap", "memory", "sql"} {
+		if err := validateReleaseMetadataDriver(d, &Meta{HelmDriver: driver}); err != nil {
+			t.Errorf("expected no error without labels for driver %q, got %s", driver, err)
+		}
+	}
+
+	d.Set("release_labels", map[string]interface{}{"team": "payments"})
+	for _, driver := range []string{"", "secrets", "configmaps"} {
+		if err := validateReleaseMetadataDriver(d, &Meta{HelmDriver: driver}); err != nil {
+			t.Errorf("expected the labels to be supported by driver %q, got %s", driver, err)
+		}
+	}
+	for _, driver := range []string{"memory", "sql"} {
+		if err := validateReleaseMetadataDriver(d, &Meta{HelmDriver: driver}); err == nil {
+			t.Errorf("expected the labels to be rejected by driver %q", driver)
+		}
+	}
+
+	d = resourceRelease().TestResourceData()
+	if err := validateReleaseMetadataDriver(d, &Meta{HelmDriver: "sql", ReleaseAnnotations: map[string]string{"a": "b"}}); err == nil {
+		t.Errorf("expected the annotations of the provider to be rejected by the sql driver")
+	}
+}
@@ -2,19 +2,29 @@ package helm
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/mitchellh/go-homedir"
+	"golang.org/x/oauth2"
 	"k8s.io/apimachinery/pkg/api/meta"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/transport"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/yaml"
 
 	apimachineryschema "k8s.io/apimachinery/pkg/runtime/schema"
 	memcached "k8s.io/client-go/discovery/cached/memory"
@@ -25,17 +35,298 @@ import (
 type KubeConfig struct {
 	ClientConfig clientcmd.ClientConfig
 
+	// QPS and Burst configure the client side rate limiting, zero values
+	// use the client-go defaults.
+	QPS   float32
+	Burst int
+
+	// BurstLimit is the minimum burst of the discovery client, which makes
+	// one request per API group version.
+	BurstLimit int
+
+	// RateLimiter, when set, is shared with the other clients of the
+	// provider and takes precedence over QPS and Burst.
+	RateLimiter flowcontrol.RateLimiter
+
+	// ProxyURL is the proxy used to reach the Kubernetes API server. When
+	// empty, the proxy-url of the cluster in the kubeconfig files is used.
+	ProxyURL string
+
+	// ImpersonateUID is the UID of the impersonated user, which is not
+	// supported by the client-go impersonation config.
+	ImpersonateUID string
+
+	configPaths []string
+	overrides   *clientcmd.ConfigOverrides
+
+	// oidc is the OpenID Connect auth provider config. The refreshed tokens
+	// are kept in memory instead of being written to the kubeconfig files.
+	oidc *oidcPersister
+
+	// tokenSource provides the bearer tokens of the built-in cloud
+	// authentication helpers, refreshed when they expire.
+	tokenSource oauth2.TokenSource
+
+	// discovery, when set, is shared with the other clients of the
+	// provider, which talk to the same cluster.
+	discovery *discoveryCache
+
 	sync.Mutex
 }
 
+// discoveryCache is the discovery client and the REST mapper shared by the
+// Kubernetes clients of the provider, so that the API resources of the
+// cluster are discovered once rather than for every operation. It is
+// invalidated by invalidating the discovery client, e.g. once CRDs are
+// installed: the mapper then discovers the API resources again on the next
+// unknown kind.
+type discoveryCache struct {
+	mutex  sync.Mutex
+	client discovery.CachedDiscoveryInterface
+	mapper meta.RESTMapper
+}
+
 // ToRESTConfig implemented interface method
 func (k *KubeConfig) ToRESTConfig() (*rest.Config, error) {
 	config, err := k.ToRawKubeConfigLoader().ClientConfig()
-	return config, err
+	if err != nil {
+		return nil, err
+	}
+
+	if k.QPS > 0 {
+		config.QPS = k.QPS
+	}
+	if k.Burst > 0 {
+		config.Burst = k.Burst
+	}
+	if k.RateLimiter != nil {
+		config.RateLimiter = k.RateLimiter
+	}
+
+	proxyURL, err := k.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		config.Wrap(proxyTransportWrapper(proxyURL))
+	}
+
+	if k.oidc != nil {
+		config.AuthProvider = &clientcmdapi.AuthProviderConfig{
+			Name:   "oidc",
+			Config: k.oidc.config(),
+		}
+		config.AuthConfigPersister = k.oidc
+	}
+
+	if k.tokenSource != nil {
+		config.Wrap(tokenSourceWrapper(k.tokenSource))
+	}
+
+	if k.ImpersonateUID != "" {
+		if config.Impersonate.UserName == "" {
+			return nil, fmt.Errorf("impersonating a UID requires a user, set `as`")
+		}
+		config.Wrap(impersonateUIDWrapper(k.ImpersonateUID))
+	}
+
+	return config, nil
+}
+
+// proxyURL returns the proxy to use for the Kubernetes API server, if any.
+func (k *KubeConfig) proxyURL() (*url.URL, error) {
+	proxy := k.ProxyURL
+	if proxy == "" {
+		p, err := k.kubeconfigProxyURL()
+		if err != nil {
+			return nil, err
+		}
+		proxy = p
+	}
+
+	if proxy == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %v", proxy, err)
+	}
+	return u, nil
+}
+
+// kubeconfigProxyCluster is the subset of a kubeconfig file needed to read
+// the proxy-url of its clusters, which is not supported by this version of
+// client-go.
+type kubeconfigProxyCluster struct {
+	Clusters []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			ProxyURL string `json:"proxy-url"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+}
+
+// kubeconfigProxyURL returns the proxy-url of the cluster of the current
+// context in the kubeconfig files.
+func (k *KubeConfig) kubeconfigProxyURL() (string, error) {
+	if len(k.configPaths) == 0 {
+		return "", nil
+	}
+
+	raw, err := k.ClientConfig.RawConfig()
+	if err != nil {
+		return "", err
+	}
+
+	cluster := ""
+	if k.overrides != nil {
+		cluster = k.overrides.Context.Cluster
+	}
+	if cluster == "" {
+		contextName := raw.CurrentContext
+		if k.overrides != nil && k.overrides.CurrentContext != "" {
+			contextName = k.overrides.CurrentContext
+		}
+		if c, ok := raw.Contexts[contextName]; ok {
+			cluster = c.Cluster
+		}
+	}
+	if cluster == "" {
+		return "", nil
+	}
+
+	// The first file defining the cluster wins, as in clientcmd.
+	for _, p := range k.configPaths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+
+		var c kubeconfigProxyCluster
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return "", fmt.Errorf("could not parse kubeconfig %q: %v", p, err)
+		}
+
+		for _, cc := range c.Clusters {
+			if cc.Name == cluster {
+				return cc.Cluster.ProxyURL, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// proxyTransportWrapper returns a transport wrapper sending the requests
+// through the given proxy.
+func proxyTransportWrapper(proxyURL *url.URL) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			log.Printf("[WARN] Unable to configure the proxy for the Kubernetes API: unexpected transport %T", rt)
+			return rt
+		}
+
+		// The transport may be shared by other clients, so we use a copy.
+		t = t.Clone()
+		t.Proxy = http.ProxyURL(proxyURL)
+		return t
+	}
+}
+
+// oidcPersister keeps the config of the OIDC auth provider in memory, so
+// that refreshed tokens are not written to the kubeconfig files.
+type oidcPersister struct {
+	mutex sync.Mutex
+	cfg   map[string]string
+}
+
+func (p *oidcPersister) config() map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	cfg := make(map[string]string, len(p.cfg))
+	for k, v := range p.cfg {
+		cfg[k] = v
+	}
+	return cfg
+}
+
+// Persist implements rest.AuthProviderConfigPersister
+func (p *oidcPersister) Persist(cfg map[string]string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.cfg = cfg
+	return nil
+}
+
+// expandOIDC returns the config of the OIDC auth provider, as expected by
+// the client-go oidc plugin.
+func expandOIDC(spec map[string]interface{}) map[string]string {
+	cfg := map[string]string{
+		"idp-issuer-url": spec["issuer_url"].(string),
+		"client-id":      spec["client_id"].(string),
+	}
+	for attr, key := range map[string]string{
+		"client_secret":  "client-secret",
+		"refresh_token":  "refresh-token",
+		"id_token":       "id-token",
+		"ca_certificate": "idp-certificate-authority-data",
+	} {
+		v := spec[attr].(string)
+		if v == "" {
+			continue
+		}
+		if attr == "ca_certificate" {
+			v = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		cfg[key] = v
+	}
+	if scopes := expandStringSlice(spec["extra_scopes"].([]interface{})); len(scopes) > 0 {
+		cfg["extra-scopes"] = strings.Join(scopes, ",")
+	}
+	return cfg
+}
+
+// impersonateUIDWrapper returns a transport wrapper setting the UID of the
+// impersonated user on the requests.
+func impersonateUIDWrapper(uid string) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = utilnet.CloneRequest(req)
+			req.Header.Set("Impersonate-Uid", uid)
+			return rt.RoundTrip(req)
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
 }
 
 // ToDiscoveryClient implemented interface method
 func (k *KubeConfig) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	if k.discovery == nil {
+		return k.newDiscoveryClient()
+	}
+
+	k.discovery.mutex.Lock()
+	defer k.discovery.mutex.Unlock()
+	if k.discovery.client == nil {
+		client, err := k.newDiscoveryClient()
+		if err != nil {
+			return nil, err
+		}
+		k.discovery.client = client
+	}
+	return k.discovery.client, nil
+}
+
+func (k *KubeConfig) newDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
 	config, err := k.ToRESTConfig()
 	if err != nil {
 		return nil, err
@@ -44,7 +335,13 @@ func (k *KubeConfig) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, er
 	// The more groups you have, the more discovery requests you need to make.
 	// given 25 groups (our groups + a few custom resources) with one-ish version each, discovery needs to make 50 requests
 	// double it just so we don't end up here again for a while.  This config is only used for discovery.
-	config.Burst = 100
+	burstLimit := k.BurstLimit
+	if burstLimit == 0 {
+		burstLimit = 100
+	}
+	if config.Burst < burstLimit {
+		config.Burst = burstLimit
+	}
 
 	return memcached.NewMemCacheClient(discovery.NewDiscoveryClientForConfigOrDie(config)), nil
 }
@@ -56,9 +353,21 @@ func (k *KubeConfig) ToRESTMapper() (meta.RESTMapper, error) {
 		return nil, err
 	}
 
+	if k.discovery == nil {
+		return newRESTMapper(discoveryClient), nil
+	}
+
+	k.discovery.mutex.Lock()
+	defer k.discovery.mutex.Unlock()
+	if k.discovery.mapper == nil {
+		k.discovery.mapper = newRESTMapper(discoveryClient)
+	}
+	return k.discovery.mapper, nil
+}
+
+func newRESTMapper(discoveryClient discovery.CachedDiscoveryInterface) meta.RESTMapper {
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient)
-	expander := restmapper.NewShortcutExpander(mapper, discoveryClient)
-	return expander, nil
+	return restmapper.NewShortcutExpander(mapper, discoveryClient)
 }
 
 // ToRawKubeConfigLoader implemented interface method
@@ -84,8 +393,8 @@ func newKubeConfig(configData *schema.ResourceData, namespace *string) (*KubeCon
 		configPaths = filepath.SplitList(v)
 	}
 
+	expandedPaths := []string{}
 	if len(configPaths) > 0 {
-		expandedPaths := []string{}
 		for _, p := range configPaths {
 			path, err := homedir.Expand(p)
 			if err != nil {
@@ -129,6 +438,9 @@ func newKubeConfig(configData *schema.ResourceData, namespace *string) (*KubeCon
 	if v, ok := k8sGetOk(configData, "insecure"); ok {
 		overrides.ClusterInfo.InsecureSkipTLSVerify = v.(bool)
 	}
+	if v, ok := k8sGetOk(configData, "tls_server_name"); ok {
+		overrides.ClusterInfo.TLSServerName = v.(string)
+	}
 	if v, ok := k8sGetOk(configData, "cluster_ca_certificate"); ok {
 		overrides.ClusterInfo.CertificateAuthorityData = bytes.NewBufferString(v.(string)).Bytes()
 	}
@@ -163,15 +475,20 @@ func newKubeConfig(configData *schema.ResourceData, namespace *string) (*KubeCon
 		overrides.AuthInfo.Token = v.(string)
 	}
 
+	if v, ok := k8sGetOk(configData, "as"); ok {
+		overrides.AuthInfo.Impersonate = v.(string)
+	}
+	if v, ok := k8sGetOk(configData, "as_groups"); ok {
+		overrides.AuthInfo.ImpersonateGroups = expandStringSlice(v.([]interface{}))
+	}
+
 	if v, ok := k8sGetOk(configData, "exec"); ok {
 		exec := &clientcmdapi.ExecConfig{}
 		if spec, ok := v.([]interface{})[0].(map[string]interface{}); ok {
 			exec.APIVersion = spec["api_version"].(string)
 			exec.Command = spec["command"].(string)
 			exec.Args = expandStringSlice(spec["args"].([]interface{}))
-			for kk, vv := range spec["env"].(map[string]interface{}) {
-				exec.Env = append(exec.Env, clientcmdapi.ExecEnvVar{Name: kk, Value: vv.(string)})
-			}
+			exec.Env = expandExecEnv(spec, os.Environ())
 		} else {
 			log.Printf("[ERROR] Failed to parse exec")
 			return nil, fmt.Errorf("failed to parse exec")
@@ -192,5 +509,111 @@ func newKubeConfig(configData *schema.ResourceData, namespace *string) (*KubeCon
 	}
 	log.Printf("[INFO] Successfully initialized kubernetes config")
 
-	return &KubeConfig{ClientConfig: client}, nil
+	kc := &KubeConfig{
+		ClientConfig: client,
+		configPaths:  expandedPaths,
+		overrides:    overrides,
+	}
+	if v, ok := k8sGetOk(configData, "proxy_url"); ok {
+		kc.ProxyURL = v.(string)
+	}
+	if v, ok := k8sGetOk(configData, "qps"); ok {
+		kc.QPS = float32(v.(float64))
+	}
+	if v, ok := k8sGetOk(configData, "burst"); ok {
+		kc.Burst = v.(int)
+	}
+	if v, ok := k8sGetOk(configData, "as_uid"); ok {
+		kc.ImpersonateUID = v.(string)
+	}
+	if v, ok := k8sGetOk(configData, "oidc"); ok {
+		spec, ok := v.([]interface{})[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to parse oidc")
+		}
+		kc.oidc = &oidcPersister{cfg: expandOIDC(spec)}
+	}
+	if v, ok := k8sGetOk(configData, "eks"); ok {
+		spec, ok := v.([]interface{})[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to parse eks")
+		}
+		ts, err := newEKSTokenSource(spec["cluster_name"].(string), spec["region"].(string), spec["role_arn"].(string))
+		if err != nil {
+			return nil, err
+		}
+		kc.tokenSource = oauth2.ReuseTokenSource(nil, ts)
+	}
+	if v, ok := k8sGetOk(configData, "gke"); ok {
+		// All the attributes are optional, an empty block has no map.
+		spec, _ := v.([]interface{})[0].(map[string]interface{})
+		var credentials string
+		var scopes []string
+		if spec != nil {
+			credentials = spec["credentials"].(string)
+			scopes = expandStringSlice(spec["scopes"].([]interface{}))
+		}
+		ts, err := newGKETokenSource(credentials, scopes)
+		if err != nil {
+			return nil, err
+		}
+		kc.tokenSource = oauth2.ReuseTokenSource(nil, ts)
+	}
+	if v, ok := k8sGetOk(configData, "azure"); ok {
+		spec, _ := v.([]interface{})[0].(map[string]interface{})
+		if spec == nil {
+			spec = map[string]interface{}{}
+		}
+		ts, err := newAzureTokenSource(azureOptions{
+			tenantID:     azureGet(spec, "tenant_id", "ARM_TENANT_ID"),
+			clientID:     azureGet(spec, "client_id", "ARM_CLIENT_ID"),
+			clientSecret: azureGet(spec, "client_secret", "ARM_CLIENT_SECRET"),
+			useMSI:       spec["use_msi"] == true || os.Getenv("ARM_USE_MSI") == "true",
+			serverID:     azureGet(spec, "server_id", ""),
+			endpoint:     azureGet(spec, "active_directory_endpoint", ""),
+		})
+		if err != nil {
+			return nil, err
+		}
+		kc.tokenSource = oauth2.ReuseTokenSource(nil, ts)
+	}
+
+	return kc, nil
+}
+
+// execKeptEnv are the variables of the provider kept when inherit_env is
+// false: the plugins, e.g. aws or kubelogin, are looked up in the PATH and
+// read their configuration from the HOME directory.
+var execKeptEnv = map[string]bool{
+	"PATH": true,
+	"HOME": true,
+}
+
+// expandExecEnv returns the environment variables set for the exec plugin.
+// The Kubernetes client always runs the plugin with the environment of the
+// provider, so when inherit_env is false the variables which are neither
+// kept nor passed through are overridden with empty values: they are still
+// defined.
+func expandExecEnv(spec map[string]interface{}, environ []string) []clientcmdapi.ExecEnvVar {
+	env := spec["env"].(map[string]interface{})
+
+	var vars []clientcmdapi.ExecEnvVar
+	if inherit, ok := spec["inherit_env"].(bool); ok && !inherit {
+		passthrough := map[string]bool{}
+		for _, name := range expandStringSlice(spec["env_passthrough"].([]interface{})) {
+			passthrough[name] = true
+		}
+		for _, kv := range environ {
+			name := strings.SplitN(kv, "=", 2)[0]
+			if _, ok := env[name]; ok || name == "" || passthrough[name] || execKeptEnv[name] {
+				continue
+			}
+			vars = append(vars, clientcmdapi.ExecEnvVar{Name: name})
+		}
+	}
+
+	for kk, vv := range env {
+		vars = append(vars, clientcmdapi.ExecEnvVar{Name: kk, Value: vv.(string)})
+	}
+	return vars
 }
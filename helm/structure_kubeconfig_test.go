@@ -0,0 +1,221 @@
+package helm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const testKubeconfigWithProxy = `apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+    proxy-url: socks5://127.0.0.1:1080
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func TestKubeConfigProxyURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfigWithProxy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config   map[string]interface{}
+		expected string
+	}{
+		{
+			config:   map[string]interface{}{"config_path": path},
+			expected: "socks5://127.0.0.1:1080",
+		},
+		{
+			config:   map[string]interface{}{"config_path": path, "proxy_url": "http://proxy.example.com:3128"},
+			expected: "http://proxy.example.com:3128",
+		},
+	}
+
+	for _, tt := range tests {
+		d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+			"kubernetes": []interface{}{tt.config},
+		})
+
+		kc, err := newKubeConfig(d, nil)
+		if err != nil {
+			t.Fatalf("error creating kubeconfig: %v", err)
+		}
+
+		u, err := kc.proxyURL()
+		if err != nil {
+			t.Fatalf("error getting proxy URL: %v", err)
+		}
+		if u == nil || u.String() != tt.expected {
+			t.Fatalf("expected proxy URL %q, got %v", tt.expected, u)
+		}
+
+		if _, err := kc.ToRESTConfig(); err != nil {
+			t.Fatalf("error creating REST config: %v", err)
+		}
+	}
+}
+
+func TestExpandExecEnv(t *testing.T) {
+	environ := []string{"AWS_PROFILE=prod", "AWS_REGION=eu-west-1", "PATH=/usr/bin", "HOME=/home/terraform", "SECRET=s3cr3t"}
+
+	spec := map[string]interface{}{
+		"env":             map[string]interface{}{"FOO": "bar"},
+		"inherit_env":     true,
+		"env_passthrough": []interface{}{},
+	}
+	env := expandExecEnv(spec, environ)
+	if len(env) != 1 || env[0].Name != "FOO" || env[0].Value != "bar" {
+		t.Fatalf("expected only FOO to be set, got %v", env)
+	}
+
+	spec["inherit_env"] = false
+	spec["env_passthrough"] = []interface{}{"AWS_PROFILE", "AWS_REGION"}
+	cleared := map[string]bool{}
+	for _, v := range expandExecEnv(spec, environ) {
+		if v.Value == "" {
+			cleared[v.Name] = true
+		}
+	}
+	if len(cleared) != 1 || !cleared["SECRET"] {
+		t.Fatalf("expected only SECRET to be cleared, PATH and HOME being kept, got %v", cleared)
+	}
+
+	spec["env"] = map[string]interface{}{"PATH": "/opt/bin"}
+	for _, v := range expandExecEnv(spec, environ) {
+		if v.Name == "PATH" && v.Value != "/opt/bin" {
+			t.Fatalf("expected the PATH of env to be set, got %q", v.Value)
+		}
+	}
+}
+
+func TestImpersonateUIDWrapper(t *testing.T) {
+	var header http.Header
+	rt := impersonateUIDWrapper("1234")(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	req, _ := http.NewRequest("GET", "https://127.0.0.1:6443/api", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Get("Impersonate-Uid") != "1234" {
+		t.Fatalf("expected the Impersonate-Uid header to be set, got %v", header)
+	}
+	if req.Header.Get("Impersonate-Uid") != "" {
+		t.Fatal("expected the original request not to be modified")
+	}
+}
+
+func TestExpandOIDC(t *testing.T) {
+	cfg := expandOIDC(map[string]interface{}{
+		"issuer_url":     "https://issuer.example.com",
+		"client_id":      "kubernetes",
+		"client_secret":  "",
+		"refresh_token":  "refresh",
+		"id_token":       "",
+		"ca_certificate": "-----BEGIN CERTIFICATE-----",
+		"extra_scopes":   []interface{}{"groups", "email"},
+	})
+
+	expected := map[string]string{
+		"idp-issuer-url":                 "https://issuer.example.com",
+		"client-id":                      "kubernetes",
+		"refresh-token":                  "refresh",
+		"idp-certificate-authority-data": "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0t",
+		"extra-scopes":                   "groups,email",
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("expected %v, got %v", expected, cfg)
+	}
+
+	p := &oidcPersister{cfg: cfg}
+	if err := p.Persist(map[string]string{"id-token": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.config()["id-token"] != "new" {
+		t.Fatalf("expected the refreshed token to be kept, got %v", p.config())
+	}
+}
+
+func TestMetaKubeConfigReused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfigWithProxy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"kubernetes": []interface{}{map[string]interface{}{"config_path": path}},
+	})
+	m := &Meta{data: d}
+
+	a, err := m.newKubeConfig("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := m.newKubeConfig("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.newKubeConfig("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != again {
+		t.Error("expected the configuration of the namespace to be reused")
+	}
+	if a == b {
+		t.Error("expected a configuration per namespace")
+	}
+
+	dc, err := a.ToDiscoveryClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.ToDiscoveryClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc != other {
+		t.Error("expected the discovery client to be shared")
+	}
+	mapper, err := a.ToRESTMapper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := b.ToRESTMapper(); mapper != other {
+		t.Error("expected the REST mapper to be shared")
+	}
+}
@@ -0,0 +1,326 @@
+package helm
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// The deletion cascades of the resources of a release, as in `helm
+// uninstall --cascade`.
+const (
+	cascadeBackground = "background"
+	cascadeForeground = "foreground"
+	cascadeOrphan     = "orphan"
+)
+
+var cascadePolicies = map[string]metav1.DeletionPropagation{
+	cascadeBackground: metav1.DeletePropagationBackground,
+	cascadeForeground: metav1.DeletePropagationForeground,
+	cascadeOrphan:     metav1.DeletePropagationOrphan,
+}
+
+// cascadeKubeClient deletes the resources with the given propagation
+// policy, Helm always deleting them in the background. With the foreground
+// cascade, it waits for the resources and their dependents to be deleted.
+type cascadeKubeClient struct {
+	kube.Interface
+	propagation metav1.DeletionPropagation
+	timeout     time.Duration
+}
+
+// Delete implements kube.Interface
+func (c *cascadeKubeClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	var errs []error
+	res := &kube.Result{}
+	for _, info := range resources {
+		debug("Deleting %q %s with the %s propagation policy", info.Name, info.Mapping.GroupVersionKind.Kind, c.propagation)
+		opts := &metav1.DeleteOptions{PropagationPolicy: &c.propagation}
+		_, err := resource.NewHelper(info.Client, info.Mapping).DeleteWithOptions(info.Namespace, info.Name, opts)
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		res.Deleted = append(res.Deleted, info)
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	if c.propagation == metav1.DeletePropagationForeground {
+		if err := waitForDeletion(res.Deleted, c.timeout); err != nil {
+			return nil, []error{err}
+		}
+	}
+	return res, nil
+}
+
+// waitForDeletion waits until the resources are deleted.
+func waitForDeletion(resources kube.ResourceList, timeout time.Duration) error {
+	return wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		for _, info := range resources {
+			err := info.Get()
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			debug("Waiting for %q %s to be deleted", info.Name, info.Mapping.GroupVersionKind.Kind)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// releaseResources returns the resources of the last revision of the
+// release to wait for on uninstall: those Helm deletes, the resources kept
+// by their resource policy being left out.
+func releaseResources(cfg *action.Configuration, name string) (kube.ResourceList, error) {
+	rel, err := cfg.Releases.Last(name)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := cfg.KubeClient.Build(strings.NewReader(rel.Manifest), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build the resources of release %s", name)
+	}
+
+	var deleted kube.ResourceList
+	for _, info := range resources {
+		if acc, err := meta.Accessor(info.Object); err == nil && keptByPolicy(acc.GetAnnotations()) {
+			continue
+		}
+		deleted = append(deleted, info)
+	}
+	return deleted, nil
+}
+
+// statefulSetClaims returns the claims created from the volume claim
+// templates of the StatefulSets of the resources, named
+// <template>-<statefulset>-<ordinal>, which Kubernetes never deletes.
+func statefulSetClaims(resources kube.ResourceList, claims []corev1.PersistentVolumeClaim) []corev1.PersistentVolumeClaim {
+	var prefixes []string
+	for _, info := range resources {
+		obj, ok := info.Object.(*unstructured.Unstructured)
+		if !ok || obj.GetKind() != "StatefulSet" {
+			continue
+		}
+		templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		for _, t := range templates {
+			if name, _, _ := unstructured.NestedString(t.(map[string]interface{}), "metadata", "name"); name != "" {
+				prefixes = append(prefixes, info.Namespace+"/"+name+"-"+obj.GetName()+"-")
+			}
+		}
+	}
+
+	var owned []corev1.PersistentVolumeClaim
+	for _, pvc := range claims {
+		key := pvc.Namespace + "/" + pvc.Name
+		for _, prefix := range prefixes {
+			ordinal := strings.TrimPrefix(key, prefix)
+			if _, err := strconv.Atoi(ordinal); err == nil && ordinal != key {
+				owned = append(owned, pvc)
+				break
+			}
+		}
+	}
+	return owned
+}
+
+// releaseClaims returns the claims of the StatefulSets of the resources.
+func releaseClaims(cfg *action.Configuration, resources kube.ResourceList) ([]corev1.PersistentVolumeClaim, error) {
+	namespaces := map[string]bool{}
+	for _, info := range resources {
+		if obj, ok := info.Object.(*unstructured.Unstructured); ok && obj.GetKind() == "StatefulSet" {
+			namespaces[info.Namespace] = true
+		}
+	}
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	var claims []corev1.PersistentVolumeClaim
+	for ns := range namespaces {
+		list, err := clientset.CoreV1().PersistentVolumeClaims(ns).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list the persistent volume claims of namespace %s", ns)
+		}
+		claims = append(claims, list.Items...)
+	}
+	return statefulSetClaims(resources, claims), nil
+}
+
+// deleteClaims deletes the claims.
+func deleteClaims(clientset kubernetes.Interface, claims []corev1.PersistentVolumeClaim) error {
+	for _, pvc := range claims {
+		debug("Deleting persistent volume claim %s/%s", pvc.Namespace, pvc.Name)
+		err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(context.Background(), pvc.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete persistent volume claim %s/%s", pvc.Namespace, pvc.Name)
+		}
+	}
+	return nil
+}
+
+// waitForClaimsDeletion waits until the claims are deleted, which their
+// finalizer holds while they are used by pods.
+func waitForClaimsDeletion(clientset kubernetes.Interface, claims []corev1.PersistentVolumeClaim, timeout time.Duration) error {
+	return wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		for _, pvc := range claims {
+			_, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.Background(), pvc.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			debug("Waiting for persistent volume claim %s/%s to be deleted", pvc.Namespace, pvc.Name)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// deleteReleaseClaims deletes the claims of the StatefulSets of the
+// uninstalled release, waiting for them to be deleted if set.
+func deleteReleaseClaims(cfg *action.Configuration, claims []corev1.PersistentVolumeClaim, wait bool, timeout time.Duration) error {
+	if len(claims) == 0 {
+		return nil
+	}
+	clientset, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+	if err := deleteClaims(clientset, claims); err != nil {
+		return err
+	}
+	if !wait {
+		return nil
+	}
+	return errors.Wrap(waitForClaimsDeletion(clientset, claims, timeout), "the persistent volume claims of the release were not deleted")
+}
+
+// keptByPolicy reports whether the resource of the annotations is kept on
+// uninstall by its resource policy, as Helm reads it.
+func keptByPolicy(annotations map[string]string) bool {
+	return strings.ToLower(strings.TrimSpace(annotations[kube.ResourcePolicyAnno])) == kube.KeepPolicy
+}
+
+// releaseManifests returns the manifests of the release, in the order
+// Helm installs them.
+func releaseManifests(manifest string) []string {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, manifests[k])
+	}
+	return out
+}
+
+// keptResources returns the resources of the manifest which Helm keeps on
+// uninstall for their resource policy, as kind/name.
+func keptResources(manifest string) ([]string, error) {
+	var kept []string
+	for _, m := range releaseManifests(manifest) {
+		var head releaseutil.SimpleHead
+		if err := yaml.Unmarshal([]byte(m), &head); err != nil {
+			return nil, errors.Wrap(err, "failed to parse the manifest")
+		}
+		if head.Metadata != nil && keptByPolicy(head.Metadata.Annotations) {
+			kept = append(kept, head.Kind+"/"+head.Metadata.Name)
+		}
+	}
+	sort.Strings(kept)
+	return kept, nil
+}
+
+// removeResourcePolicy removes the keep resource policy of the resources of
+// the manifest, so that Helm deletes them like the other resources.
+func removeResourcePolicy(manifest string) (string, bool, error) {
+	var out []string
+	removed := false
+	for _, m := range releaseManifests(manifest) {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(m), &obj); err != nil {
+			return "", false, errors.Wrap(err, "failed to parse the manifest")
+		}
+		annotations, _, _ := unstructured.NestedStringMap(obj, "metadata", "annotations")
+		if !keptByPolicy(annotations) {
+			out = append(out, m)
+			continue
+		}
+
+		unstructured.RemoveNestedField(obj, "metadata", "annotations", kube.ResourcePolicyAnno)
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", false, err
+		}
+		// The source of the manifest names it in the messages of Helm.
+		if source := manifestSource.FindString(m); source != "" {
+			data = append([]byte(source+"\n"), data...)
+		}
+		out = append(out, string(data))
+		removed = true
+	}
+	return strings.Join(out, "\n---\n"), removed, nil
+}
+
+// deleteKeptResources removes the keep resource policy of the resources of
+// the last release, so that they are deleted when it is uninstalled.
+func deleteKeptResources(cfg *action.Configuration, name string) error {
+	rel, err := cfg.Releases.Last(name)
+	if err != nil {
+		return err
+	}
+
+	manifest, removed, err := removeResourcePolicy(rel.Manifest)
+	if err != nil {
+		return errors.Wrapf(err, "release %s", name)
+	}
+	if !removed {
+		return nil
+	}
+
+	debug("Deleting the kept resources of release %s", name)
+	rel.Manifest = manifest
+	return cfg.Releases.Update(rel)
+}
+
+// releaseKeptResources returns the resources of the last release which are
+// kept on uninstall for their resource policy.
+func releaseKeptResources(cfg *action.Configuration, name string) ([]string, error) {
+	rel, err := cfg.Releases.Last(name)
+	if err != nil {
+		return nil, err
+	}
+	kept, err := keptResources(rel.Manifest)
+	return kept, errors.Wrapf(err, "release %s", name)
+}
@@ -0,0 +1,94 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestStatefulSetClaims(t *testing.T) {
+	sts := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata":   map[string]interface{}{"name": "redis"},
+		"spec": map[string]interface{}{
+			"volumeClaimTemplates": []interface{}{
+				map[string]interface{}{"metadata": map[string]interface{}{"name": "data"}},
+			},
+		},
+	}}
+	resources := kube.ResourceList{{Namespace: "default", Name: "redis", Object: sts}}
+
+	claim := func(namespace, name string) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	claims := []corev1.PersistentVolumeClaim{
+		claim("default", "data-redis-0"),
+		claim("default", "data-redis-1"),
+		claim("default", "data-redis-replica-0"),
+		claim("default", "data-redis"),
+		claim("other", "data-redis-0"),
+		claim("default", "logs-redis-0"),
+	}
+
+	expected := claims[:2]
+	if owned := statefulSetClaims(resources, claims); !reflect.DeepEqual(owned, expected) {
+		t.Errorf("expected %v, got %v", expected, owned)
+	}
+	if owned := statefulSetClaims([]*resource.Info{}, claims); owned != nil {
+		t.Errorf("expected no claims without StatefulSets, got %v", owned)
+	}
+}
+
+func TestKeptResources(t *testing.T) {
+	manifest := `---
+# Source: test/templates/pvc.yaml
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  annotations:
+    helm.sh/resource-policy: " Keep"
+    example.com/owner: team
+spec:
+  accessModes: ["ReadWriteOnce"]
+---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+
+	kept, err := keptResources(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"PersistentVolumeClaim/data"}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected %v, got %v", expected, kept)
+	}
+
+	out, removed, err := removeResourcePolicy(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed {
+		t.Fatal("expected the resource policy to be removed")
+	}
+	if kept, err := keptResources(out); err != nil || kept != nil {
+		t.Errorf("expected no kept resources, got %v, %v", kept, err)
+	}
+	if !strings.Contains(out, "# Source: test/templates/pvc.yaml") || !strings.Contains(out, "example.com/owner: team") {
+		t.Errorf("expected the source and the other annotations to be kept, got:\n%s", out)
+	}
+
+	if _, removed, _ := removeResourcePolicy(out); removed {
+		t.Error("expected nothing to be removed")
+	}
+}
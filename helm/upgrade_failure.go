@@ -0,0 +1,95 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The actions taken when an upgrade fails.
+const (
+	upgradeFailureRollback = "rollback"
+	upgradeFailureLeave    = "leave"
+)
+
+// The classes of the upgrade failures.
+const (
+	upgradeFailureTimeout = "timeout"
+	upgradeFailureError   = "error"
+)
+
+// upgradeFailureClass returns the class of the error of the upgrade.
+func upgradeFailureClass(ctx context.Context, err error) string {
+	if errors.Is(err, wait.ErrWaitTimeout) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return upgradeFailureTimeout
+	}
+	return upgradeFailureError
+}
+
+// handleUpgradeFailure applies the upgrade_failure_policy of the release to
+// the failed upgrade, and reports the action taken along with the error.
+// Only the failed revisions created by the upgrade are rolled back, the
+// upgrades failing before, e.g. on template errors, leave the release
+// untouched.
+func handleUpgradeFailure(ctx context.Context, d *schema.ResourceData, cfg *action.Configuration, name string, previousRevision int, err error) diag.Diagnostics {
+	diags := releaseDiagnostics(err)
+	if len(d.Get("upgrade_failure_policy").([]interface{})) == 0 {
+		return diags
+	}
+
+	last, lerr := cfg.Releases.Last(name)
+	if lerr != nil || last.Version <= previousRevision || last.Info.Status != release.StatusFailed {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Release left untouched",
+			Detail:   fmt.Sprintf("The upgrade of release %q failed before creating a new revision, there is nothing to roll back.", name),
+		})
+	}
+
+	class := upgradeFailureClass(ctx, err)
+	rollback := d.Get("upgrade_failure_policy.0.action").(string) == upgradeFailureRollback
+	if classes := d.Get("upgrade_failure_policy.0.rollback_on").(*schema.Set); rollback && classes.Len() > 0 {
+		rollback = classes.Contains(class)
+	}
+
+	if !rollback {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Failed release left for inspection",
+			Detail:   fmt.Sprintf("Revision %d of release %q failed (%s) and was left as is, as set by upgrade_failure_policy.", last.Version, name, class),
+		})
+	}
+
+	client := action.NewRollback(cfg)
+	client.Version = previousRevision
+	client.Timeout = releaseTimeout(d, schema.TimeoutUpdate)
+	client.Wait = d.Get("wait").(bool)
+	client.DisableHooks = hooksDisabled(d, "rollback")
+	client.CleanupOnFail = d.Get("cleanup_on_fail").(bool)
+
+	// The hooks skipped on upgrade are tracked per operation.
+	if hooks, ok := cfg.KubeClient.(*hookKubeClient); ok {
+		cfg.KubeClient = newHookKubeClient(d, hooks.Interface, "rollback")
+	}
+
+	debug("[handleUpgradeFailure: %s] Rolling back to revision %d", name, previousRevision)
+	if rerr := client.Run(name); rerr != nil {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  "Rollback failed",
+			Detail:   fmt.Sprintf("Revision %d of release %q failed (%s) and could not be rolled back to revision %d: %s", last.Version, name, class, previousRevision, rerr),
+		})
+	}
+
+	return append(diags, diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "Release rolled back",
+		Detail:   fmt.Sprintf("Revision %d of release %q failed (%s) and was rolled back to revision %d, as set by upgrade_failure_policy.", last.Version, name, class, previousRevision),
+	})
+}
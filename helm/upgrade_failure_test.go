@@ -0,0 +1,64 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestUpgradeFailureClass(t *testing.T) {
+	ctx := context.Background()
+	if c := upgradeFailureClass(ctx, fmt.Errorf("release test failed: %w", wait.ErrWaitTimeout)); c != upgradeFailureTimeout {
+		t.Errorf("expected %q, got %q", upgradeFailureTimeout, c)
+	}
+	if c := upgradeFailureClass(ctx, errors.New("admission webhook denied the request")); c != upgradeFailureError {
+		t.Errorf("expected %q, got %q", upgradeFailureError, c)
+	}
+}
+
+func TestHandleUpgradeFailure(t *testing.T) {
+	cfg := &action.Configuration{Releases: storage.Init(driver.NewMemory())}
+	for _, r := range []*release.Release{
+		{Name: "test", Version: 1, Info: &release.Info{Status: release.StatusSuperseded}},
+		{Name: "test", Version: 2, Info: &release.Info{Status: release.StatusFailed}},
+	} {
+		if err := cfg.Releases.Create(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceRelease().Schema, map[string]interface{}{
+		"name":  "test",
+		"chart": "test",
+		"upgrade_failure_policy": []interface{}{map[string]interface{}{
+			"action":      "rollback",
+			"rollback_on": []interface{}{"timeout"},
+		}},
+	})
+
+	tests := []struct {
+		previousRevision int
+		summary          string
+	}{
+		// The failed revision 2 was created by the upgrade, but the error
+		// isn't a timeout.
+		{1, "Failed release left for inspection"},
+		// The upgrade failed before creating a revision.
+		{2, "Release left untouched"},
+	}
+
+	for _, tt := range tests {
+		diags := handleUpgradeFailure(context.Background(), d, cfg, "test", tt.previousRevision, errors.New("upgrade failed"))
+		if len(diags) != 2 || !diags.HasError() || diags[1].Summary != tt.summary {
+			t.Errorf("revision %d: expected the error and %q, got %v", tt.previousRevision, tt.summary, diags)
+		}
+	}
+}
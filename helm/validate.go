@@ -0,0 +1,350 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// manifestSource matches the comment of a rendered manifest naming its
+// template.
+var manifestSource = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+
+// renderManifests renders the chart like helm template, with the
+// capabilities of the cluster, and returns the rendered manifests, the hooks
+// included. It returns no manifests if the dependencies of the chart are
+// missing, since they are only updated on apply.
+func renderManifests(d *schema.ResourceDiff, c *chart.Chart, caps *chartutil.Capabilities) ([]string, error) {
+	if err := action.CheckDependencies(c, c.Metadata.Dependencies); err != nil {
+		debug("Unable to render the manifests: %s", err)
+		return nil, nil
+	}
+
+	values, err := getValues(d)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := renderRelease(d, c, values, caps, d.Id() != "")
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := splitManifest(rel.Manifest)
+	for _, h := range rel.Hooks {
+		manifests = append(manifests, h.Manifest)
+	}
+	sort.Strings(manifests)
+	return manifests, nil
+}
+
+// renderRelease renders the chart with the values, as a dry run against a
+// fake cluster with the given capabilities: helm template would override
+// them with its defaults.
+func renderRelease(d resourceGetter, c *chart.Chart, values map[string]interface{}, caps *chartutil.Capabilities, isUpgrade bool) (*release.Release, error) {
+	mem := driver.NewMemory()
+	mem.SetNamespace(d.Get("namespace").(string))
+	cfg := &action.Configuration{
+		Capabilities: caps,
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Releases:     storage.Init(mem),
+		Log:          releaseLog(d.Get("name").(string), d.Get("namespace").(string), phasePlan),
+	}
+
+	client := action.NewInstall(cfg)
+	client.DryRun = true
+	client.IsUpgrade = isUpgrade
+	client.IncludeCRDs = crdPolicy(d) != crdPolicySkip
+	client.Namespace = d.Get("namespace").(string)
+	client.ReleaseName = d.Get("name").(string)
+	if client.ReleaseName == "" {
+		client.ReleaseName = "release-name"
+	}
+
+	var err error
+	client.PostRenderer, err = releasePostRenderer(d)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := client.Run(c, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render the chart")
+	}
+	return rel, nil
+}
+
+// renderClusterRelease renders the chart at path with the values and the
+// capabilities of the cluster of the configuration.
+func renderClusterRelease(cfg *action.Configuration, d resourceGetter, path string, values map[string]interface{}, isUpgrade bool) (*release.Release, error) {
+	// The chart is loaded again, Helm processing its dependencies when
+	// rendering it.
+	c, err := loader.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := cfg.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := clusterCapabilities(dc)
+	if err != nil {
+		return nil, err
+	}
+	return renderRelease(d, c, values, caps, isUpgrade)
+}
+
+// validateManifests validates the rendered manifests against the OpenAPI
+// schemas of the cluster, which include those of the installed CRDs. The
+// custom resources of the CRDs which are not installed yet can't be
+// validated, they are skipped.
+func validateManifests(kubeClient kube.Interface, manifests []string) error {
+	var errs []string
+	for _, manifest := range manifests {
+		_, err := kubeClient.Build(strings.NewReader(manifest), true)
+		if err == nil {
+			continue
+		}
+		if strings.Contains(err.Error(), "no matches for kind") {
+			debug("Skipping the validation of %s: %s", manifestName(manifest), err)
+			continue
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", manifestName(manifest), err))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.Strings(errs)
+	return fmt.Errorf("invalid manifests: \n\t%s", strings.Join(errs, "\n\t"))
+}
+
+// manifestName returns the template of the rendered manifest.
+func manifestName(manifest string) string {
+	if m := manifestSource.FindStringSubmatch(manifest); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return "manifest"
+}
+
+// checkManifests renders the chart and checks the rendered manifests before
+// anything is applied: they are validated against the schemas of the
+// cluster if validate_manifests is set, against the policies of the policy
+// block, and for the API versions removed from the cluster if
+// check_removed_apis is set.
+func checkManifests(d *schema.ResourceDiff, m *Meta, c *chart.Chart) error {
+	actionConfig, err := releaseHelmConfiguration(d, m, phasePlan)
+	if err == nil {
+		err = actionConfig.KubeClient.IsReachable()
+	}
+	if err != nil {
+		// The checks which don't need the cluster are run against the
+		// capabilities of the provider in template_only_plan mode.
+		if m.TemplateOnlyPlan {
+			debug("Checking the manifests client-side, the cluster is not reachable: %s", err)
+			return checkManifestsClientSide(d, m, c)
+		}
+		// The cluster of a new release may be created in the same apply,
+		// its connection settings being unknown when planning. The checks
+		// are deferred to the next plan rather than failing this one.
+		if d.Id() == "" {
+			debug("Skipping the checks of the manifests, the cluster is not reachable: %s", err)
+			return nil
+		}
+		return err
+	}
+
+	dc, err := actionConfig.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+	caps, err := clusterCapabilities(dc)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := renderManifests(d, c, caps)
+	if err != nil {
+		return err
+	}
+
+	if d.Get("validate_manifests").(bool) {
+		if err := validateManifests(actionConfig.KubeClient, manifests); err != nil {
+			return err
+		}
+	}
+
+	if err := checkRenderedManifests(d, manifests, caps.APIVersions); err != nil {
+		return err
+	}
+
+	// The deployed release is repaired on apply otherwise.
+	if d.Get("check_removed_apis").(bool) && d.Id() != "" && !d.Get("repair_removed_apis").(bool) {
+		if err := checkDeployedAPIs(actionConfig.Releases, d.Get("name").(string), caps.APIVersions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkManifestsClientSide runs the checks of the manifests which don't need
+// the cluster, the chart being rendered with the capabilities set by the
+// provider. The validation against the schemas of the cluster, and the
+// checks of the deployed release, are left to the next plan.
+func checkManifestsClientSide(d *schema.ResourceDiff, m *Meta, c *chart.Chart) error {
+	caps, err := clientCapabilities(m)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := renderManifests(d, c, caps)
+	if err != nil {
+		return err
+	}
+	return checkRenderedManifests(d, manifests, caps.APIVersions)
+}
+
+// checkRenderedManifests checks the rendered manifests against the policies
+// of the policy block, and for the removed API versions if
+// check_removed_apis is set.
+func checkRenderedManifests(d *schema.ResourceDiff, manifests []string, apiVersions chartutil.VersionSet) error {
+	if len(d.Get("policy").([]interface{})) > 0 {
+		if err := evaluatePolicy(expandPolicyOptions(d), manifests); err != nil {
+			return err
+		}
+	}
+
+	if d.Get("check_removed_apis").(bool) {
+		if usages := removedAPIUsages(manifests, apiVersions); len(usages) > 0 {
+			return fmt.Errorf("the chart uses API versions removed from the cluster: \n\t%s", strings.Join(usages, "\n\t"))
+		}
+	}
+	return nil
+}
+
+// checkDeployedAPIs checks the manifest of the deployed release for the API
+// versions removed from the cluster: Helm has to map its resources to
+// upgrade it, which fails on the removed API versions.
+func checkDeployedAPIs(releases *storage.Storage, name string, apiVersions chartutil.VersionSet) error {
+	last, err := releases.Last(name)
+	if err == driver.ErrReleaseNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not get the deployed release %s", name)
+	}
+
+	usages := removedAPIUsages(splitManifest(last.Manifest), apiVersions)
+	if len(usages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("revision %d of release %s uses API versions removed from the cluster, set repair_removed_apis to repair its manifest before upgrading: \n\t%s",
+		last.Version, name, strings.Join(usages, "\n\t"))
+}
+
+// manifestChecksEnabled reports whether the rendered manifests of the
+// release are checked when planning.
+func manifestChecksEnabled(d resourceGetter) bool {
+	return d.Get("validate_manifests").(bool) || d.Get("check_removed_apis").(bool) ||
+		len(d.Get("policy").([]interface{})) > 0
+}
+
+// checkSubchartValues validates the values of the release against the
+// schemas of the subcharts of its chart, once the values are known. The
+// chart is loaded again, the dependencies being processed with the values.
+func checkSubchartValues(d *schema.ResourceDiff, path string) error {
+	if !valuesKnown(d) {
+		return nil
+	}
+
+	c, err := loader.Load(path)
+	if err != nil {
+		return err
+	}
+	values, err := getValues(d)
+	if err != nil {
+		return err
+	}
+	return validateSubchartValues(c, values)
+}
+
+// validateSubchartValues validates the values of each enabled subchart of
+// the chart against its values.schema.json, as Helm does on install, and
+// reports the subchart rejecting each path of the merged values. It does
+// nothing if the dependencies of the chart are missing.
+func validateSubchartValues(c *chart.Chart, values map[string]interface{}) error {
+	if err := action.CheckDependencies(c, c.Metadata.Dependencies); err != nil {
+		debug("Unable to validate the values of the subcharts: %s", err)
+		return nil
+	}
+	if err := chartutil.ProcessDependencies(c, values); err != nil {
+		return err
+	}
+	vals, err := chartutil.CoalesceValues(c, values)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, sub := range c.Dependencies() {
+		errs = append(errs, subchartSchemaErrors(sub, vals, sub.Name())...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("values don't meet the schemas of the subcharts: \n\t%s", strings.Join(errs, "\n\t"))
+}
+
+// subchartSchemaErrors returns the errors of the validation of the values of
+// the subchart, and of its own subcharts, the subchart being at the path of
+// the merged values.
+func subchartSchemaErrors(c *chart.Chart, parentValues map[string]interface{}, path string) []string {
+	values, _ := parentValues[c.Name()].(map[string]interface{})
+
+	var errs []string
+	if c.Schema != nil {
+		if err := chartutil.ValidateAgainstSingleSchema(values, c.Schema); err != nil {
+			for _, line := range strings.Split(strings.TrimSpace(err.Error()), "\n") {
+				errs = append(errs, schemaError(path, line))
+			}
+		}
+	}
+	for _, sub := range c.Dependencies() {
+		errs = append(errs, subchartSchemaErrors(sub, values, path+"."+sub.Name())...)
+	}
+	return errs
+}
+
+// schemaError returns the error of the schema of the subchart at the path,
+// the field of the error being prefixed with the path.
+func schemaError(path, line string) string {
+	if !strings.HasPrefix(line, "- ") {
+		return fmt.Sprintf("subchart %s: %s", path, line)
+	}
+	line = strings.TrimPrefix(line, "- ")
+
+	field, desc := path, line
+	if i := strings.Index(line, ": "); i > 0 {
+		field, desc = line[:i], line[i+2:]
+		if field == "(root)" {
+			field = path
+		} else {
+			field = path + "." + field
+		}
+	}
+	return fmt.Sprintf("subchart %s rejected %s: %s", path, field, desc)
+}
@@ -0,0 +1,61 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestManifestName(t *testing.T) {
+	manifest := "---\n# Source: redis/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\n"
+	if name := manifestName(manifest); name != "redis/templates/deployment.yaml" {
+		t.Errorf("expected the template of the manifest, got %q", name)
+	}
+	if name := manifestName("apiVersion: v1\nkind: ConfigMap\n"); name != "manifest" {
+		t.Errorf("expected a generic name, got %q", name)
+	}
+}
+
+func TestValidateSubchartValues(t *testing.T) {
+	schema := []byte(`{"type": "object", "properties": {"replicas": {"type": "integer"}}}`)
+	newChart := func() *chart.Chart {
+		sub := &chart.Chart{
+			Metadata: &chart.Metadata{APIVersion: "v2", Name: "redis", Version: "1.0.0"},
+			Values:   map[string]interface{}{"replicas": 1},
+			Schema:   schema,
+		}
+		c := &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: "v2",
+				Name:       "app",
+				Version:    "1.0.0",
+				Dependencies: []*chart.Dependency{
+					{Name: "redis", Version: "1.0.0", Condition: "redis.enabled"},
+				},
+			},
+			Values: map[string]interface{}{},
+		}
+		c.AddDependency(sub)
+		return c
+	}
+
+	if err := validateSubchartValues(newChart(), map[string]interface{}{}); err != nil {
+		t.Errorf("expected the default values to be valid, got %s", err)
+	}
+
+	values := map[string]interface{}{"redis": map[string]interface{}{"replicas": "two"}}
+	err := validateSubchartValues(newChart(), values)
+	if err == nil {
+		t.Fatal("expected the values of the subchart to be rejected")
+	}
+	if !strings.Contains(err.Error(), "subchart redis rejected redis.replicas: Invalid type") {
+		t.Errorf("expected the subchart and the path to be reported, got %s", err)
+	}
+
+	// The disabled subcharts are not validated, as on install.
+	values["redis"].(map[string]interface{})["enabled"] = false
+	if err := validateSubchartValues(newChart(), values); err != nil {
+		t.Errorf("expected the disabled subchart not to be validated, got %s", err)
+	}
+}
@@ -0,0 +1,141 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// valuesAttributes are the attributes of the release the merged values are
+// computed from.
+var valuesAttributes = []string{"values", "values_merge", "set", "set_sensitive", "unset"}
+
+// priorValues gets the prior values of the attributes of the release, for
+// the merged values before the change to be computed.
+type priorValues struct {
+	d interface {
+		GetChange(string) (interface{}, interface{})
+	}
+}
+
+func (p priorValues) Get(key string) interface{} {
+	old, _ := p.d.GetChange(key)
+	return old
+}
+
+// valuesKnown reports whether the attributes the merged values are computed
+// from are known when planning.
+func valuesKnown(d *schema.ResourceDiff) bool {
+	for _, k := range valuesAttributes {
+		if !d.NewValueKnown(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// setValuesDiff sets values_diff to the changes of the merged values of the
+// release being upgraded, one line per changed path. It is left as is when
+// the values don't change, and unknown until the values are.
+func setValuesDiff(d *schema.ResourceDiff) error {
+	if d.Id() == "" {
+		return nil
+	}
+	if !valuesKnown(d) {
+		return d.SetNewComputed("values_diff")
+	}
+	changed := false
+	for _, k := range valuesAttributes {
+		changed = changed || d.HasChange(k)
+	}
+	if !changed {
+		return nil
+	}
+
+	prior, err := getValues(priorValues{d})
+	if err != nil {
+		return err
+	}
+	cloakSetValues(prior, priorValues{d})
+	values, err := getValues(d)
+	if err != nil {
+		return err
+	}
+	cloakSetValues(values, d)
+
+	for _, path := range ignoredValuePaths(d) {
+		deleteValuePath(prior, path)
+		deleteValuePath(values, path)
+	}
+
+	return d.SetNew("values_diff", diffValues(flattenValues(prior), flattenValues(values)))
+}
+
+// flattenValues flattens the values into their paths, like the names of
+// the set blocks, mapped to their JSON encoded leaf values.
+func flattenValues(values map[string]interface{}) map[string]string {
+	out := map[string]string{}
+	var flatten func(path string, v interface{})
+	flatten = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if len(v) > 0 {
+				for k, e := range v {
+					if path == "" {
+						flatten(k, e)
+					} else {
+						flatten(path+"."+k, e)
+					}
+				}
+				return
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				for i, e := range v {
+					flatten(fmt.Sprintf("%s[%d]", path, i), e)
+				}
+				return
+			}
+		}
+		b, _ := json.Marshal(v)
+		out[path] = string(b)
+	}
+	flatten("", values)
+	delete(out, "")
+	return out
+}
+
+// diffValues returns the changes between the flattened values, sorted by
+// path: "+ path: value" for the added ones, "- path: value" for the removed
+// ones and "~ path: old -> new" for the changed ones.
+func diffValues(prior, values map[string]string) []string {
+	changed := map[string]string{}
+	for path, v := range values {
+		old, ok := prior[path]
+		switch {
+		case !ok:
+			changed[path] = fmt.Sprintf("+ %s: %s", path, v)
+		case old != v:
+			changed[path] = fmt.Sprintf("~ %s: %s -> %s", path, old, v)
+		}
+	}
+	for path, old := range prior {
+		if _, ok := values[path]; !ok {
+			changed[path] = fmt.Sprintf("- %s: %s", path, old)
+		}
+	}
+
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	changes := make([]string, 0, len(paths))
+	for _, path := range paths {
+		changes = append(changes, changed[path])
+	}
+	return changes
+}
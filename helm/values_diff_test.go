@@ -0,0 +1,35 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	prior := map[string]interface{}{
+		"image":     map[string]interface{}{"repository": "nginx", "tag": "1.19"},
+		"replicas":  int64(1),
+		"args":      []interface{}{"--a", "--b"},
+		"resources": map[string]interface{}{},
+	}
+	values := map[string]interface{}{
+		"image":     map[string]interface{}{"repository": "nginx", "tag": "1.20"},
+		"args":      []interface{}{"--a"},
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}},
+	}
+
+	expected := []string{
+		"- args[1]: \"--b\"",
+		"~ image.tag: \"1.19\" -> \"1.20\"",
+		"- replicas: 1",
+		"- resources: {}",
+		"+ resources.limits.cpu: \"1\"",
+	}
+	if got := diffValues(flattenValues(prior), flattenValues(values)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if got := diffValues(flattenValues(values), flattenValues(values)); len(got) != 0 {
+		t.Errorf("expected no changes, got %q", got)
+	}
+}
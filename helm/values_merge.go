@@ -0,0 +1,52 @@
+package helm
+
+const (
+	mapMergeDeep     = "deep"
+	mapMergeReplace  = "replace"
+	listMergeReplace = "replace"
+	listMergeAppend  = "append"
+)
+
+// valuesMergeOptions are the options of the values_merge block, setting how
+// the values entries are merged.
+type valuesMergeOptions struct {
+	maps  string
+	lists string
+}
+
+func expandValuesMergeOptions(d resourceGetter) valuesMergeOptions {
+	opts := valuesMergeOptions{maps: mapMergeDeep, lists: listMergeReplace}
+	if len(d.Get("values_merge").([]interface{})) == 0 {
+		return opts
+	}
+
+	opts.maps = d.Get("values_merge.0.maps").(string)
+	opts.lists = d.Get("values_merge.0.lists").(string)
+	return opts
+}
+
+// mergeValues merges the values b into a, b taking precedence. The maps of
+// both are merged recursively unless the maps are replaced, and the lists of
+// b are appended to those of a if the lists are appended.
+func mergeValues(a, b map[string]interface{}, opts valuesMergeOptions) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if bv, ok := out[k].(map[string]interface{}); ok && opts.maps == mapMergeDeep {
+				out[k] = mergeValues(bv, v, opts)
+				continue
+			}
+		case []interface{}:
+			if bv, ok := out[k].([]interface{}); ok && opts.lists == listMergeAppend {
+				out[k] = append(append([]interface{}{}, bv...), v...)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
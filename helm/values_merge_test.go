@@ -0,0 +1,62 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	a := map[string]interface{}{
+		"list": []interface{}{"a"},
+		"map":  map[string]interface{}{"a": 1, "b": 1},
+	}
+	b := map[string]interface{}{
+		"list": []interface{}{"b"},
+		"map":  map[string]interface{}{"b": 2},
+	}
+
+	tests := []struct {
+		opts     valuesMergeOptions
+		expected map[string]interface{}
+	}{
+		{
+			valuesMergeOptions{maps: mapMergeDeep, lists: listMergeReplace},
+			map[string]interface{}{
+				"list": []interface{}{"b"},
+				"map":  map[string]interface{}{"a": 1, "b": 2},
+			},
+		},
+		{
+			valuesMergeOptions{maps: mapMergeReplace, lists: listMergeAppend},
+			map[string]interface{}{
+				"list": []interface{}{"a", "b"},
+				"map":  map[string]interface{}{"b": 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mergeValues(a, b, tt.opts); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%+v: expected %v, got %v", tt.opts, tt.expected, got)
+		}
+	}
+	if !reflect.DeepEqual(a["list"], []interface{}{"a"}) {
+		t.Errorf("the merged values were modified: %v", a)
+	}
+}
+
+func TestGetValuesMerge(t *testing.T) {
+	d := resourceRelease().Data(nil)
+	d.Set("values", []string{"args: [--a]", "args: [--b]"})
+	d.Set("values_merge", []interface{}{
+		map[string]interface{}{"maps": mapMergeDeep, "lists": listMergeAppend},
+	})
+
+	values, err := getValues(d)
+	if err != nil {
+		t.Fatalf("error getValues: %s", err)
+	}
+	if expected := []interface{}{"--a", "--b"}; !reflect.DeepEqual(values["args"], expected) {
+		t.Errorf("expected %v, got %v", expected, values["args"])
+	}
+}
@@ -0,0 +1,81 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// pessimisticConstraint matches the Terraform pessimistic constraint
+// operator, e.g. "~> 1.4".
+var pessimisticConstraint = regexp.MustCompile(`~>\s*v?([0-9]+(\.[0-9]+){0,2})([-+][0-9A-Za-z.+-]*)?`)
+
+// constraintVersion matches the versions of a constraint, with their
+// comparison operator.
+var constraintVersion = regexp.MustCompile(`(!=|[<>=~^]*)\s*v?([0-9]+(\.[0-9xX*]+){0,2})(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?`)
+
+// includePrereleases returns the version constraint matching the
+// prereleases too. Only the constraints with a prerelease match the
+// prereleases, "-0" being the lowest one.
+func includePrereleases(constraint string) string {
+	if strings.TrimSpace(constraint) == "" {
+		return ">0.0.0-0"
+	}
+
+	return constraintVersion.ReplaceAllStringFunc(constraint, func(s string) string {
+		m := constraintVersion.FindStringSubmatch(s)
+		switch {
+		case m[1] == "" || m[1] == "=" || m[1] == "==" || m[1] == "!=":
+			// Exact versions are kept as is.
+			return s
+		case m[4] != "" || strings.ContainsAny(m[2], "xX*"):
+			return s
+		}
+		return strings.TrimSuffix(s, m[5]) + "-0" + m[5]
+	})
+}
+
+// normalizeVersionConstraint translates the Terraform pessimistic operator
+// of the version constraint into the Helm syntax: only the rightmost
+// component of the version may be incremented, "~> 1.4" allowing 1.x
+// versions from 1.4 and "~> 1.4.2" allowing 1.4.x versions from 1.4.2.
+// "~> 1" allows 1.x versions. The two and one component versions are
+// translated into explicit ranges, a caret only allowing 0.4.x versions for
+// "^0.4".
+func normalizeVersionConstraint(constraint string) string {
+	return pessimisticConstraint.ReplaceAllStringFunc(constraint, func(s string) string {
+		m := pessimisticConstraint.FindStringSubmatch(s)
+		parts := strings.Split(m[1], ".")
+		if len(parts) == 3 {
+			return "~" + m[1] + m[3]
+		}
+
+		major, _ := strconv.Atoi(parts[0])
+		minor := "0"
+		if len(parts) == 2 {
+			minor = parts[1]
+		}
+		return fmt.Sprintf(">=%d.%s.0%s, <%d.0.0", major, minor, m[3], major+1)
+	})
+}
+
+// checkVersionLocked returns an error if the version of the chart of the
+// release would change while it is locked and the version attribute was
+// not changed. It happens when the version of a local chart is bumped, or
+// when the chart is downloaded from a URL.
+func checkVersionLocked(d *schema.ResourceDiff, c *chart.Chart) error {
+	if !d.Get("version_locked").(bool) || d.Id() == "" || d.HasChange("version") {
+		return nil
+	}
+
+	installed := d.Get("resolved_version").(string)
+	if installed == "" || installed == c.Metadata.Version {
+		return nil
+	}
+
+	return fmt.Errorf("the version of chart %q would change from %s to %s while version_locked is set, set the version attribute to upgrade the chart", c.Metadata.Name, installed, c.Metadata.Version)
+}
@@ -0,0 +1,103 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+func TestNormalizeVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		expected   string
+	}{
+		{"1.4.2", "1.4.2"},
+		{"~1.4", "~1.4"},
+		{">= 1.4, < 2.0", ">= 1.4, < 2.0"},
+		{"~> 1.4", ">=1.4.0, <2.0.0"},
+		{"~>1.4.2", "~1.4.2"},
+		{"~> 1", ">=1.0.0, <2.0.0"},
+		{"~> 1.4.0-rc.1", "~1.4.0-rc.1"},
+		{"~> 1.4, != 1.5.0", ">=1.4.0, <2.0.0, != 1.5.0"},
+		{"~> 0.4", ">=0.4.0, <1.0.0"},
+		{"~> 0", ">=0.0.0, <1.0.0"},
+		{"~> 0.4.2", "~0.4.2"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeVersionConstraint(tt.constraint); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.constraint, tt.expected, got)
+		}
+	}
+}
+
+func TestNormalizeVersionConstraintMatching(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"~> 0.4", "0.5.0", true},
+		{"~> 0.4", "0.3.9", false},
+		{"~> 0.4", "1.0.0", false},
+		{"~> 0", "0.9.1", true},
+		{"~> 0.4.2", "0.4.9", true},
+		{"~> 0.4.2", "0.5.0", false},
+		{"~> 1.4", "1.9.0", true},
+		{"~> 1.4", "2.0.0", false},
+	}
+
+	for _, tt := range tests {
+		c, err := semver.NewConstraint(normalizeVersionConstraint(tt.constraint))
+		if err != nil {
+			t.Fatalf("%q: %s", tt.constraint, err)
+		}
+		if got := c.Check(semver.MustParse(tt.version)); got != tt.expected {
+			t.Errorf("%q: expected %s to match: %t", tt.constraint, tt.version, tt.expected)
+		}
+	}
+}
+
+func TestIncludePrereleases(t *testing.T) {
+	tests := []struct {
+		constraint string
+		expected   string
+	}{
+		{"", ">0.0.0-0"},
+		{"1.4.2", "1.4.2"},
+		{"^1.4", "^1.4-0"},
+		{">= 1.4, < 2.0.0", ">= 1.4-0, < 2.0.0-0"},
+		{">= 1.4.0-rc.0", ">= 1.4.0-rc.0"},
+		{"~1.4.2+build, != 1.4.3", "~1.4.2-0+build, != 1.4.3"},
+		{"^1.x", "^1.x"},
+	}
+
+	for _, tt := range tests {
+		if got := includePrereleases(tt.constraint); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.constraint, tt.expected, got)
+		}
+	}
+}
+
+func TestIncludePrereleasesMatching(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"~> 1.4", "1.5.0-rc.1", true},
+		{"~> 1.4", "2.0.0-rc.1", false},
+		{">= 1.4.0-rc.0", "1.4.0-beta.1", false},
+		{">= 1.4.0-rc.0", "1.4.0-rc.2", true},
+	}
+
+	for _, tt := range tests {
+		c, err := semver.NewConstraint(includePrereleases(normalizeVersionConstraint(tt.constraint)))
+		if err != nil {
+			t.Fatalf("%q: %s", tt.constraint, err)
+		}
+		if got := c.Check(semver.MustParse(tt.version)); got != tt.expected {
+			t.Errorf("%q: expected %s to match: %t", tt.constraint, tt.version, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// readinessCheck is a readiness rule of the custom resources of a kind,
+// ready when their condition has the expected status.
+type readinessCheck struct {
+	apiGroup  string
+	kind      string
+	condition string
+	status    string
+}
+
+// matches reports whether the readiness check applies to the resource.
+func (c readinessCheck) matches(info *resource.Info) bool {
+	gvk := info.Mapping.GroupVersionKind
+	return gvk.Kind == c.kind && (c.apiGroup == "" || gvk.Group == c.apiGroup)
+}
+
+func (c readinessCheck) String() string {
+	return fmt.Sprintf("%s=%s", c.condition, c.status)
+}
+
+// expandReadinessChecks returns the readiness checks of the release.
+func expandReadinessChecks(d resourceGetter) []readinessCheck {
+	var checks []readinessCheck
+	for _, raw := range d.Get("readiness_check").([]interface{}) {
+		c := raw.(map[string]interface{})
+		checks = append(checks, readinessCheck{
+			apiGroup:  c["api_group"].(string),
+			kind:      c["kind"].(string),
+			condition: c["condition"].(string),
+			status:    c["status"].(string),
+		})
+	}
+	return checks
+}
+
+// waitFilter selects the resources waited for.
+type waitFilter struct {
+	kinds    map[string]bool
+	selector labels.Selector
+}
+
+// matches reports whether the resource is waited for. The CRDs are always
+// waited for, since their custom resources can't be created before.
+func (f *waitFilter) matches(info *resource.Info) bool {
+	if info.Mapping.GroupVersionKind.Kind == "CustomResourceDefinition" {
+		return true
+	}
+	if len(f.kinds) > 0 && !f.kinds[info.Mapping.GroupVersionKind.Kind] {
+		return false
+	}
+	if f.selector == nil {
+		return true
+	}
+
+	accessor, err := meta.Accessor(info.Object)
+	if err != nil {
+		return false
+	}
+	return f.selector.Matches(labels.Set(accessor.GetLabels()))
+}
+
+// expandWaitFilter returns the filter of the resources waited for, or nil if
+// all of them are.
+func expandWaitFilter(d resourceGetter) (*waitFilter, error) {
+	if len(d.Get("wait_for").([]interface{})) == 0 {
+		return nil, nil
+	}
+
+	f := &waitFilter{kinds: map[string]bool{}}
+	for _, k := range d.Get("wait_for.0.kinds").(*schema.Set).List() {
+		f.kinds[k.(string)] = true
+	}
+
+	if s := d.Get("wait_for.0.label_selector").(string); s != "" {
+		selector, err := labels.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait_for label selector %q: %v", s, err)
+		}
+		f.selector = selector
+	}
+	return f, nil
+}
+
+// waitProgressInterval is the interval between the logs of the resources
+// still unready while waiting.
+const waitProgressInterval = 30 * time.Second
+
+// waitKubeClient limits the wait to the resources selected by the filter,
+// and waits for the custom resources of the release to be ready according
+// to the readiness checks, once Helm is done waiting for the core ones. The
+// resources still unready are logged periodically during the wait, and the
+// recent events of the resources, and the logs of the hooks, are attached
+// to the wait failures.
+type waitKubeClient struct {
+	kube.Interface
+	filter           *waitFilter
+	checks           []readinessCheck
+	progressInterval time.Duration
+	hookLogLines     int64
+	clientset        func() (kubernetes.Interface, error)
+	// waitTimeout and hookTimeout override the timeout of the operation,
+	// set by the operationBudget attribute, for the wait of the resources
+	// and for the hooks, if set.
+	waitTimeout     time.Duration
+	hookTimeout     time.Duration
+	operationBudget string
+}
+
+// timeoutBudgetError is the timeout of a wait of the release, naming the
+// attribute setting its budget. Its message names the attribute too, since
+// Helm flattens the errors of the hooks.
+type timeoutBudgetError struct {
+	attribute string
+	timeout   time.Duration
+	err       error
+}
+
+func (e *timeoutBudgetError) Error() string {
+	return fmt.Sprintf("%s of %s exceeded: %s", e.attribute, e.timeout, e.err)
+}
+
+func (e *timeoutBudgetError) Unwrap() error {
+	return e.err
+}
+
+// budgetTimeout returns the timeout of the wait, the attribute overriding
+// the timeout of the operation if it is set, and the attribute setting it.
+func (c *waitKubeClient) budgetTimeout(override time.Duration, attribute string, timeout time.Duration) (time.Duration, string) {
+	if override > 0 {
+		return override, attribute
+	}
+	if c.operationBudget == "" {
+		return timeout, "timeout"
+	}
+	return timeout, c.operationBudget
+}
+
+// withTimeoutBudget wraps the timeout of the wait to name its budget.
+func withTimeoutBudget(err error, attribute string, timeout time.Duration) error {
+	if err == nil || !errors.Is(err, wait.ErrWaitTimeout) {
+		return err
+	}
+	return &timeoutBudgetError{attribute: attribute, timeout: timeout, err: err}
+}
+
+// newWaitKubeClient returns the client of the configuration waiting for the
+// resources of the release as configured.
+func newWaitKubeClient(d resourceGetter, cfg *action.Configuration) (kube.Interface, error) {
+	filter, err := expandWaitFilter(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &waitKubeClient{
+		Interface:        cfg.KubeClient,
+		filter:           filter,
+		checks:           expandReadinessChecks(d),
+		progressInterval: waitProgressInterval,
+		hookLogLines:     int64(d.Get("hook_log_lines").(int)),
+		clientset:        cfg.KubernetesClientSet,
+		waitTimeout:      time.Duration(d.Get("wait_timeout").(int)) * time.Second,
+		hookTimeout:      time.Duration(d.Get("hook_timeout").(int)) * time.Second,
+		operationBudget:  operationTimeoutAttribute(d),
+	}, nil
+}
+
+// WatchUntilReady implements kube.Interface
+func (c *waitKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	timeout, attribute := c.budgetTimeout(c.hookTimeout, "hook_timeout", timeout)
+	err := withTimeoutBudget(c.Interface.WatchUntilReady(resources, timeout), attribute, timeout)
+	err = withHookLogs(c.clientset, resources, c.hookLogLines, err)
+	return withReleaseEvents(c.clientset, resources, err)
+}
+
+// Wait implements kube.Interface
+func (c *waitKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	timeout, attribute := c.budgetTimeout(c.waitTimeout, "wait_timeout", timeout)
+	err := withTimeoutBudget(c.wait(resources, timeout), attribute, timeout)
+	return withReleaseEvents(c.clientset, resources, err)
+}
+
+func (c *waitKubeClient) wait(resources kube.ResourceList, timeout time.Duration) error {
+	if c.filter != nil {
+		var selected kube.ResourceList
+		for _, info := range resources {
+			if c.filter.matches(info) {
+				selected = append(selected, info)
+			}
+		}
+		debug("Waiting for %d of the %d resources", len(selected), len(resources))
+		resources = selected
+	}
+
+	start := time.Now()
+	stop := make(chan struct{})
+	go reportWaitProgress(resources, c.progressInterval, start, stop)
+	err := c.Interface.Wait(resources, timeout)
+	close(stop)
+	if err != nil {
+		return err
+	}
+
+	pending := map[*resource.Info]readinessCheck{}
+	for _, info := range resources {
+		for _, check := range c.checks {
+			if check.matches(info) {
+				pending[info] = check
+				break
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var unready []string
+	err = wait.PollImmediate(2*time.Second, timeout-time.Since(start), func() (bool, error) {
+		unready = nil
+		for info, check := range pending {
+			ready, err := isCustomResourceReady(info, check)
+			if err != nil {
+				return false, err
+			}
+			if !ready {
+				unready = append(unready, fmt.Sprintf("%s/%s (%s)", info.Mapping.GroupVersionKind.Kind, info.Name, check))
+			}
+		}
+		if len(unready) > 0 {
+			debug("Waiting for %s", strings.Join(unready, ", "))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("custom resources not ready: %s: %w", strings.Join(unready, ", "), err)
+	}
+	return err
+}
+
+// isCustomResourceReady reports whether the custom resource is ready.
+func isCustomResourceReady(info *resource.Info, check readinessCheck) (bool, error) {
+	if err := info.Get(); err != nil {
+		return false, err
+	}
+
+	obj, err := unstructuredContent(info.Object)
+	if err != nil {
+		return false, err
+	}
+	return check.isReady(obj), nil
+}
+
+// unstructuredContent returns the content of the object as a map.
+func unstructuredContent(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// isReady reports whether the object is ready, kstatus-style: its status
+// must be up to date with its spec, and its condition must have the
+// expected status.
+func (c readinessCheck) isReady(obj map[string]interface{}) bool {
+	generation, _, _ := unstructured.NestedInt64(obj, "metadata", "generation")
+	observed, found, _ := unstructured.NestedInt64(obj, "status", "observedGeneration")
+	if found && observed < generation {
+		return false
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+	for _, raw := range conditions {
+		condition, ok := raw.(map[string]interface{})
+		if !ok || condition["type"] != c.condition {
+			continue
+		}
+		return strings.EqualFold(fmt.Sprint(condition["status"]), c.status)
+	}
+	return false
+}
+
+// reportWaitProgress logs the resources still unready every interval, until
+// stop is closed, so that long waits aren't silent. The resources are
+// fetched without updating their info, which Helm reads while waiting.
+func reportWaitProgress(resources kube.ResourceList, interval time.Duration, start time.Time, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		var unready []string
+		for _, info := range resources {
+			obj, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name, false)
+			if err != nil {
+				continue
+			}
+			content, err := unstructuredContent(obj)
+			if err != nil {
+				continue
+			}
+			if status := unreadyStatus(info.Mapping.GroupVersionKind.Kind, content); status != "" {
+				unready = append(unready, fmt.Sprintf("%s/%s (%s)", info.Mapping.GroupVersionKind.Kind, info.Name, status))
+			}
+		}
+
+		elapsed := time.Since(start).Round(time.Second)
+		if len(unready) == 0 {
+			log.Printf("[INFO] Still waiting for the resources of the release after %s", elapsed)
+			continue
+		}
+		log.Printf("[INFO] Still waiting after %s for %s", elapsed, strings.Join(unready, ", "))
+	}
+}
+
+// unreadyStatus describes the progress of the resource, or returns an empty
+// string if the resource looks ready or its kind isn't known.
+func unreadyStatus(kind string, obj map[string]interface{}) string {
+	nestedInt := func(fields ...string) int64 {
+		v, _, _ := unstructured.NestedInt64(obj, fields...)
+		return v
+	}
+	nestedString := func(fields ...string) string {
+		v, _, _ := unstructured.NestedString(obj, fields...)
+		return v
+	}
+
+	switch kind {
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		desired, found, _ := unstructured.NestedInt64(obj, "spec", "replicas")
+		if !found {
+			desired = 1
+		}
+		ready := nestedInt("status", "readyReplicas")
+		updated := nestedInt("status", "updatedReplicas")
+		if kind == "ReplicaSet" {
+			updated = desired
+		}
+		if desired == 0 || (ready >= desired && updated >= desired) {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d ready, %d%% updated", ready, desired, updated*100/desired)
+	case "DaemonSet":
+		desired := nestedInt("status", "desiredNumberScheduled")
+		ready := nestedInt("status", "numberReady")
+		if ready >= desired {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d ready", ready, desired)
+	case "Job":
+		completions, found, _ := unstructured.NestedInt64(obj, "spec", "completions")
+		if !found {
+			completions = 1
+		}
+		succeeded := nestedInt("status", "succeeded")
+		if succeeded >= completions {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d completed", succeeded, completions)
+	case "Pod":
+		if phase := nestedString("status", "phase"); phase != "Running" && phase != "Succeeded" {
+			return strings.ToLower(phase)
+		}
+	case "PersistentVolumeClaim":
+		if phase := nestedString("status", "phase"); phase != "Bound" {
+			return strings.ToLower(phase)
+		}
+	case "Service":
+		if nestedString("spec", "type") != "LoadBalancer" {
+			return ""
+		}
+		ingress, _, _ := unstructured.NestedSlice(obj, "status", "loadBalancer", "ingress")
+		if len(ingress) == 0 {
+			return "load balancer pending"
+		}
+	}
+	return ""
+}
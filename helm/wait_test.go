@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestReadinessCheckIsReady(t *testing.T) {
+	check := readinessCheck{kind: "Kafka", condition: "Ready", status: "True"}
+
+	object := func(generation, observed int64, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"generation": generation,
+			},
+			"status": map[string]interface{}{
+				"observedGeneration": observed,
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Available", "status": "True"},
+					map[string]interface{}{"type": "Ready", "status": status},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		obj      map[string]interface{}
+		expected bool
+	}{
+		{"ready", object(2, 2, "True"), true},
+		{"not ready", object(2, 2, "False"), false},
+		{"outdated status", object(3, 2, "True"), false},
+		{"no status", map[string]interface{}{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := check.isReady(tt.obj); got != tt.expected {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestWaitFilter(t *testing.T) {
+	info := func(kind, component string) *resource.Info {
+		obj := &unstructured.Unstructured{}
+		obj.SetLabels(map[string]string{"app.kubernetes.io/component": component})
+		return &resource.Info{
+			Name:    component,
+			Object:  obj,
+			Mapping: &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Kind: kind}},
+		}
+	}
+
+	f := &waitFilter{
+		kinds:    map[string]bool{"Deployment": true},
+		selector: labels.SelectorFromSet(labels.Set{"app.kubernetes.io/component": "api"}),
+	}
+
+	tests := []struct {
+		info     *resource.Info
+		expected bool
+	}{
+		{info("Deployment", "api"), true},
+		{info("Deployment", "worker"), false},
+		{info("DaemonSet", "api"), false},
+		{info("CustomResourceDefinition", "crd"), true},
+	}
+
+	for _, tt := range tests {
+		if got := f.matches(tt.info); got != tt.expected {
+			t.Errorf("%s %s: expected %t, got %t", tt.info.Mapping.GroupVersionKind.Kind, tt.info.Name, tt.expected, got)
+		}
+	}
+}
+
+func TestUnreadyStatus(t *testing.T) {
+	tests := []struct {
+		kind     string
+		obj      map[string]interface{}
+		expected string
+	}{
+		{
+			kind: "Deployment",
+			obj: map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(4)},
+				"status": map[string]interface{}{"readyReplicas": int64(1), "updatedReplicas": int64(2)},
+			},
+			expected: "1/4 ready, 50% updated",
+		},
+		{
+			kind: "Deployment",
+			obj: map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{"readyReplicas": int64(2), "updatedReplicas": int64(2)},
+			},
+			expected: "",
+		},
+		{
+			kind:     "DaemonSet",
+			obj:      map[string]interface{}{"status": map[string]interface{}{"desiredNumberScheduled": int64(3), "numberReady": int64(2)}},
+			expected: "2/3 ready",
+		},
+		{
+			kind:     "Pod",
+			obj:      map[string]interface{}{"status": map[string]interface{}{"phase": "Pending"}},
+			expected: "pending",
+		},
+		{
+			kind:     "Service",
+			obj:      map[string]interface{}{"spec": map[string]interface{}{"type": "LoadBalancer"}},
+			expected: "load balancer pending",
+		},
+		{
+			kind:     "ConfigMap",
+			obj:      map[string]interface{}{},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := unreadyStatus(tt.kind, tt.obj); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.kind, tt.expected, got)
+		}
+	}
+}
+
+// timeoutKubeClient times out the waits, recording their timeouts.
+type timeoutKubeClient struct {
+	kube.Interface
+	timeouts []time.Duration
+}
+
+func (c *timeoutKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	c.timeouts = append(c.timeouts, timeout)
+	return wait.ErrWaitTimeout
+}
+
+func (c *timeoutKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	c.timeouts = append(c.timeouts, timeout)
+	return wait.ErrWaitTimeout
+}
+
+func TestWaitKubeClientTimeouts(t *testing.T) {
+	inner := &timeoutKubeClient{}
+	client := &waitKubeClient{
+		Interface:        inner,
+		progressInterval: time.Hour,
+		clientset:        func() (kubernetes.Interface, error) { return nil, errors.New("no cluster") },
+		waitTimeout:      10 * time.Minute,
+	}
+
+	err := client.Wait(nil, 5*time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "wait_timeout of 10m0s exceeded") {
+		t.Errorf("expected the wait to exceed wait_timeout, got %v", err)
+	}
+	err = client.WatchUntilReady(nil, 5*time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "timeout of 5m0s exceeded") {
+		t.Errorf("expected the hook to exceed the timeout, got %v", err)
+	}
+	if !reflect.DeepEqual(inner.timeouts, []time.Duration{10 * time.Minute, 5 * time.Minute}) {
+		t.Errorf("unexpected timeouts %v", inner.timeouts)
+	}
+
+	err = timeoutError(context.Background(), errors.Wrap(err, "release failed"), "installation", "test", 5*time.Minute)
+	if err == nil || !strings.Contains(err.Error(), `installation of release "test" timed out, increase timeout`) {
+		t.Errorf("expected the budget to be named, got %v", err)
+	}
+}